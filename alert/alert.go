@@ -0,0 +1,289 @@
+// Package alert keeps track of the alerting state of every test, which
+// decides whether a result is notified, suppressed, or notified as a
+// recovery, according to the deduplication and min-duration rules.
+//
+// Tests which keep changing state are detected as flapping, Nagios-style:
+// once the rate of state changes over their last results goes above a high
+// threshold, a single "flapping started" result is notified, and nothing
+// else is until the rate goes below a low threshold.
+//
+// Every test has a single state record, which is updated atomically by
+// a Store, so that workers running the same test at the same time never
+// both notify, or both suppress, the same failure.
+//
+// The failures of tests depending on a failing test, identified by its
+// label, are suppressed altogether, see Dependencies.
+package alert
+
+import (
+	"time"
+)
+
+// The statuses of a test
+const (
+	// StatusOK is a test which is passing, or has never been seen
+	StatusOK = "ok"
+
+	// StatusPending is a test which is failing, but not for long enough
+	// to be notified yet
+	StatusPending = "pending"
+
+	// StatusFiring is a test which is failing, and whose failure has
+	// been notified
+	StatusFiring = "firing"
+
+	// StatusResolved is a test which is passing again, after a notified
+	// failure
+	StatusResolved = "resolved"
+)
+
+// The actions to take for a result
+const (
+	// ActionEmit notifies the result
+	ActionEmit = "emit"
+
+	// ActionSuppress does not notify a failure
+	ActionSuppress = "suppress"
+
+	// ActionRecover notifies the result as a recovery
+	ActionRecover = "recover"
+
+	// ActionDrop does not notify a success, e.g. after a failure which
+	// was never notified
+	ActionDrop = "drop"
+)
+
+// The reasons a result is not notified
+const (
+	ReasonMinDuration = "min-duration"
+	ReasonDedup       = "dedup"
+	ReasonNotNotified = "not-notified"
+	ReasonNeverFailed = "never-failed"
+	ReasonFlapping    = "flapping"
+)
+
+// The flapping transitions of a test
+const (
+	FlappingStarted = "started"
+	FlappingStopped = "stopped"
+)
+
+// State is the alerting state of a test.
+type State struct {
+	Status string `json:"status"`
+
+	// When the current run of failures started, as unix time
+	FirstFailure int64 `json:"firstFailure,omitempty"`
+
+	// When the last failure was notified, as unix time
+	LastNotify int64 `json:"lastNotify,omitempty"`
+
+	// How many consecutive failures have been seen
+	Failures int64 `json:"failures,omitempty"`
+
+	// The last results, oldest first, true for failures, if flap
+	// detection is enabled
+	History []bool `json:"history,omitempty"`
+
+	// Is the test flapping?
+	Flapping bool `json:"flapping,omitempty"`
+}
+
+// IsZero returns true if there's nothing worth keeping in the state.
+func (s State) IsZero() bool {
+	return (s.Status == "" || s.Status == StatusOK) && len(s.History) == 0 && !s.Flapping
+}
+
+// ChangeRate returns the rate of state changes in the history, from 0 to 1.
+func (s State) ChangeRate() float32 {
+	if len(s.History) < 2 {
+		return 0
+	}
+
+	changes := 0
+	for i := 1; i < len(s.History); i++ {
+		if s.History[i] != s.History[i-1] {
+			changes++
+		}
+	}
+	return float32(changes) / float32(len(s.History)-1)
+}
+
+// Rules are the notification rules of a test.
+type Rules struct {
+	// If > 0, failures are only notified once they've been going on for
+	// at least this long, and successes only if they recover from a
+	// notified failure
+	MinDuration time.Duration
+
+	// If > 0, failures are notified again only after this long
+	Dedup time.Duration
+
+	// If > 0, how many results are used to detect flapping
+	FlapWindow int
+
+	// The rates of state changes, from 0 to 1, above which a test starts
+	// flapping, and below which it stops
+	FlapHigh float32
+	FlapLow  float32
+
+	// How long the state is kept, without any result
+	TTL time.Duration
+}
+
+// Empty returns true if there are no rules, in which case every result
+// is notified, and no state needs to be kept.
+func (r Rules) Empty() bool {
+	return r.MinDuration <= 0 && r.Dedup <= 0 && r.FlapWindow <= 0
+}
+
+// Decision is what to do with a result.
+type Decision struct {
+	// One of the actions
+	Action string
+
+	// Why the result is not notified, if suppressed or dropped
+	Reason string
+
+	// The failure has already been notified, but the dedup period is
+	// over
+	IsDedup bool
+
+	// With a min-duration rule, when the failures started, if they were
+	// already going on
+	FirstFailure *int64
+
+	// How long ago the failures started, or the last notification was
+	// sent, depending on the reason
+	Since time.Duration
+
+	// FlappingStarted or FlappingStopped, if the test just started or
+	// stopped flapping
+	Flapping string
+
+	// The rate of state changes, if flap detection is enabled
+	ChangeRate float32
+}
+
+// Notify returns true if the result must be notified.
+func (d Decision) Notify() bool {
+	return d.Action == ActionEmit || d.Action == ActionRecover
+}
+
+// Transition applies a result to the state of a test, returning the new
+// state, and what to do with the result.
+func Transition(state State, failed bool, rules Rules, now time.Time) (State, Decision) {
+	history, flapping := state.History, state.Flapping
+
+	state, decision := transition(state, failed, rules, now)
+	if rules.FlapWindow <= 0 {
+		return state, decision
+	}
+
+	history = append(append([]bool(nil), history...), failed)
+	if len(history) > rules.FlapWindow {
+		history = history[len(history)-rules.FlapWindow:]
+	}
+	state.History = history
+	state.Flapping = flapping
+
+	decision.ChangeRate = state.ChangeRate()
+
+	//
+	// The flapping transitions replace whatever the result would have
+	// been, and the rate is only trusted once the window is full.
+	//
+	switch {
+	case !flapping && len(history) == rules.FlapWindow && decision.ChangeRate >= rules.FlapHigh:
+		state.Flapping = true
+		decision = Decision{Action: ActionEmit, Flapping: FlappingStarted, ChangeRate: decision.ChangeRate}
+	case flapping && decision.ChangeRate <= rules.FlapLow:
+		state.Flapping = false
+		decision = Decision{Action: ActionEmit, Flapping: FlappingStopped, ChangeRate: decision.ChangeRate}
+	case flapping:
+		decision = Decision{Action: ActionSuppress, Reason: ReasonFlapping, ChangeRate: decision.ChangeRate}
+	}
+
+	return state, decision
+}
+
+// transition applies a result to the status of a test.
+func transition(state State, failed bool, rules Rules, now time.Time) (State, Decision) {
+	if state.Status == "" {
+		state.Status = StatusOK
+	}
+
+	var decision Decision
+	if rules.MinDuration > 0 && state.FirstFailure != 0 {
+		firstFailure := state.FirstFailure
+		decision.FirstFailure = &firstFailure
+	}
+
+	if !failed {
+		switch state.Status {
+		case StatusFiring:
+			decision.Action = ActionRecover
+			return State{Status: StatusResolved}, decision
+		case StatusPending:
+			decision.Action = ActionDrop
+			decision.Reason = ReasonNotNotified
+			decision.Since = now.Sub(time.Unix(state.FirstFailure, 0))
+			return State{Status: StatusOK}, decision
+		}
+
+		// With min-duration only recoveries are notified
+		decision.Action = ActionEmit
+		if rules.MinDuration > 0 {
+			decision.Action = ActionDrop
+			decision.Reason = ReasonNeverFailed
+		}
+		return State{Status: StatusOK}, decision
+	}
+
+	switch state.Status {
+	case StatusPending:
+		state.Failures++
+		since := now.Sub(time.Unix(state.FirstFailure, 0))
+		if since < rules.MinDuration {
+			decision.Action = ActionSuppress
+			decision.Reason = ReasonMinDuration
+			decision.Since = since
+			return state, decision
+		}
+
+	case StatusFiring:
+		state.Failures++
+		since := now.Sub(time.Unix(state.LastNotify, 0))
+		if rules.Dedup > 0 && since < rules.Dedup {
+			decision.Action = ActionSuppress
+			decision.Reason = ReasonDedup
+			decision.Since = since
+			return state, decision
+		}
+		decision.IsDedup = rules.Dedup > 0
+
+	default:
+		state = State{
+			Status:       StatusPending,
+			FirstFailure: now.Unix(),
+			Failures:     1,
+		}
+		if rules.MinDuration > 0 {
+			decision.Action = ActionSuppress
+			decision.Reason = ReasonMinDuration
+			return state, decision
+		}
+	}
+
+	state.Status = StatusFiring
+	state.LastNotify = now.Unix()
+	decision.Action = ActionEmit
+	return state, decision
+}
+
+// Store keeps the states of the tests.
+type Store interface {
+	// Update applies a result to the state of the test with the given
+	// hash, atomically, returning what to do with the result.
+	Update(hash string, failed bool, rules Rules, now time.Time) (Decision, error)
+}
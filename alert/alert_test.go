@@ -0,0 +1,301 @@
+package alert
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// step is a result, and what should be done with it.
+type step struct {
+	after  time.Duration
+	failed bool
+	action string
+	reason string
+	status string
+}
+
+func runSteps(t *testing.T, rules Rules, steps []step) []Decision {
+	s := NewMemoryStore()
+	now := time.Unix(1000000, 0)
+
+	var decisions []Decision
+	for i, st := range steps {
+		now = now.Add(st.after)
+
+		decision, err := s.Update("test", st.failed, rules, now)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if decision.Action != st.action || decision.Reason != st.reason {
+			t.Errorf("Step %d: expected %s (%s), got %s (%s)", i, st.action, st.reason, decision.Action, decision.Reason)
+		}
+
+		status := StatusOK
+		if entry, ok := s.states["test"]; ok {
+			status = entry.state.Status
+		}
+		if status != st.status {
+			t.Errorf("Step %d: expected status %s, got %s", i, st.status, status)
+		}
+
+		decisions = append(decisions, decision)
+	}
+	return decisions
+}
+
+func TestNoRules(t *testing.T) {
+	runSteps(t, Rules{}, []step{
+		{0, true, ActionEmit, "", StatusFiring},
+		{time.Second, true, ActionEmit, "", StatusFiring},
+		{time.Second, false, ActionRecover, "", StatusResolved},
+		{time.Second, false, ActionEmit, "", StatusOK},
+	})
+}
+
+func TestMinDuration(t *testing.T) {
+	rules := Rules{MinDuration: time.Minute}
+
+	decisions := runSteps(t, rules, []step{
+		// Never failed
+		{0, false, ActionDrop, ReasonNeverFailed, StatusOK},
+
+		// Failures not lasting long enough
+		{time.Second, true, ActionSuppress, ReasonMinDuration, StatusPending},
+		{30 * time.Second, true, ActionSuppress, ReasonMinDuration, StatusPending},
+		{time.Second, false, ActionDrop, ReasonNotNotified, StatusOK},
+
+		// Failures lasting long enough
+		{time.Second, true, ActionSuppress, ReasonMinDuration, StatusPending},
+		{time.Minute, true, ActionEmit, "", StatusFiring},
+		{time.Second, true, ActionEmit, "", StatusFiring},
+		{time.Second, false, ActionRecover, "", StatusResolved},
+		{time.Second, false, ActionDrop, ReasonNeverFailed, StatusOK},
+	})
+
+	if decisions[1].FirstFailure != nil {
+		t.Errorf("The first failure should have no first failure time")
+	}
+	if decisions[5].FirstFailure == nil || *decisions[5].FirstFailure != 1000033 {
+		t.Errorf("Unexpected first failure time %v", decisions[5].FirstFailure)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	rules := Rules{Dedup: 5 * time.Minute}
+
+	decisions := runSteps(t, rules, []step{
+		{0, true, ActionEmit, "", StatusFiring},
+		{time.Minute, true, ActionSuppress, ReasonDedup, StatusFiring},
+		{4 * time.Minute, true, ActionEmit, "", StatusFiring},
+		{time.Minute, true, ActionSuppress, ReasonDedup, StatusFiring},
+		{time.Second, false, ActionRecover, "", StatusResolved},
+		{time.Second, true, ActionEmit, "", StatusFiring},
+	})
+
+	if decisions[0].IsDedup || !decisions[2].IsDedup || decisions[5].IsDedup {
+		t.Errorf("Only repeated notifications should be marked as dedup")
+	}
+}
+
+func TestMinDurationAndDedup(t *testing.T) {
+	rules := Rules{MinDuration: time.Minute, Dedup: 5 * time.Minute}
+
+	runSteps(t, rules, []step{
+		{0, true, ActionSuppress, ReasonMinDuration, StatusPending},
+		{time.Minute, true, ActionEmit, "", StatusFiring},
+		{time.Minute, true, ActionSuppress, ReasonDedup, StatusFiring},
+		{5 * time.Minute, true, ActionEmit, "", StatusFiring},
+		{time.Second, false, ActionRecover, "", StatusResolved},
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	rules := Rules{Dedup: 5 * time.Minute, TTL: 10 * time.Minute}
+
+	runSteps(t, rules, []step{
+		{0, true, ActionEmit, "", StatusFiring},
+
+		// The state is forgotten, so this is a new failure
+		{20 * time.Minute, true, ActionEmit, "", StatusFiring},
+	})
+}
+
+// Test concurrent results of the same test are notified only once
+func TestConcurrentUpdates(t *testing.T) {
+	s := NewMemoryStore()
+	rules := Rules{Dedup: time.Hour}
+	now := time.Now()
+
+	var mutex sync.Mutex
+	notified := 0
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, _ := s.Update("test", true, rules, now)
+			if decision.Notify() {
+				mutex.Lock()
+				notified++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if notified != 1 {
+		t.Errorf("Expected a single notification, got %d", notified)
+	}
+	if state := s.Get("test"); state.Status != StatusFiring || state.Failures != 10 {
+		t.Errorf("Unexpected state %+v", state)
+	}
+}
+
+func TestFlapping(t *testing.T) {
+	s := NewMemoryStore()
+	rules := Rules{FlapWindow: 5, FlapHigh: 0.5, FlapLow: 0.25}
+	now := time.Now()
+
+	update := func(failed bool) Decision {
+		now = now.Add(time.Minute)
+		decision, err := s.Update("test", failed, rules, now)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		return decision
+	}
+
+	// Alternating results, but not enough of them to trust the rate
+	for i, failed := range []bool{true, false, true, false} {
+		if d := update(failed); d.Flapping != "" || !d.Notify() {
+			t.Fatalf("Result %d: unexpected decision %+v", i, d)
+		}
+	}
+
+	d := update(true)
+	if d.Flapping != FlappingStarted || !d.Notify() || d.ChangeRate != 1 {
+		t.Fatalf("Expected flapping to start, got %+v", d)
+	}
+
+	// Nothing is notified while flapping
+	for i, failed := range []bool{false, true, true} {
+		if d = update(failed); d.Notify() || d.Reason != ReasonFlapping {
+			t.Fatalf("Result %d: expected to be suppressed, got %+v", i, d)
+		}
+	}
+
+	// Only one change in the last 5 results
+	update(true)
+	if d = update(true); d.Flapping != FlappingStopped || !d.Notify() {
+		t.Fatalf("Expected flapping to stop, got %+v", d)
+	}
+	if state := s.Get("test"); state.Flapping || len(state.History) != 5 {
+		t.Errorf("Unexpected state %+v", state)
+	}
+
+	// Back to the usual rules
+	if d = update(false); d.Action != ActionRecover {
+		t.Errorf("Expected a recovery, got %+v", d)
+	}
+}
+
+// Test a label is failing as long as any of its tests is
+func TestDependencies(t *testing.T) {
+	d := NewMemoryDependencies(time.Hour)
+	now := time.Unix(1000000, 0)
+
+	failing := func() bool {
+		f, err := d.Failing("router", now)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		return f
+	}
+
+	if failing() {
+		t.Errorf("Unknown labels must not be failing")
+	}
+
+	d.Record("router", "v4", true, now)
+	d.Record("router", "v6", true, now)
+	d.Record("router", "v4", false, now)
+	if !failing() {
+		t.Errorf("Expected the label to be failing")
+	}
+
+	d.Record("router", "v6", false, now)
+	if failing() {
+		t.Errorf("Expected the label to have recovered")
+	}
+
+	// Failures are forgotten if the tests stop running
+	d.Record("router", "v4", true, now)
+	now = now.Add(time.Hour)
+	if failing() {
+		t.Errorf("Expected the failure to be forgotten")
+	}
+}
+
+func TestParseQuorum(t *testing.T) {
+	q, err := ParseQuorum("2/3")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if q.Needed != 2 || q.Of != 3 || q.String() != "2/3" {
+		t.Errorf("Unexpected quorum %+v", q)
+	}
+
+	for _, invalid := range []string{"", "2", "a/3", "0/3", "4/3", "2/3/4"} {
+		if _, err := ParseQuorum(invalid); err == nil {
+			t.Errorf("Expected an error parsing '%s'", invalid)
+		}
+	}
+}
+
+// Test failures are only decided once enough locations agree
+func TestConsensus(t *testing.T) {
+	c := NewMemoryConsensus()
+	quorum := Quorum{Needed: 2, Of: 3}
+	now := time.Unix(1000000, 0)
+
+	vote := func(location string, failed bool) []Vote {
+		votes, err := c.Vote("test", Vote{Location: location, Failed: failed, Time: now.Unix()}, quorum, time.Minute, now)
+		if err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		return votes
+	}
+
+	// A single failure is not enough, even if repeated
+	if votes := vote("eu", true); votes != nil {
+		t.Errorf("Expected no decision, got %+v", votes)
+	}
+	if votes := vote("eu", true); votes != nil {
+		t.Errorf("Expected no decision, got %+v", votes)
+	}
+
+	votes := vote("us", true)
+	if len(votes) != 2 || votes[0].Location != "eu" || votes[1].Location != "us" {
+		t.Fatalf("Expected the failures of eu and us, got %+v", votes)
+	}
+
+	// A new round has started: two passes make the failure quorum
+	// unreachable
+	vote("ap", true)
+	if votes := vote("eu", false); votes != nil {
+		t.Errorf("Expected no decision, got %+v", votes)
+	}
+	votes = vote("us", false)
+	if decided, failed := quorum.Decide(votes); !decided || failed || len(votes) != 3 {
+		t.Errorf("Expected a pass, got %+v", votes)
+	}
+
+	// Old votes are forgotten
+	vote("eu", true)
+	now = now.Add(time.Minute)
+	if votes := vote("us", true); votes != nil {
+		t.Errorf("Expected the old vote to be forgotten, got %+v", votes)
+	}
+}
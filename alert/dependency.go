@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Dependencies keeps track of which labelled tests are currently failing,
+// so that the failures of the tests depending on them can be suppressed.
+//
+// A label can be shared by many tests, e.g. a hostname resolving to many
+// addresses, in which case the label is failing if any of them is.
+type Dependencies interface {
+	// Record stores the latest result of the test with the given label
+	// and hash.
+	Record(label string, hash string, failed bool, now time.Time) error
+
+	// Failing returns true if any test with the given label is failing.
+	Failing(label string, now time.Time) (bool, error)
+}
+
+// The prefix of the keys holding the failing tests of each label
+const redisDependencyPrefix = "overseer.label-state."
+
+// RedisDependencies keeps the failing tests in redis, in a hash per label,
+// so that they are shared by all the workers.
+//
+// The failures of a label are forgotten if none of its tests runs for ttl.
+type RedisDependencies struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisDependencies creates a store using the given client.
+func NewRedisDependencies(client *redis.Client, ttl time.Duration) *RedisDependencies {
+	return &RedisDependencies{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (d *RedisDependencies) Record(label string, hash string, failed bool, _ time.Time) error {
+	key := redisDependencyPrefix + label
+
+	_, err := d.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		if failed {
+			pipe.HSet(key, hash, 1)
+		} else {
+			pipe.HDel(key, hash)
+		}
+		pipe.Expire(key, d.ttl)
+		return nil
+	})
+	return err
+}
+
+func (d *RedisDependencies) Failing(label string, _ time.Time) (bool, error) {
+	failing, err := d.client.HLen(redisDependencyPrefix + label).Result()
+	return failing > 0, err
+}
+
+// MemoryDependencies keeps the failing tests within the current process.
+type MemoryDependencies struct {
+	ttl time.Duration
+
+	mutex sync.Mutex
+
+	// The failing tests of each label, and when the label was last seen
+	failing map[string]map[string]bool
+	seen    map[string]time.Time
+}
+
+// NewMemoryDependencies creates a new, empty, in-memory store.
+func NewMemoryDependencies(ttl time.Duration) *MemoryDependencies {
+	return &MemoryDependencies{
+		ttl:     ttl,
+		failing: make(map[string]map[string]bool),
+		seen:    make(map[string]time.Time),
+	}
+}
+
+func (d *MemoryDependencies) Record(label string, hash string, failed bool, now time.Time) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.expire(label, now)
+
+	if failed {
+		if d.failing[label] == nil {
+			d.failing[label] = make(map[string]bool)
+		}
+		d.failing[label][hash] = true
+	} else {
+		delete(d.failing[label], hash)
+	}
+	d.seen[label] = now
+	return nil
+}
+
+func (d *MemoryDependencies) Failing(label string, now time.Time) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.expire(label, now)
+	return len(d.failing[label]) > 0, nil
+}
+
+// expire forgets the failures of the label, if none of its tests ran
+// recently enough.
+func (d *MemoryDependencies) expire(label string, now time.Time) {
+	if seen, ok := d.seen[label]; ok && d.ttl > 0 && now.Sub(seen) >= d.ttl {
+		delete(d.failing, label)
+		delete(d.seen, label)
+	}
+}
@@ -0,0 +1,61 @@
+package alert
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryEntry is a state, and when it expires.
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// MemoryStore keeps the states within the current process.
+type MemoryStore struct {
+	mutex  sync.Mutex
+	states map[string]memoryEntry
+}
+
+// NewMemoryStore creates a new, empty, in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]memoryEntry),
+	}
+}
+
+func (s *MemoryStore) Update(hash string, failed bool, rules Rules, now time.Time) (Decision, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var state State
+	if entry, ok := s.states[hash]; ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		state = entry.state
+	}
+
+	state, decision := Transition(state, failed, rules, now)
+
+	if state.IsZero() {
+		delete(s.states, hash)
+	} else {
+		entry := memoryEntry{state: state}
+		if rules.TTL > 0 {
+			entry.expires = now.Add(rules.TTL)
+		}
+		s.states[hash] = entry
+	}
+
+	return decision, nil
+}
+
+// Get returns the current state of the test with the given hash.
+func (s *MemoryStore) Get(hash string) State {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.states[hash]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return State{Status: StatusOK}
+	}
+	return entry.state
+}
@@ -0,0 +1,209 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Quorum is how many of the locations running a test must agree that it
+// failed, before the failure is notified, e.g. 2 out of 3.
+//
+// The votes of the locations are collected for a short window: as soon as
+// enough of them failed, or enough of them passed that the failure quorum
+// cannot be reached anymore, a decision is taken, and a new round starts.
+type Quorum struct {
+	// How many locations must fail
+	Needed int
+
+	// Out of how many locations
+	Of int
+}
+
+// ParseQuorum parses a quorum, e.g. "2/3".
+func ParseQuorum(value string) (Quorum, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return Quorum{}, fmt.Errorf("invalid quorum '%s', expected e.g. 2/3", value)
+	}
+
+	needed, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Quorum{}, fmt.Errorf("invalid quorum '%s', expected e.g. 2/3", value)
+	}
+	of, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return Quorum{}, fmt.Errorf("invalid quorum '%s', expected e.g. 2/3", value)
+	}
+
+	if needed < 1 || needed > of {
+		return Quorum{}, fmt.Errorf("invalid quorum '%s', must be between 1/%d and %d/%d", value, of, of, of)
+	}
+
+	return Quorum{Needed: needed, Of: of}, nil
+}
+
+func (q Quorum) String() string {
+	return fmt.Sprintf("%d/%d", q.Needed, q.Of)
+}
+
+// Vote is the outcome of a test run from a location.
+type Vote struct {
+	Location string `json:"location"`
+	Failed   bool   `json:"failed"`
+	Error    string `json:"error,omitempty"`
+	Time     int64  `json:"time"`
+}
+
+// Decide returns whether the given votes reach a decision, and if so
+// whether the test failed.
+func (q Quorum) Decide(votes []Vote) (decided bool, failed bool) {
+	var failures, passes int
+	for _, vote := range votes {
+		if vote.Failed {
+			failures++
+		} else {
+			passes++
+		}
+	}
+
+	if failures >= q.Needed {
+		return true, true
+	}
+	if passes > q.Of-q.Needed {
+		return true, false
+	}
+	return false, false
+}
+
+// Consensus collects the votes of the locations running the same test.
+type Consensus interface {
+	// Vote records the vote of a location for the test with the given
+	// hash, replacing its previous vote in the current round, if any.
+	//
+	// Once the votes reach a decision, they are returned, sorted by
+	// location, and a new round starts.  Otherwise nil is returned.
+	Vote(hash string, vote Vote, quorum Quorum, window time.Duration, now time.Time) ([]Vote, error)
+}
+
+// castVote adds the vote to those of the current round, forgetting the
+// ones older than the window, and returns the votes, if they reach a
+// decision, and the remaining ones of the round otherwise.
+func castVote(round map[string]Vote, vote Vote, quorum Quorum, window time.Duration, now time.Time) (decided []Vote, remaining map[string]Vote) {
+	remaining = make(map[string]Vote)
+	for location, v := range round {
+		if window > 0 && now.Sub(time.Unix(v.Time, 0)) >= window {
+			continue
+		}
+		remaining[location] = v
+	}
+	remaining[vote.Location] = vote
+
+	var votes []Vote
+	for _, v := range remaining {
+		votes = append(votes, v)
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return votes[i].Location < votes[j].Location
+	})
+
+	if ok, _ := quorum.Decide(votes); ok {
+		return votes, nil
+	}
+	return nil, remaining
+}
+
+// The prefix of the keys holding the votes of the current round of each
+// test
+const redisQuorumPrefix = "overseer.quorum."
+
+// RedisConsensus keeps the votes in redis, in a hash per test, so that
+// they are shared by all the workers.
+type RedisConsensus struct {
+	client *redis.Client
+}
+
+// NewRedisConsensus creates a consensus using the given client.
+func NewRedisConsensus(client *redis.Client) *RedisConsensus {
+	return &RedisConsensus{
+		client: client,
+	}
+}
+
+func (c *RedisConsensus) Vote(hash string, vote Vote, quorum Quorum, window time.Duration, now time.Time) ([]Vote, error) {
+	key := redisQuorumPrefix + hash
+
+	var decided []Vote
+	update := func(tx *redis.Tx) error {
+		values, err := tx.HGetAll(key).Result()
+		if err != nil {
+			return err
+		}
+
+		round := make(map[string]Vote)
+		for location, value := range values {
+			var v Vote
+			if err = json.Unmarshal([]byte(value), &v); err != nil {
+				return fmt.Errorf("invalid vote %s of %s: %s", location, key, err.Error())
+			}
+			round[location] = v
+		}
+
+		var remaining map[string]Vote
+		decided, remaining = castVote(round, vote, quorum, window, now)
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.Del(key)
+			for location, v := range remaining {
+				data, _ := json.Marshal(v)
+				pipe.HSet(key, location, data)
+			}
+			if len(remaining) > 0 && window > 0 {
+				pipe.Expire(key, window)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < redisMaxAttempts; i++ {
+		err := c.client.Watch(update, key)
+		if err != redis.TxFailedErr {
+			return decided, err
+		}
+	}
+
+	return nil, fmt.Errorf("too many concurrent votes for %s", key)
+}
+
+// MemoryConsensus keeps the votes within the current process.
+type MemoryConsensus struct {
+	mutex  sync.Mutex
+	rounds map[string]map[string]Vote
+}
+
+// NewMemoryConsensus creates a new, empty, in-memory consensus.
+func NewMemoryConsensus() *MemoryConsensus {
+	return &MemoryConsensus{
+		rounds: make(map[string]map[string]Vote),
+	}
+}
+
+func (c *MemoryConsensus) Vote(hash string, vote Vote, quorum Quorum, window time.Duration, now time.Time) ([]Vote, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	decided, remaining := castVote(c.rounds[hash], vote, quorum, window, now)
+	if len(remaining) > 0 {
+		c.rounds[hash] = remaining
+	} else {
+		delete(c.rounds, hash)
+	}
+	return decided, nil
+}
@@ -0,0 +1,78 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// The prefix of the keys holding the state of each test
+const redisKeyPrefix = "overseer.alert-state."
+
+// How many times an update is attempted, when other workers keep updating
+// the same state
+const redisMaxAttempts = 10
+
+// RedisStore keeps the states in redis, so that they are shared by all the
+// workers.
+//
+// Every update is an optimistic transaction: if the state is changed by
+// another worker in the meantime, the update is applied again to the new
+// state.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store using the given client.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+func (s *RedisStore) Update(hash string, failed bool, rules Rules, now time.Time) (Decision, error) {
+	key := redisKeyPrefix + hash
+
+	var decision Decision
+	update := func(tx *redis.Tx) error {
+		var state State
+
+		data, err := tx.Get(key).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil {
+			if err = json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("invalid alert state %s: %s", key, err.Error())
+			}
+		}
+
+		state, decision = Transition(state, failed, rules, now)
+
+		data, err = json.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Pipelined(func(pipe redis.Pipeliner) error {
+			if state.IsZero() {
+				pipe.Del(key)
+			} else {
+				pipe.Set(key, data, rules.TTL)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < redisMaxAttempts; i++ {
+		err := s.client.Watch(update, key)
+		if err != redis.TxFailedErr {
+			return decision, err
+		}
+	}
+
+	return decision, fmt.Errorf("too many concurrent updates of %s", key)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,3 +49,35 @@ func TestEmailTemplate(t *testing.T) {
 
 	t.Logf("email body:\n%s", buf.String())
 }
+
+func TestEmailTemplateFlapping(t *testing.T) {
+
+	errString := "an error!"
+
+	templateMap := getTemplateMapFromTestResult(&test.Result{
+		Input:    "asasd",
+		Target:   "1234",
+		Time:     time.Now().Unix(),
+		Type:     "my-type",
+		Error:    &errString,
+		Flapping: "started",
+	})
+
+	buf := &bytes.Buffer{}
+	err := TemplateSubject.Execute(buf, templateMap)
+	if err != nil {
+		t.Fatalf("failed to execute subject template: %+v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "Overseer [FLAPPING]") {
+		t.Errorf("unexpected email subject: %s", buf.String())
+	}
+
+	buf = &bytes.Buffer{}
+	err = TemplateBody.Execute(buf, templateMap)
+	if err != nil {
+		t.Fatalf("failed to execute body template: %+v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "Overseer: Test started flapping, last error: an error!") {
+		t.Errorf("unexpected email body:\n%s", buf.String())
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/cmaster11/overseer/queue"
 	"github.com/cmaster11/overseer/test"
 	"github.com/cmaster11/overseer/utils"
 
@@ -34,7 +35,11 @@ import (
 // subject to the user.
 var TemplateSubject = template.Must(template.New("tmpl").Parse(strings.TrimSpace(`
 Overseer [
-{{- if .error -}}
+{{- if eq .flapping "started" -}}
+	FLAPPING
+{{- else if eq .flapping "stopped" -}}
+	FLAPPING-STOPPED
+{{- else if .error -}}
 	ERR
 	{{- if .isDedup -}}
 	-DUP
@@ -55,7 +60,11 @@ Overseer [
 // notification to the user.
 var TemplateBody = template.Must(template.New("tmpl").Parse(strings.TrimSpace(`
 Overseer: 
-{{- if .error }} Error
+{{- if eq .flapping "started" }} Test started flapping
+{{- if .error}}, last error: {{.error}}{{end -}}
+{{- else if eq .flapping "stopped" }} Test stopped flapping
+{{- if .error}}, last error: {{.error}}{{end -}}
+{{- else if .error }} Error
 {{- if .isDedup}} (duplicated){{end -}}
 : {{.error}}
 {{- else -}}
@@ -102,6 +111,7 @@ func getTemplateMapFromTestResult(testResult *test.Result) map[string]interface{
 		"error":              testResult.Error,
 		"isDedup":            testResult.IsDedup,
 		"recovered":          testResult.Recovered,
+		"flapping":           testResult.Flapping,
 		"tag":                testResult.Tag,
 		"target":             testResult.Target,
 		"input":              testResult.Input,
@@ -120,7 +130,14 @@ func getTemplateMapFromTestResult(testResult *test.Result) map[string]interface{
 func (bridge *EmailBridge) Process(msg []byte) {
 	testResult, err := test.ResultFromJSON(msg)
 	if err != nil {
-		panic(err)
+		fmt.Printf("Failed to decode test result, skipping it: %s\n", err.Error())
+		return
+	}
+
+	// Silenced results are muted on purpose, and the failures depending on
+	// a failing test are already notified by that test
+	if testResult.Silenced || testResult.SuppressedBy != "" {
+		return
 	}
 
 	// If the test passed then we don't care, unless otherwise defined
@@ -135,6 +152,11 @@ func (bridge *EmailBridge) Process(msg []byte) {
 		if bridge.SendTestRecovered && testResult.Recovered {
 			shouldSend = true
 		}
+
+		// The start, and end, of flapping are always worth knowing
+		if testResult.Flapping != "" {
+			shouldSend = true
+		}
 	}
 
 	if !shouldSend {
@@ -192,6 +214,7 @@ func main() {
 	//
 	redisHost := flag.String("redis-host", "127.0.0.1:6379", "Specify the address of the redis queue.")
 	redisPass := flag.String("redis-pass", "", "Specify the password of the redis queue.")
+	consumerFlags := queue.RegisterConsumerFlags(flag.CommandLine, "email-bridge")
 	redisQueueKey := flag.String("redis-queue-key", "overseer.results", "Specify the redis queue key to use.")
 
 	smtpHost := flag.String("smtp-host", "smtp.gmail.com", "The SMTP host")
@@ -250,22 +273,11 @@ func main() {
 		SendTestSuccess:   *sendTestSuccess,
 	}
 
-	for {
-
-		//
-		// Get test-results
-		//
-		msg, _ := r.BLPop(0, *redisQueueKey).Result()
-
-		//
-		// If they were non-empty, process them.
-		//
-		//   msg[0] will be "overseer.results"
-		//
-		//   msg[1] will be the value removed from the list.
-		//
-		if len(msg) >= 1 {
-			bridge.Process([]byte(msg[1]))
-		}
+	consumer, err := consumerFlags.NewConsumer(r, *redisQueueKey)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(1)
 	}
+
+	queue.Consume(consumer, bridge.Process, nil)
 }
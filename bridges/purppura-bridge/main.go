@@ -32,6 +32,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cmaster11/overseer/queue"
 	"github.com/cmaster11/overseer/test"
 
 	"github.com/go-redis/redis"
@@ -64,7 +65,16 @@ func process(msg []byte) {
 
 	testResult, err := test.ResultFromJSON(msg)
 	if err != nil {
-		panic(err)
+		fmt.Printf("Failed to decode test result, skipping it: %s\n", err.Error())
+		return
+	}
+
+	//
+	// Silenced results, and failures depending on a failing test, neither
+	// raise, nor clear, alerts.
+	//
+	if testResult.Silenced || testResult.SuppressedBy != "" {
+		return
 	}
 
 	//
@@ -275,6 +285,7 @@ func main() {
 	//
 	redisHost := flag.String("redis-host", "127.0.0.1:6379", "Specify the address of the redis queue.")
 	redisPass := flag.String("redis-pass", "", "Specify the password of the redis queue.")
+	consumerFlags := queue.RegisterConsumerFlags(flag.CommandLine, "purppura-bridge")
 	pURL = flag.String("purppura", "", "The purppura-server URL")
 	verbose = flag.Bool("verbose", false, "Be verbose?")
 	flag.Parse()
@@ -313,23 +324,11 @@ func main() {
 	c.AddFunc("@every 5m", func() { CheckUpdates() })
 	c.Start()
 
-	for {
-
-		//
-		// Get test-results
-		//
-		msg, _ := r.BLPop(0, "overseer.results").Result()
-
-		//
-		// If they were non-empty, process them.
-		//
-		//   msg[0] will be "overseer.results"
-		//
-		//   msg[1] will be the value removed from the list.
-		//
-		if len(msg) >= 1 {
-			process([]byte(msg[1]))
-		}
-
+	consumer, err := consumerFlags.NewConsumer(r, queue.ResultsKey)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(1)
 	}
+
+	queue.Consume(consumer, process, nil)
 }
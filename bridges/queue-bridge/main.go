@@ -20,6 +20,7 @@
 // - error:		error=(ssl|SSL)
 // - isDedup:	isDedup=true/isDedup=false
 // - recovered:	recovered=true/recovered=false
+// - silenced:	silenced=true/silenced=false
 //
 // When a test is provided on the source queue, it gets cloned into the destination queues.
 // This helps using multiple bridges, e.g. to send an queue and a webhook for each test result.
@@ -40,6 +41,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/cmaster11/overseer/queue"
 	"github.com/cmaster11/overseer/test"
 	"github.com/go-redis/redis"
 )
@@ -58,7 +60,8 @@ type QueueBridge struct {
 func (bridge *QueueBridge) Process(msg []byte) {
 	testResult, err := test.ResultFromJSON(msg)
 	if err != nil {
-		panic(err)
+		fmt.Printf("Failed to decode test result, skipping it: %s\n", err.Error())
+		return
 	}
 
 	fmt.Printf("Processing result: %+v\n", testResult)
@@ -68,7 +71,7 @@ func (bridge *QueueBridge) Process(msg []byte) {
 			continue
 		}
 
-		_, err = bridge.R.RPush(queue.QueueKey, msg).Result()
+		err = queue.publisher.Publish(string(msg))
 		if err != nil {
 			fmt.Printf("Result clone failed for queue [%s]: %s\n", queue.QueueKey, err)
 		}
@@ -85,6 +88,7 @@ func main() {
 	//
 	redisHost := flag.String("redis-host", "127.0.0.1:6379", "Specify the address of the redis queue.")
 	redisPass := flag.String("redis-pass", "", "Specify the password of the redis queue.")
+	consumerFlags := queue.RegisterConsumerFlags(flag.CommandLine, "queue-bridge")
 	redisQueueKey := flag.String("redis-queue-key", "overseer.results", "Specify the redis queue key to use as source.")
 
 	var queuesArray stringsFlag
@@ -127,27 +131,33 @@ func main() {
 		os.Exit(1)
 	}
 
+	//
+	// Results are cloned using the same transport they are read with.
+	//
+	backend, err := consumerFlags.NewBackend(r)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, dest := range queues {
+		dest.publisher, err = backend.Results(dest.QueueKey)
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
 	bridge := QueueBridge{
 		R:      r,
 		Queues: queues,
 	}
 
-	for {
-
-		//
-		// Get test-results
-		//
-		msg, _ := r.BLPop(0, *redisQueueKey).Result()
-
-		//
-		// If they were non-empty, process them.
-		//
-		//   msg[0] will be "overseer.results"
-		//
-		//   msg[1] will be the value removed from the list.
-		//
-		if len(msg) >= 1 {
-			bridge.Process([]byte(msg[1]))
-		}
+	consumer, err := consumerFlags.NewConsumer(r, *redisQueueKey)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(1)
 	}
+
+	queue.Consume(consumer, bridge.Process, nil)
 }
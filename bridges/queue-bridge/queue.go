@@ -4,13 +4,18 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/cmaster11/overseer/filter"
+	"github.com/cmaster11/overseer/queue"
 )
 
 var regexDestinationQueue = regexp.MustCompile(`^([\w.-]+)(?:\[(.+)])?$`)
 
 type destinationQueue struct {
 	QueueKey string
-	Filter   *resultFilter
+	Filter   *filter.Filter
+
+	publisher queue.ResultSink
 }
 
 func newDestinationQueuesFromStringArray(queuesStringArray []string) ([]*destinationQueue, error) {
@@ -44,12 +49,12 @@ func newDestinationQueueFromString(value string) (*destinationQueue, error) {
 			return queue, nil
 		}
 
-		filter, err := newResultFilterFromQuery(filtersString)
+		resultFilter, err := filter.NewFromQuery(filtersString)
 		if err != nil {
 			return nil, fmt.Errorf("invalid queue filter: %s, %s", filtersString, err)
 		}
 
-		queue.Filter = filter
+		queue.Filter = resultFilter
 	}
 
 	return queue, nil
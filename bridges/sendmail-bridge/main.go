@@ -24,6 +24,7 @@ import (
 	"os/exec"
 	"text/template"
 
+	"github.com/cmaster11/overseer/queue"
 	"github.com/cmaster11/overseer/test"
 
 	"github.com/go-redis/redis"
@@ -62,13 +63,15 @@ type EmailBridge struct {
 func (bridge *EmailBridge) Process(msg []byte) {
 	testResult, err := test.ResultFromJSON(msg)
 	if err != nil {
-		panic(err)
+		fmt.Printf("Failed to decode test result, skipping it: %s\n", err.Error())
+		return
 	}
 
 	//
-	// If the test passed then we don't care.
+	// If the test passed, is silenced, or depends on a failing test,
+	// then we don't care.
 	//
-	if testResult.Error == nil {
+	if testResult.Error == nil || testResult.Silenced || testResult.SuppressedBy != "" {
 		return
 	}
 
@@ -163,6 +166,7 @@ func main() {
 	//
 	redisHost := flag.String("redis-host", "127.0.0.1:6379", "Specify the address of the redis queue.")
 	redisPass := flag.String("redis-pass", "", "Specify the password of the redis queue.")
+	consumerFlags := queue.RegisterConsumerFlags(flag.CommandLine, "sendmail-bridge")
 	var email = flag.String("email", "", "The email address to notify")
 	flag.Parse()
 
@@ -196,22 +200,11 @@ func main() {
 		Email: *email,
 	}
 
-	for {
-
-		//
-		// Get test-results
-		//
-		msg, _ := r.BLPop(0, "overseer.results").Result()
-
-		//
-		// If they were non-empty, process them.
-		//
-		//   msg[0] will be "overseer.results"
-		//
-		//   msg[1] will be the value removed from the list.
-		//
-		if len(msg) >= 1 {
-			bridge.Process([]byte(msg[1]))
-		}
+	consumer, err := consumerFlags.NewConsumer(r, queue.ResultsKey)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		os.Exit(1)
 	}
+
+	queue.Consume(consumer, bridge.Process, nil)
 }
@@ -25,7 +25,9 @@ func (*dumpCmd) Usage() string {
 	return `dump :
   Dump a parsed configuration file.
 
-  This is particularly useful to show the result of macro-expansion.
+  Included files are dumped too, and directories can be given in place of
+  files.  Tests are shown with their variables expanded, and their
+  passwords censored.  This is particularly useful to show the result of macro-expansion.
 `
 }
 
@@ -40,7 +42,7 @@ func (p *dumpCmd) SetFlags(f *flag.FlagSet) {
 // has been successfully parsed.
 //
 func dumpTest(tst test.Test) error {
-	fmt.Printf("%s\n", tst.Input)
+	fmt.Printf("%s\n", tst.Redacted())
 	return nil
 }
 
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/queue"
 	"github.com/cmaster11/overseer/test"
 	"github.com/go-redis/redis"
 	"github.com/google/subcommands"
@@ -24,7 +25,9 @@ type enqueueCmd struct {
 	RedisPassword    string
 	RedisSocket      string
 	RedisDialTimeout time.Duration
+	Transport        string
 	_r               *redis.Client
+	_jobs            queue.JobQueue
 }
 
 //
@@ -55,6 +58,7 @@ func (p *enqueueCmd) SetFlags(f *flag.FlagSet) {
 	defaults.RedisDB = 0
 	defaults.RedisSocket = ""
 	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Transport = queue.TransportList
 
 	//
 	// If we have a configuration file then load it
@@ -77,6 +81,7 @@ func (p *enqueueCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
 	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
 	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.StringVar(&p.Transport, "transport", defaults.Transport, "How jobs are added to the queue: list, or stream.")
 }
 
 //
@@ -84,8 +89,25 @@ func (p *enqueueCmd) SetFlags(f *flag.FlagSet) {
 // has been successfully parsed.
 //
 func (p *enqueueCmd) enqueueTest(tst test.Test) error {
-	_, err := p._r.RPush("overseer.jobs", tst.Input).Result()
-	return err
+	return pushTest(p._jobs, tst)
+}
+
+//
+// pushTest adds the job of a test to the queue of its priority, either the
+// shared one or, if it has to run from specific locations, the queue of
+// each of them.
+//
+func pushTest(jobs queue.JobQueue, tst test.Test) error {
+	if len(tst.RunFrom) == 0 {
+		return jobs.Push(tst.Input, tst.Priority, "")
+	}
+
+	for _, location := range tst.RunFrom {
+		if err := jobs.Push(tst.Input, tst.Priority, location); err != nil {
+			return fmt.Errorf("failed to push to location %s: %s", location, err.Error())
+		}
+	}
+	return nil
 }
 
 //
@@ -122,6 +144,19 @@ func (p *enqueueCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{
 		return subcommands.ExitFailure
 	}
 
+	backend, err := queue.NewRedisBackend(p._r, queue.RedisOptions{Transport: p.Transport})
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	defer backend.Close()
+
+	p._jobs, err = backend.Jobs("")
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
 	//
 	// For each file on the command-line we can now parse and
 	// enqueue the jobs
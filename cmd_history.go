@@ -0,0 +1,202 @@
+// History
+//
+// The history sub-command shows the recent results of a test, as kept by
+// the workers started with -history.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/history"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+type historyCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+	Limit            int
+	_r               *redis.Client
+}
+
+//
+// Glue
+//
+func (*historyCmd) Name() string     { return "history" }
+func (*historyCmd) Synopsis() string { return "Show the recent results of a test" }
+func (*historyCmd) Usage() string {
+	return `history [flags] <test-label|input> :
+  Show the recent results of the tests with the given label, or input,
+  and when they changed status.
+
+  The workers must be started with -history, to keep the results.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *historyCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults historyCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Limit = 50
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.IntVar(&p.Limit, "limit", defaults.Limit, "How many of the most recent results to show.")
+}
+
+// formatTime formats a unix time for the timeline.
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).Format("2006-01-02 15:04:05")
+}
+
+//
+// show prints the timeline of the given test.
+//
+func (p *historyCmd) show(store *history.RedisStore, t history.Test) error {
+	entries, err := store.Entries(t.Hash, p.Limit)
+	if err != nil {
+		return err
+	}
+
+	title := t.Input
+	if t.TestLabel != "" {
+		title = t.TestLabel + ": " + title
+	}
+	if t.Location != "" {
+		title += " from " + t.Location
+	}
+	fmt.Printf("%s (%s)\n", title, t.Target)
+	if len(entries) == 0 {
+		fmt.Printf("  No results\n\n")
+		return nil
+	}
+
+	status := entries[len(entries)-1].Status
+	since, before := history.Since(entries)
+	prefix := ""
+	if before {
+		prefix = "at least "
+	}
+	fmt.Printf("  Status: %s %ssince %s\n", strings.ToUpper(status), prefix, formatTime(since))
+	fmt.Printf("  Failed %d times in the last %d results\n\n", history.Failures(entries), len(entries))
+
+	for _, entry := range entries {
+		fmt.Printf("  %s  %-4s  %8.0fms  %s\n", formatTime(entry.Time), strings.ToUpper(entry.Status), entry.DurationMs, entry.Error)
+	}
+
+	changes := history.Changes(entries)
+	if len(changes) > 0 {
+		fmt.Printf("\n  State changes:\n")
+		for _, change := range changes {
+			fmt.Printf("  %s  %s -> %s\n", formatTime(change.Time), strings.ToUpper(change.From), strings.ToUpper(change.To))
+		}
+	}
+	fmt.Printf("\n")
+	return nil
+}
+
+//
+// Entry-point.
+//
+func (p *historyCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Printf("Expected the label, or input, of a test\n")
+		return subcommands.ExitUsageError
+	}
+	if p.Limit <= 0 {
+		fmt.Printf("limit must be > 0\n")
+		return subcommands.ExitUsageError
+	}
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	//
+	// And run a ping, just to make sure it worked.
+	//
+	_, err := p._r.Ping().Result()
+	if err != nil {
+		fmt.Printf("Redis connection failed: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	// The size and retention only matter to the workers
+	store := history.NewRedisStore(p._r, 0, 0)
+
+	tests, err := store.Find(f.Arg(0))
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if len(tests) == 0 {
+		fmt.Printf("No history found for '%s'\n", f.Arg(0))
+		return subcommands.ExitFailure
+	}
+
+	for _, t := range tests {
+		if err = p.show(store, t); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+	return subcommands.ExitSuccess
+}
@@ -7,19 +7,25 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cmaster11/k8s-event-watcher"
+	"github.com/cmaster11/overseer/queue"
 	"github.com/cmaster11/overseer/test"
 	"github.com/go-redis/redis"
 	"github.com/google/subcommands"
 	"gopkg.in/yaml.v2"
 	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 // This is our structure, largely populated by command-line arguments
@@ -51,14 +57,23 @@ type k8sEventWatcherCmd struct {
 	// Redis connection timeout
 	RedisDialTimeout time.Duration
 
+	// How jobs and results are exchanged via redis (list or stream)
+	Transport string
+
 	// Tag applied to all results
 	Tag string
 
 	// Should the watcher be verbose?
 	Verbose bool
 
+	// The address of the HTTP server exposing health, if any
+	HTTPAddress string
+
 	// The handle to our redis-server
 	_r *redis.Client
+
+	// Where results are published
+	_results queue.ResultSink
 }
 
 //
@@ -99,8 +114,10 @@ func (p *k8sEventWatcherCmd) SetFlags(f *flag.FlagSet) {
 	defaults.RedisDB = 0
 	defaults.RedisPassword = ""
 	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Transport = queue.TransportList
 	defaults.KubeConfigPath = ""
 	defaults.EventFilterConfigPath = ""
+	defaults.HTTPAddress = ""
 
 	//
 	// If we have a configuration file then load it
@@ -140,9 +157,13 @@ func (p *k8sEventWatcherCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
 	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
 	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.StringVar(&p.Transport, "transport", defaults.Transport, "How jobs and results are exchanged via redis: list, or stream.")
 
 	// Tag
 	f.StringVar(&p.Tag, "tag", defaults.Tag, "Specify the tag to add to all events.")
+
+	// HTTP
+	f.StringVar(&p.HTTPAddress, "http-address", defaults.HTTPAddress, "If set, the address of the HTTP server exposing /healthz and /readyz (e.g. :9090).")
 }
 
 // notify is used to store the result of a test in our redis queue.
@@ -232,13 +253,42 @@ Event data:
 	//
 	// Publish the message to the queue.
 	//
-	_, err = p._r.RPush("overseer.results", j).Result()
+	err = p._results.Publish(string(j))
 	if err != nil {
 		fmt.Printf("Result addition failed: %s\n", err)
 		return
 	}
 }
 
+//
+// kubernetesHealth returns a check which fails if the Kubernetes API server
+// the events are watched from is not reachable.
+//
+func (p *k8sEventWatcherCmd) kubernetesHealth() (func() error, error) {
+	var config *rest.Config
+	var err error
+
+	if p.KubeConfigPath != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", p.KubeConfigPath)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = 5 * time.Second
+
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		_, err := clientSet.Discovery().ServerVersion()
+		return err
+	}, nil
+}
+
 //
 // Entry-point.
 //
@@ -278,6 +328,19 @@ func (p *k8sEventWatcherCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...in
 		return subcommands.ExitFailure
 	}
 
+	backend, err := queue.NewRedisBackend(p._r, queue.RedisOptions{Transport: p.Transport})
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	defer backend.Close()
+
+	p._results, err = backend.Results(queue.ResultsKey)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
 	//
 	// Setup our the event watcher
 	//
@@ -301,11 +364,34 @@ func (p *k8sEventWatcherCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...in
 
 	fmt.Printf("k8s event watcher worker started [tag=%s]\n", p.Tag)
 
+	var started int32
+	if p.HTTPAddress != "" {
+		server := newHealthServer()
+		server.AddLiveness("redis", redisHealth(p._r))
+
+		kubernetesHealth, err := p.kubernetesHealth()
+		if err != nil {
+			fmt.Printf("K8s health check setup failed: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+		server.AddLiveness("kubernetes", kubernetesHealth)
+
+		server.AddReadiness("watcher", func() error {
+			if atomic.LoadInt32(&started) == 0 {
+				return errors.New("not started")
+			}
+			return nil
+		})
+
+		server.Start(p.HTTPAddress)
+	}
+
 	// Wait for k8s events
 	if err = eventWatcher.Start(p.onEvent); err != nil {
 		fmt.Printf("K8s event watcher start failed: %s\n", err.Error())
 		return subcommands.ExitFailure
 	}
+	atomic.StoreInt32(&started, 1)
 
 	defer eventWatcher.Stop()
 
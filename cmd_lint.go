@@ -0,0 +1,78 @@
+// Lint
+//
+// The lint sub-command checks configuration files, reporting all their
+// problems, e.g. as a pre-commit hook, or in CI.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/google/subcommands"
+)
+
+type lintCmd struct {
+}
+
+//
+// Glue
+//
+func (*lintCmd) Name() string     { return "lint" }
+func (*lintCmd) Synopsis() string { return "Check configuration files for problems" }
+func (*lintCmd) Usage() string {
+	return `lint <file1> [file2] .. :
+  Check the given configuration files, reporting every problem found as
+  file:line:column, rather than stopping at the first one:
+
+   - Invalid lines, unknown test-types and unknown options, with suggestions.
+   - Option values which do not match what the test-type expects.
+   - Duplicate tests, across all the files.
+   - Macros which are never used.
+   - Options which conflict with each other, or have no effect.
+
+  The exit code is non-zero if any problem is found.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *lintCmd) SetFlags(f *flag.FlagSet) {
+}
+
+//
+// Entry-point.
+//
+func (p *lintCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	if f.NArg() == 0 {
+		fmt.Printf("Expected the configuration files to check\n")
+		return subcommands.ExitUsageError
+	}
+
+	failed := false
+	linter := parser.NewLinter()
+	for _, file := range f.Args() {
+		if err := linter.LintFile(file); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			failed = true
+		}
+	}
+
+	diagnostics := linter.Diagnostics()
+	for _, d := range diagnostics {
+		fmt.Printf("%s\n", d)
+	}
+
+	if len(diagnostics) > 0 {
+		fmt.Printf("%d problems found\n", len(diagnostics))
+		failed = true
+	}
+
+	if failed {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
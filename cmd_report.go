@@ -0,0 +1,389 @@
+// Report
+//
+// The report sub-command computes the availability of the tests over a
+// period of time, from the history kept by the workers.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/filter"
+	"github.com/cmaster11/overseer/history"
+	"github.com/cmaster11/overseer/silence"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+// The formats of the reports
+const (
+	reportFormatMarkdown = "markdown"
+	reportFormatCSV      = "csv"
+	reportFormatJSON     = "json"
+)
+
+// How the tests are grouped in the reports
+const (
+	reportByTest = "test"
+	reportByTag  = "tag"
+)
+
+type reportCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+	From             string
+	To               string
+	Format           string
+	By               string
+	Match            string
+	_r               *redis.Client
+}
+
+// reportRow is the availability of a test, or of a tag.
+type reportRow struct {
+	Name   string
+	Target string
+	Stats  history.Stats
+}
+
+//
+// Glue
+//
+func (*reportCmd) Name() string     { return "report" }
+func (*reportCmd) Synopsis() string { return "Report the availability of the tests" }
+func (*reportCmd) Usage() string {
+	return `report [flags] :
+  Report the uptime, number of incidents, mean time to repair and longest
+  outage of every test, or tag, over a period of time.
+
+  The workers must be started with -history, keeping enough results to
+  cover the period.  The time of silenced results, and of the results
+  matching the known silences, is excluded.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *reportCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults reportCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Format = reportFormatMarkdown
+	defaults.By = reportByTest
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.StringVar(&p.From, "from", defaults.From, "The start of the period, as a date (2006-01-02) or RFC3339 (default 30 days ago).")
+	f.StringVar(&p.To, "to", defaults.To, "The end of the period, as a date (2006-01-02) or RFC3339 (default now).")
+	f.StringVar(&p.Format, "format", defaults.Format, "The format of the report: markdown, csv, or json.")
+	f.StringVar(&p.By, "by", defaults.By, "Report the availability of every test, or tag.")
+	f.StringVar(&p.Match, "match", defaults.Match, "If set, only report the tests matching these filters (e.g. tag=prod,type=http).")
+}
+
+// parseReportTime parses the start, or end, of the period of a report.
+func parseReportTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time '%s', expected e.g. 2006-01-02, or 2006-01-02T15:04:05Z07:00", value)
+	}
+	return t, nil
+}
+
+//
+// validate makes sure the flags are valid, returning the period.
+//
+func (p *reportCmd) validate() (time.Time, time.Time, error) {
+	now := time.Now()
+
+	from, err := parseReportTime(p.From, now.AddDate(0, 0, -30))
+	if err != nil {
+		return from, now, err
+	}
+	to, err := parseReportTime(p.To, now)
+	if err != nil {
+		return from, to, err
+	}
+	if !to.After(from) {
+		return from, to, fmt.Errorf("the end of the period must be after its start")
+	}
+
+	switch p.Format {
+	case reportFormatMarkdown, reportFormatCSV, reportFormatJSON:
+	default:
+		return from, to, fmt.Errorf("unknown format '%s', expected markdown, csv, or json", p.Format)
+	}
+	if p.By != reportByTest && p.By != reportByTag {
+		return from, to, fmt.Errorf("unknown grouping '%s', expected test, or tag", p.By)
+	}
+	return from, to, nil
+}
+
+//
+// compute returns the availability of the tests with a history.
+//
+func (p *reportCmd) compute(from time.Time, to time.Time) ([]reportRow, error) {
+	var match *filter.Filter
+	if p.Match != "" {
+		var err error
+		if match, err = filter.NewFromQuery(p.Match); err != nil {
+			return nil, err
+		}
+	}
+
+	// The silences which ended long ago are gone, but those results are
+	// marked as silenced anyway
+	silences, err := silence.NewRedisStore(p._r).List()
+	if err != nil {
+		return nil, err
+	}
+
+	store := history.NewRedisStore(p._r, 0, 0)
+	tests, err := store.Tests()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []reportRow
+	groups := make(map[string]int)
+	for _, t := range tests {
+		result := t.Result()
+		if match != nil && !match.Matches(result) {
+			continue
+		}
+
+		entries, err := store.Entries(t.Hash, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		stats := history.Compute(entries, from, to, func(entry history.Entry) bool {
+			if entry.Silenced {
+				return true
+			}
+			for _, s := range silences {
+				if s.Matches(result, time.Unix(entry.Time, 0)) {
+					return true
+				}
+			}
+			return false
+		})
+
+		if p.By == reportByTest {
+			name := t.Input
+			if t.TestLabel != "" {
+				name = t.TestLabel
+			}
+			if t.Location != "" {
+				name += " from " + t.Location
+			}
+			rows = append(rows, reportRow{Name: name, Target: t.Target, Stats: stats})
+			continue
+		}
+
+		if _, ok := groups[t.Tag]; !ok {
+			groups[t.Tag] = len(rows)
+			rows = append(rows, reportRow{Name: t.Tag})
+		}
+		rows[groups[t.Tag]].Stats.Add(stats)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	return rows, nil
+}
+
+// formatDuration formats the durations of the markdown reports.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Truncate(time.Second).String()
+}
+
+//
+// write outputs the report in the requested format.
+//
+func (p *reportCmd) write(rows []reportRow, from time.Time, to time.Time) error {
+	title := "Test"
+	if p.By == reportByTag {
+		title = "Tag"
+	}
+
+	switch p.Format {
+	case reportFormatMarkdown:
+		fmt.Printf("# Availability from %s to %s\n\n", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		if p.By == reportByTest {
+			fmt.Printf("| %s | Target | Uptime | Incidents | MTTR | Longest outage | Excluded |\n", title)
+			fmt.Printf("| --- | --- | ---: | ---: | ---: | ---: | ---: |\n")
+		} else {
+			fmt.Printf("| %s | Uptime | Incidents | MTTR | Longest outage | Excluded |\n", title)
+			fmt.Printf("| --- | ---: | ---: | ---: | ---: | ---: |\n")
+		}
+		for _, row := range rows {
+			name := strings.Replace(row.Name, "|", "\\|", -1)
+			if p.By == reportByTest {
+				name += " | " + row.Target
+			}
+			fmt.Printf("| %s | %.3f%% | %d | %s | %s | %s |\n", name, row.Stats.Uptime(), row.Stats.Incidents,
+				formatDuration(row.Stats.MTTR()), formatDuration(row.Stats.Longest), formatDuration(row.Stats.Excluded))
+		}
+		return nil
+
+	case reportFormatCSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{strings.ToLower(title), "target", "uptime_percent", "incidents", "mttr_seconds",
+			"longest_outage_seconds", "up_seconds", "down_seconds", "excluded_seconds"})
+		for _, row := range rows {
+			w.Write([]string{
+				row.Name,
+				row.Target,
+				fmt.Sprintf("%.3f", row.Stats.Uptime()),
+				fmt.Sprintf("%d", row.Stats.Incidents),
+				fmt.Sprintf("%.0f", row.Stats.MTTR().Seconds()),
+				fmt.Sprintf("%.0f", row.Stats.Longest.Seconds()),
+				fmt.Sprintf("%.0f", row.Stats.Up.Seconds()),
+				fmt.Sprintf("%.0f", row.Stats.Down.Seconds()),
+				fmt.Sprintf("%.0f", row.Stats.Excluded.Seconds()),
+			})
+		}
+		w.Flush()
+		return w.Error()
+
+	default:
+		type jsonRow struct {
+			Name                 string  `json:"name"`
+			Target               string  `json:"target,omitempty"`
+			UptimePercent        float64 `json:"uptimePercent"`
+			Incidents            int     `json:"incidents"`
+			MTTRSeconds          float64 `json:"mttrSeconds"`
+			LongestOutageSeconds float64 `json:"longestOutageSeconds"`
+			UpSeconds            float64 `json:"upSeconds"`
+			DownSeconds          float64 `json:"downSeconds"`
+			ExcludedSeconds      float64 `json:"excludedSeconds"`
+		}
+
+		report := struct {
+			From  time.Time `json:"from"`
+			To    time.Time `json:"to"`
+			By    string    `json:"by"`
+			Items []jsonRow `json:"items"`
+		}{From: from, To: to, By: p.By, Items: []jsonRow{}}
+
+		for _, row := range rows {
+			report.Items = append(report.Items, jsonRow{
+				Name:                 row.Name,
+				Target:               row.Target,
+				UptimePercent:        row.Stats.Uptime(),
+				Incidents:            row.Stats.Incidents,
+				MTTRSeconds:          row.Stats.MTTR().Seconds(),
+				LongestOutageSeconds: row.Stats.Longest.Seconds(),
+				UpSeconds:            row.Stats.Up.Seconds(),
+				DownSeconds:          row.Stats.Down.Seconds(),
+				ExcludedSeconds:      row.Stats.Excluded.Seconds(),
+			})
+		}
+
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+}
+
+//
+// Entry-point.
+//
+func (p *reportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	from, to, err := p.validate()
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	//
+	// And run a ping, just to make sure it worked.
+	//
+	_, err = p._r.Ping().Result()
+	if err != nil {
+		fmt.Printf("Redis connection failed: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	rows, err := p.compute(from, to)
+	if err == nil {
+		err = p.write(rows, from, to)
+	}
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,247 @@
+// Run
+//
+// The run sub-command executes the tests of configuration files once,
+// locally, reporting their results and exiting with a failure if any of
+// them failed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"github.com/google/subcommands"
+)
+
+type runCmd struct {
+	// The worker executing the tests
+	worker workerCmd
+
+	// The format of the report: text, json, tap or junit
+	Format string
+
+	// Where the report is written, "-" for stdout
+	Output string
+}
+
+// runOutcome holds the results of a single test.
+type runOutcome struct {
+	Test test.Test
+
+	// One result for each target the test was executed against
+	Results []*test.Result
+
+	// How long the test took, across all of its targets
+	Duration time.Duration
+}
+
+// Failed returns true if the test failed against any of its targets.
+func (o *runOutcome) Failed() bool {
+	for _, result := range o.Results {
+		if result.Error != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// runResults collects the results published by a test.
+type runResults struct {
+	mutex   sync.Mutex
+	results []*test.Result
+}
+
+func (r *runResults) Publish(msg string) error {
+	result, err := test.ResultFromJSON([]byte(msg))
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.results = append(r.results, result)
+	return nil
+}
+
+//
+// Glue
+//
+func (*runCmd) Name() string     { return "run" }
+func (*runCmd) Synopsis() string { return "Execute the tests of configuration files locally" }
+func (*runCmd) Usage() string {
+	return `run :
+  Parse the given configuration files, execute all their tests once,
+  locally and without redis, and report the results.
+
+  The exit code is non-zero if any test failed, so this can be used e.g.
+  as a smoke test in deployment pipelines.
+
+  Deduplication and min-duration rules require redis, so they are ignored.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *runCmd) SetFlags(f *flag.FlagSet) {
+	worker := flag.NewFlagSet("worker", flag.ContinueOnError)
+	p.worker.SetFlags(worker)
+	copyFlags(f, worker, append(redisFlags, "dedup", "min-duration", "drain-timeout", "limit-action", "priority-", "flap-", "silenced-", "location", "quorum-")...)
+
+	f.StringVar(&p.Format, "format", "text", "The format of the report: text, json, tap, or junit.")
+	f.StringVar(&p.Output, "output", "-", "The file the report is written to, - for the standard output.")
+}
+
+//
+// runOne executes a single test, collecting its results.
+//
+func (p *runCmd) runOne(ctx context.Context, workerIdx uint, tst test.Test, opts test.Options) *runOutcome {
+	results := &runResults{}
+
+	// Every test gets its own worker, so that results are not mixed up
+	worker := p.worker
+	worker._results = results
+
+	// Tests over the concurrency limits wait for their turn
+	lease, _ := worker.acquireLimits(ctx, workerIdx, tst)
+
+	start := time.Now()
+	err := worker.runTest(ctx, workerIdx, tst, opts)
+	lease.Release()
+
+	outcome := &runOutcome{
+		Test:     tst,
+		Results:  results.results,
+		Duration: time.Since(start),
+	}
+
+	//
+	// A test which produced no results, e.g. because none of its
+	// targets could be tested, is a failure too.
+	//
+	if len(outcome.Results) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no targets to test")
+		}
+		errorString := err.Error()
+		outcome.Results = append(outcome.Results, &test.Result{
+			Input:  tst.Sanitize(),
+			Target: tst.Target,
+			Time:   time.Now().Unix(),
+			Type:   tst.Type,
+			Error:  &errorString,
+		})
+	}
+
+	return outcome
+}
+
+//
+// Entry-point.
+//
+func (p *runCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	report, ok := runReports[p.Format]
+	if !ok {
+		fmt.Printf("Unknown report format: %s\n", p.Format)
+		return subcommands.ExitUsageError
+	}
+
+	if p.worker.Parallel == 0 {
+		fmt.Printf("Number of parallel workers must be > 0\n")
+		return subcommands.ExitUsageError
+	}
+	if err := p.worker.validateRetry(); err != nil {
+		fmt.Printf("Invalid retry settings: %s\n", err.Error())
+		return subcommands.ExitUsageError
+	}
+	if err := p.worker.validateLimits(); err != nil {
+		fmt.Printf("Invalid concurrency limits: %s\n", err.Error())
+		return subcommands.ExitUsageError
+	}
+	p.worker.LimitAction = limitActionWait
+	p.worker.setupLimits()
+
+	//
+	// Parse all the tests first, so that a broken configuration does
+	// not run anything.
+	//
+	var tests []test.Test
+	for _, file := range f.Args() {
+		helper := parser.New()
+
+		err := helper.ParseFile(file, func(tst test.Test) error {
+			tests = append(tests, tst)
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error parsing file %s: %s\n", file, err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if p.Output != "-" {
+		file, err := os.Create(p.Output)
+		if err != nil {
+			fmt.Printf("Failed to create report: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+		defer file.Close()
+		out = file
+	}
+
+	var opts test.Options
+	opts.Verbose = p.worker.Verbose
+	opts.Timeout = p.worker.Timeout
+
+	// Running tests are cancelled when we're interrupted
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	onSignalInterrupt(cancel)
+
+	//
+	// Run the tests, up to `parallel` at the same time.
+	//
+	outcomes := make([]*runOutcome, len(tests))
+	slots := make(chan uint, p.worker.Parallel)
+	var idx uint
+	for idx = 1; idx <= p.worker.Parallel; idx++ {
+		slots <- idx
+	}
+
+	wg := &sync.WaitGroup{}
+	for i, tst := range tests {
+		i, tst := i, tst
+		workerIdx := <-slots
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcomes[i] = p.runOne(ctx, workerIdx, tst, opts)
+			slots <- workerIdx
+		}()
+	}
+	wg.Wait()
+
+	if err := report(out, outcomes); err != nil {
+		fmt.Printf("Failed to write report: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if ctx.Err() != nil {
+		return subcommands.ExitFailure
+	}
+	for _, outcome := range outcomes {
+		if outcome.Failed() {
+			return subcommands.ExitFailure
+		}
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,201 @@
+// Run reports
+//
+// The formats the run sub-command can report test results with.
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runReport writes the outcomes of the executed tests.
+type runReport func(out io.Writer, outcomes []*runOutcome) error
+
+// runReports contains the supported report formats, by name.
+var runReports = map[string]runReport{
+	"text":  textReport,
+	"json":  jsonReport,
+	"tap":   tapReport,
+	"junit": junitReport,
+}
+
+//
+// textReport writes a line for each result, followed by a summary.
+//
+func textReport(out io.Writer, outcomes []*runOutcome) error {
+	count := 0
+	failed := 0
+
+	for _, outcome := range outcomes {
+		for _, result := range outcome.Results {
+			count++
+			if result.Error == nil {
+				fmt.Fprintf(out, "PASS %s [%s]\n", result.Input, result.Target)
+				continue
+			}
+
+			failed++
+			fmt.Fprintf(out, "FAIL %s [%s]: %s\n", result.Input, result.Target, *result.Error)
+			if result.Details != nil {
+				fmt.Fprintf(out, "%s", indent(*result.Details, "     "))
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(out, "%d tests, %d failures\n", count, failed)
+	return err
+}
+
+//
+// jsonReport writes each result as JSON, one per line, in the same format
+// used by the workers.
+//
+func jsonReport(out io.Writer, outcomes []*runOutcome) error {
+	encoder := json.NewEncoder(out)
+
+	for _, outcome := range outcomes {
+		for _, result := range outcome.Results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+//
+// tapReport writes the results using the Test Anything Protocol, version 13.
+//
+func tapReport(out io.Writer, outcomes []*runOutcome) error {
+	count := 0
+	for _, outcome := range outcomes {
+		count += len(outcome.Results)
+	}
+
+	fmt.Fprintf(out, "TAP version 13\n1..%d\n", count)
+
+	n := 0
+	for _, outcome := range outcomes {
+		for _, result := range outcome.Results {
+			n++
+
+			// `#` starts a directive, so it cannot be part of a description
+			description := strings.Replace(fmt.Sprintf("%s [%s]", result.Input, result.Target), "#", "\\#", -1)
+
+			if result.Error == nil {
+				fmt.Fprintf(out, "ok %d - %s\n", n, description)
+				continue
+			}
+
+			fmt.Fprintf(out, "not ok %d - %s\n", n, description)
+			fmt.Fprintf(out, "  ---\n")
+			fmt.Fprintf(out, "  message: %s\n", yamlString(*result.Error))
+			if result.Details != nil {
+				fmt.Fprintf(out, "  details: %s\n", yamlString(*result.Details))
+			}
+			fmt.Fprintf(out, "  ...\n")
+		}
+	}
+
+	return nil
+}
+
+// yamlString quotes a string, so that it can be used as a YAML value.
+//
+// JSON strings are valid YAML ones.
+func yamlString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
+// The JUnit XML elements we generate.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+//
+// junitReport writes the results as JUnit XML, with a test suite for each
+// test type, which most CI systems can display.
+//
+func junitReport(out io.Writer, outcomes []*runOutcome) error {
+	report := junitTestSuites{}
+	suites := make(map[string]int)
+	var suiteSeconds []float64
+
+	for _, outcome := range outcomes {
+		for _, result := range outcome.Results {
+			idx, ok := suites[result.Type]
+			if !ok {
+				idx = len(report.Suites)
+				suites[result.Type] = idx
+				report.Suites = append(report.Suites, junitTestSuite{Name: result.Type})
+				suiteSeconds = append(suiteSeconds, 0)
+			}
+			suite := &report.Suites[idx]
+
+			testCase := junitTestCase{
+				Name:      fmt.Sprintf("%s [%s]", result.Input, result.Target),
+				ClassName: "overseer." + result.Type,
+				Time:      fmt.Sprintf("%.3f", outcome.Duration.Seconds()),
+			}
+			if result.Error != nil {
+				testCase.Failure = &junitFailure{Message: *result.Error}
+				if result.Details != nil {
+					testCase.Failure.Content = *result.Details
+				}
+				suite.Failures++
+				report.Failures++
+			}
+
+			suiteSeconds[idx] += outcome.Duration.Seconds()
+			suite.Tests++
+			report.Tests++
+			suite.TestCases = append(suite.TestCases, testCase)
+		}
+	}
+
+	// The suite time is the sum of the times of its tests
+	for i := range report.Suites {
+		report.Suites[i].Time = fmt.Sprintf("%.3f", suiteSeconds[i])
+	}
+
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(out, "\n")
+	return err
+}
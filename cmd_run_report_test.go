@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// reportOutcomes returns the outcomes of a passing, and a failing, test.
+func reportOutcomes() []*runOutcome {
+	failure := `expected status 200, got <500> & "retried"`
+	details := "Response:\n  Internal error\n"
+
+	return []*runOutcome{
+		{
+			Results: []*test.Result{
+				{Input: "https://example.com/#top must run http", Target: "192.0.2.1", Type: "http"},
+				{Input: "https://example.com/#top must run http", Target: "192.0.2.2", Type: "http", Error: &failure, Details: &details},
+			},
+			Duration: 1500 * time.Millisecond,
+		},
+		{
+			Results: []*test.Result{
+				{Input: "example.com must run ping", Target: "192.0.2.1", Type: "ping"},
+			},
+			Duration: 250 * time.Millisecond,
+		},
+	}
+}
+
+func TestRunReports(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"text", `PASS https://example.com/#top must run http [192.0.2.1]
+FAIL https://example.com/#top must run http [192.0.2.2]: expected status 200, got <500> & "retried"
+     Response:
+       Internal error
+PASS example.com must run ping [192.0.2.1]
+3 tests, 1 failures
+`},
+		{"tap", `TAP version 13
+1..3
+ok 1 - https://example.com/\#top must run http [192.0.2.1]
+not ok 2 - https://example.com/\#top must run http [192.0.2.2]
+  ---
+  message: "expected status 200, got \u003c500\u003e \u0026 \"retried\""
+  details: "Response:\n  Internal error\n"
+  ...
+ok 3 - example.com must run ping [192.0.2.1]
+`},
+		{"junit", `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1">
+  <testsuite name="http" tests="2" failures="1" time="3.000">
+    <testcase name="https://example.com/#top must run http [192.0.2.1]" classname="overseer.http" time="1.500"></testcase>
+    <testcase name="https://example.com/#top must run http [192.0.2.2]" classname="overseer.http" time="1.500">
+      <failure message="expected status 200, got &lt;500&gt; &amp; &#34;retried&#34;">Response:&#xA;  Internal error&#xA;</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="ping" tests="1" failures="0" time="0.250">
+    <testcase name="example.com must run ping [192.0.2.1]" classname="overseer.ping" time="0.250"></testcase>
+  </testsuite>
+</testsuites>
+`},
+	}
+
+	for _, tst := range tests {
+		var out bytes.Buffer
+		if err := runReports[tst.format](&out, reportOutcomes()); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		if out.String() != tst.expected {
+			t.Errorf("Unexpected %s report, expected:\n%s\ngot:\n%s", tst.format, tst.expected, out.String())
+		}
+	}
+}
+
+// Test the JSON report is made of results, one per line
+func TestRunReportJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := jsonReport(&out, reportOutcomes()); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var results []test.Result
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var result test.Result
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[1].Error == nil || results[1].Target != "192.0.2.2" {
+		t.Errorf("Expected the second result to be the failure, got %+v", results[1])
+	}
+}
@@ -0,0 +1,357 @@
+// Schedule
+//
+// The schedule sub-command keeps running, and adds the parsed tests to the
+// central redis queue on their own schedule.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/queue"
+	"github.com/cmaster11/overseer/scheduler"
+	"github.com/cmaster11/overseer/test"
+	"github.com/cmaster11/overseer/utils"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+type scheduleCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+	Transport        string
+
+	// Schedule of tests without the `every` option
+	Every string
+
+	// Max random delay of each run, as a percentage of the test interval
+	Jitter float32
+
+	// How often to check the configuration files for changes
+	ReloadInterval time.Duration
+
+	_r    *redis.Client
+	_jobs queue.JobQueue
+
+	files    []string
+	modTimes map[string]time.Time
+
+	// The files which could not be read at the last check
+	unreadable map[string]bool
+
+	// The files, and directories, included by the configuration files
+	sources []string
+}
+
+//
+// Glue
+//
+func (*scheduleCmd) Name() string     { return "schedule" }
+func (*scheduleCmd) Synopsis() string { return "Periodically enqueue the tests of configuration files" }
+func (*scheduleCmd) Usage() string {
+	return `schedule :
+  Keep adding the tests from parsed configuration files to a central redis
+  queue, each one on its own schedule, defined via the 'every' option:
+
+    https://example.com must run http with every 30s
+    https://example.com must run http with every '*/5 * * * *'
+
+  Configuration files are reloaded when they change, or on SIGHUP.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *scheduleCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults scheduleCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Transport = queue.TransportList
+	defaults.Every = "1m"
+	defaults.Jitter = 0.1
+	defaults.ReloadInterval = 10 * time.Second
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.StringVar(&p.Transport, "transport", defaults.Transport, "How jobs are added to the queue: list, or stream.")
+
+	f.StringVar(&p.Every, "every", defaults.Every, "The schedule of tests which do not define the 'every' option, either a duration or a cron expression.")
+	f.Var(utils.NewPercentageValue(defaults.Jitter, &p.Jitter), "jitter", "The max random delay of each run, as a percentage of the test interval.")
+	f.DurationVar(&p.ReloadInterval, "reload-interval", defaults.ReloadInterval, "How often to check the configuration files for changes.")
+}
+
+//
+// parseFiles parses all the configuration files, returning the found tests.
+//
+func (p *scheduleCmd) parseFiles() ([]test.Test, error) {
+	var tests []test.Test
+	var sources []string
+
+	for _, file := range p.files {
+		helper := parser.New()
+
+		err := helper.ParseFile(file, func(tst test.Test) error {
+			tests = append(tests, tst)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error parsing file %s: %s", file, err.Error())
+		}
+
+		sources = append(sources, helper.Sources()...)
+	}
+
+	p.sources = sources
+	return tests, nil
+}
+
+//
+// filesChanged returns true if any of the configuration files, or of the
+// files and directories they include, has been modified since the last time
+// we checked.
+//
+// A file which cannot be read is only reported as changed once, until it
+// can be read again, rather than at every check.
+//
+func (p *scheduleCmd) filesChanged() bool {
+	changed := false
+
+	files := append(append([]string{}, p.files...), p.sources...)
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			// Let the parser report the error
+			if !p.unreadable[file] {
+				p.unreadable[file] = true
+				changed = true
+			}
+			continue
+		}
+
+		if p.unreadable[file] {
+			delete(p.unreadable, file)
+			changed = true
+		}
+
+		if !stat.ModTime().Equal(p.modTimes[file]) {
+			p.modTimes[file] = stat.ModTime()
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+//
+// reload re-parses the configuration files, and updates the scheduler.
+//
+// On errors the previous schedule is kept.
+//
+func (p *scheduleCmd) reload(s *scheduler.Scheduler) error {
+	tests, err := p.parseFiles()
+	if err != nil {
+		return err
+	}
+
+	// Remember the modification times of the included files
+	p.filesChanged()
+
+	if err = s.Update(tests, time.Now()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Scheduled %d tests\n", s.Len())
+	return nil
+}
+
+//
+// setFiles sets the configuration files to schedule, making sure they
+// can be reloaded.
+//
+func (p *scheduleCmd) setFiles(files []string) subcommands.ExitStatus {
+	p.files = files
+
+	if len(p.files) == 0 {
+		fmt.Printf("No configuration files specified\n")
+		return subcommands.ExitUsageError
+	}
+	for _, file := range p.files {
+		if file == "-" {
+			fmt.Printf("Reading from stdin is not supported, as files need to be reloaded\n")
+			return subcommands.ExitUsageError
+		}
+	}
+
+	return subcommands.ExitSuccess
+}
+
+//
+// Entry-point.
+//
+func (p *scheduleCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	if status := p.setFiles(f.Args()); status != subcommands.ExitSuccess {
+		return status
+	}
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	//
+	// And run a ping, just to make sure it worked.
+	//
+	_, err := p._r.Ping().Result()
+	if err != nil {
+		fmt.Printf("Redis connection failed: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	backend, err := queue.NewRedisBackend(p._r, queue.RedisOptions{Transport: p.Transport})
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	defer backend.Close()
+
+	jobs, err := backend.Jobs("")
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	stop := make(chan bool)
+	onSignalInterrupt(func() {
+		close(stop)
+	})
+
+	return p.run(jobs, stop)
+}
+
+//
+// run keeps adding the scheduled tests to the given job queue, until the
+// stop channel is closed.
+//
+func (p *scheduleCmd) run(jobs queue.JobQueue, stop <-chan bool) subcommands.ExitStatus {
+	p._jobs = jobs
+	p.modTimes = make(map[string]time.Time)
+	p.unreadable = make(map[string]bool)
+
+	s, err := scheduler.New(p.Every, p.Jitter)
+	if err != nil {
+		fmt.Printf("Invalid schedule settings: %s\n", err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	//
+	// The first load must succeed, otherwise there is nothing to do.
+	//
+	p.filesChanged()
+	if err = p.reload(s); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	reloadTicker := time.NewTicker(p.ReloadInterval)
+	defer reloadTicker.Stop()
+
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	for {
+		for _, tst := range s.Due(time.Now()) {
+			if err = pushTest(p._jobs, tst); err != nil {
+				fmt.Printf("Failed to enqueue test %s: %s\n", tst.Input, err.Error())
+			}
+		}
+
+		//
+		// Sleep until the next test is due, or we're asked to
+		// reload/stop.
+		//
+		wait := p.ReloadInterval
+		if next, ok := s.Next(); ok {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-reloadTicker.C:
+			if p.filesChanged() {
+				fmt.Printf("Configuration changed, reloading\n")
+				if err = p.reload(s); err != nil {
+					fmt.Printf("Failed to reload configuration, keeping the previous one: %s\n", err.Error())
+				}
+			}
+		case <-hupCh:
+			fmt.Printf("Received SIGHUP, reloading\n")
+			p.filesChanged()
+			if err = p.reload(s); err != nil {
+				fmt.Printf("Failed to reload configuration, keeping the previous one: %s\n", err.Error())
+			}
+		case <-stop:
+			timer.Stop()
+			return subcommands.ExitSuccess
+		}
+
+		timer.Stop()
+	}
+}
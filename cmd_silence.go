@@ -0,0 +1,260 @@
+// Silence
+//
+// The silence sub-command adds, lists and expires the silences which mute
+// the notifications of matching results, e.g. during planned maintenance.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/silence"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+type silenceCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+	_r               *redis.Client
+}
+
+//
+// Glue
+//
+func (*silenceCmd) Name() string     { return "silence" }
+func (*silenceCmd) Synopsis() string { return "Add, list and expire silences" }
+func (*silenceCmd) Usage() string {
+	return `silence [flags] add -match <matchers> [-start <time>] (-end <time> | -duration <duration> | -cron <expr> -window <duration>) [-comment <text>] :
+  Silence the results matching all the given matchers (e.g. target=db1,type=mysql),
+  which can use the keys type, tag, target, testLabel and input.
+
+silence [flags] list [-all] :
+  List the active, and upcoming, silences, or all of them.
+
+silence [flags] expire <id> :
+  End the given silence now.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *silenceCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults silenceCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+}
+
+// parseTime parses a time given on the command-line, either RFC3339, or
+// "now".
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" || value == "now" {
+		return now, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time '%s', expected e.g. 2006-01-02T15:04:05Z07:00", value)
+	}
+	return t, nil
+}
+
+//
+// add creates a new silence, from the given arguments.
+//
+func (p *silenceCmd) add(store silence.Store, args []string) error {
+	f := flag.NewFlagSet("add", flag.ContinueOnError)
+	match := f.String("match", "", "The matchers of the results to silence (e.g. target=db1,type=mysql).")
+	start := f.String("start", "now", "When the silence starts (RFC3339).")
+	end := f.String("end", "", "When the silence ends (RFC3339).")
+	duration := f.Duration("duration", 0, "How long the silence lasts, if no end is given.")
+	cronExpr := f.String("cron", "", "If set, the silence is only active every time this cron expression fires (e.g. '0 2 * * SUN').")
+	window := f.Duration("window", 0, "With -cron, how long every maintenance window lasts.")
+	comment := f.String("comment", "", "Why the results are silenced.")
+	createdBy := f.String("created-by", os.Getenv("USER"), "Who created the silence.")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s := &silence.Silence{
+		ID:        silence.NewID(),
+		Matchers:  *match,
+		Cron:      *cronExpr,
+		Duration:  *window,
+		Comment:   *comment,
+		CreatedBy: *createdBy,
+		CreatedAt: now,
+	}
+
+	var err error
+	if s.Start, err = parseTime(*start, now); err != nil {
+		return err
+	}
+	if *end != "" {
+		if s.End, err = parseTime(*end, now); err != nil {
+			return err
+		}
+	} else if *duration > 0 {
+		s.End = s.Start.Add(*duration)
+	}
+
+	if err = store.Add(s); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\n", s.ID)
+	return nil
+}
+
+//
+// list shows the silences, from the given arguments.
+//
+func (p *silenceCmd) list(store silence.Store, args []string) error {
+	f := flag.NewFlagSet("list", flag.ContinueOnError)
+	all := f.Bool("all", false, "Show the expired silences too.")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	silences, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range silences {
+		if s.Expired(now) && !*all {
+			continue
+		}
+
+		status := "pending"
+		switch {
+		case s.Expired(now):
+			status = "expired"
+		case s.Active(now):
+			status = "active"
+		case s.Cron != "" && !now.Before(s.Start):
+			status = "scheduled"
+		}
+
+		window := s.Start.Format(time.RFC3339) + " -> "
+		if !s.End.IsZero() {
+			window += s.End.Format(time.RFC3339)
+		}
+		if s.Cron != "" {
+			window += fmt.Sprintf(" (every '%s' for %s)", s.Cron, s.Duration)
+		}
+
+		fmt.Printf("%s  %-9s  %s  %s\n", s.ID, status, s.Matchers, window)
+		if s.Comment != "" || s.CreatedBy != "" {
+			fmt.Printf("    %s (%s)\n", s.Comment, s.CreatedBy)
+		}
+	}
+	return nil
+}
+
+//
+// Entry-point.
+//
+func (p *silenceCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() < 1 {
+		fmt.Printf("Expected an action: add, list, or expire\n")
+		return subcommands.ExitUsageError
+	}
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	//
+	// And run a ping, just to make sure it worked.
+	//
+	_, err := p._r.Ping().Result()
+	if err != nil {
+		fmt.Printf("Redis connection failed: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	store := silence.NewRedisStore(p._r)
+	args := f.Args()[1:]
+
+	switch strings.ToLower(f.Arg(0)) {
+	case "add":
+		err = p.add(store, args)
+	case "list":
+		err = p.list(store, args)
+	case "expire":
+		if len(args) != 1 {
+			fmt.Printf("Expected the id of the silence to expire\n")
+			return subcommands.ExitUsageError
+		}
+		err = store.Expire(args[0], time.Now())
+	default:
+		fmt.Printf("Unknown action '%s', expected add, list, or expire\n", f.Arg(0))
+		return subcommands.ExitUsageError
+	}
+
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
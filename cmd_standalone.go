@@ -0,0 +1,204 @@
+// Standalone
+//
+// The standalone sub-command runs the scheduler and the workers within a
+// single process, exchanging jobs and results via an in-memory queue, so
+// that no redis-server is required.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cmaster11/overseer/queue"
+	"github.com/cmaster11/overseer/scheduler"
+	"github.com/cmaster11/overseer/test"
+	"github.com/cmaster11/overseer/webhook"
+	"github.com/google/subcommands"
+)
+
+type standaloneCmd struct {
+	// The workers executing the tests
+	worker workerCmd
+
+	// The scheduler enqueuing the tests
+	schedule scheduleCmd
+
+	// The webhook results are posted to, if its url is set
+	Webhook webhook.Poster
+}
+
+//
+// Glue
+//
+func (*standaloneCmd) Name() string { return "standalone" }
+func (*standaloneCmd) Synopsis() string {
+	return "Schedule and execute tests within a single process, without redis"
+}
+func (*standaloneCmd) Usage() string {
+	return `standalone :
+  Keep executing the tests from parsed configuration files, each one on
+  its own schedule, within a single process and without a redis-server.
+
+  Test results are written to the standard output as JSON, one per line,
+  and can also be posted to a webhook.
+
+  The state used by the deduplication, min-duration and depends-on rules is
+  kept in memory, and lost on restart.
+`
+}
+
+// redisFlags are the prefixes of the worker and schedule flags which make
+// no sense without redis.
+var redisFlags = []string{"redis-", "transport", "reliable", "visibility-timeout", "worker-id", "cluster-limits", "history"}
+
+//
+// Flag setup.
+//
+func (p *standaloneCmd) SetFlags(f *flag.FlagSet) {
+	worker := flag.NewFlagSet("worker", flag.ContinueOnError)
+	p.worker.SetFlags(worker)
+	schedule := flag.NewFlagSet("schedule", flag.ContinueOnError)
+	p.schedule.SetFlags(schedule)
+
+	copyFlags(f, worker, redisFlags...)
+	copyFlags(f, schedule, redisFlags...)
+
+	f.StringVar(&p.Webhook.URL, "webhook-url", "", "If set, the url test results are posted to.")
+	f.BoolVar(&p.Webhook.SendTestSuccess, "send-test-success", false, "Post also the results of successful tests to the webhook.")
+}
+
+//
+// processResult writes a test result to the standard output, and posts it
+// to the webhook, if any.
+//
+func (p *standaloneCmd) processResult(msg []byte) {
+	fmt.Printf("%s\n", msg)
+
+	if p.Webhook.URL == "" {
+		return
+	}
+
+	testResult, err := test.ResultFromJSON(msg)
+	if err != nil {
+		fmt.Printf("Failed to decode test result: %s\n", err.Error())
+		return
+	}
+	if !p.Webhook.ShouldPost(testResult) {
+		return
+	}
+
+	if err := p.Webhook.Post(msg); err != nil {
+		fmt.Printf("Error - %s\n", err.Error())
+	}
+}
+
+//
+// Entry-point.
+//
+func (p *standaloneCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	if status := p.schedule.setFiles(f.Args()); status != subcommands.ExitSuccess {
+		return status
+	}
+
+	//
+	// Make sure the configuration is valid before starting anything.
+	//
+	if _, err := scheduler.New(p.schedule.Every, p.schedule.Jitter); err != nil {
+		fmt.Printf("Invalid schedule settings: %s\n", err.Error())
+		return subcommands.ExitUsageError
+	}
+	if _, err := p.schedule.parseFiles(); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if p.worker.Parallel == 0 {
+		fmt.Printf("Number of parallel workers must be > 0\n")
+		return subcommands.ExitFailure
+	}
+	if err := p.worker.validateRetry(); err != nil {
+		fmt.Printf("Invalid retry settings: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if err := p.worker.validateLimits(); err != nil {
+		fmt.Printf("Invalid concurrency limits: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if err := p.worker.validateFlapping(); err != nil {
+		fmt.Printf("Invalid flap detection settings: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if err := p.worker.validateSilences(); err != nil {
+		fmt.Printf("Invalid silences settings: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	priority, err := p.worker.priorityOrder()
+	if err != nil {
+		fmt.Printf("Invalid priorities: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	backend := queue.NewMemoryBackend()
+	backend.Priority = priority
+	backend.Location = p.worker.Location
+	defer backend.Close()
+
+	results, err := backend.ResultSource(queue.ResultsKey, "", "")
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	jobs, err := backend.Jobs("")
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	//
+	// Stop scheduling new tests as soon as the workers start draining,
+	// while they complete the running ones.
+	//
+	stop := make(chan bool)
+	p.worker._onDrain = func() {
+		close(stop)
+	}
+
+	go func() {
+		if status := p.schedule.run(jobs, stop); status != subcommands.ExitSuccess {
+			fmt.Printf("Scheduler terminated, no more tests will be executed\n")
+		}
+	}()
+
+	done := make(chan bool)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		queue.Consume(results, p.processResult, done)
+	}()
+
+	status := p.worker.run(ctx, backend)
+
+	//
+	// Process the results published by the last tests.
+	//
+	close(done)
+	wg.Wait()
+	for {
+		msg, err := results.Receive(time.Millisecond)
+		if err != nil || msg == nil {
+			break
+		}
+		p.processResult([]byte(msg.Body))
+	}
+
+	if pending, _ := backend.PendingJobs(); pending > 0 {
+		fmt.Printf("%d scheduled tests were not executed\n", pending)
+	}
+
+	return status
+}
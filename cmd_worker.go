@@ -12,21 +12,26 @@ import (
 	"net"
 	"net/url"
 	"os"
-	"regexp"
 	"runtime"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cmaster11/overseer/alert"
+	"github.com/cmaster11/overseer/history"
+	"github.com/cmaster11/overseer/limits"
+	"github.com/cmaster11/overseer/metrics"
 	"github.com/cmaster11/overseer/parser"
 	"github.com/cmaster11/overseer/protocols"
+	"github.com/cmaster11/overseer/queue"
+	"github.com/cmaster11/overseer/retry"
+	"github.com/cmaster11/overseer/silence"
 	"github.com/cmaster11/overseer/test"
 	"github.com/cmaster11/overseer/utils"
 	"github.com/go-redis/redis"
 	"github.com/google/subcommands"
-	"github.com/marpaia/graphite-golang"
 	_ "github.com/skx/golang-metrics"
 )
 
@@ -50,6 +55,18 @@ type workerCmd struct {
 	// Prior to retrying a failed test how long should we pause?
 	RetryDelay time.Duration
 
+	// How the pause grows with the retries: fixed, linear or exponential
+	RetryBackoff string
+
+	// The max pause before retrying a failed test, if > 0
+	RetryMaxDelay time.Duration
+
+	// The max random amount added to each pause, as a percentage of it
+	RetryJitter float32
+
+	// The comma-separated error classes which are retried
+	RetryOn string
+
 	// Default min duration
 	MinDuration time.Duration
 
@@ -59,6 +76,25 @@ type workerCmd struct {
 	// Default deduplication duration
 	DedupDuration time.Duration
 
+	// Default number of results used to detect flapping tests, 0 to disable flap detection
+	FlapWindow uint
+
+	// Default rates of state changes [0-1] above which tests start flapping, and below which they stop
+	FlapHighThreshold float32
+	FlapLowThreshold  float32
+
+	// What to do with silenced results: mark, or drop
+	SilencedAction string
+
+	// How many results of every test are kept in redis, 0 to keep none
+	HistorySize uint
+
+	// After how long the history of a test which stopped running is forgotten
+	HistoryRetention time.Duration
+
+	// For how long the results of the locations running a test with a quorum are collected
+	QuorumWindow time.Duration
+
 	// The redis-host we're going to connect to for our queues.
 	RedisHost string
 
@@ -74,12 +110,19 @@ type workerCmd struct {
 	// Redis connection timeout
 	RedisDialTimeout time.Duration
 
+	// How jobs and results are exchanged via redis (list or stream)
+	Transport string
+
 	// Tag applied to all results
 	Tag string
 
 	// How long should tests run for?
 	Timeout time.Duration
 
+	// On shutdown, how long should we wait for in-flight tests to complete
+	// before cancelling them?
+	DrainTimeout time.Duration
+
 	// Should the testing, and the tests, be verbose?
 	Verbose bool
 
@@ -89,11 +132,83 @@ type workerCmd struct {
 	// Default period test threshold percentage, if not overridden by specific test setting
 	PeriodTestThreshold float32
 
+	// The address of the HTTP server exposing metrics and health, if any
+	HTTPAddress string
+
+	// Where the metrics of the tests are sent, e.g. graphite://carbon:2003, if anywhere
+	MetricsURL string
+
+	// How many tests can run at the same time against the same target, if > 0
+	MaxPerTarget int
+
+	// How many tests of each type can run at the same time, e.g. smtp=3,http=10
+	MaxPerType string
+
+	// What to do with tests over the limits: wait, or requeue
+	LimitAction string
+
+	// Should the limits be enforced across all the workers, via redis?
+	ClusterLimits bool
+
+	// In which order are the jobs of the different priorities read: weighted, or strict
+	PriorityOrder string
+
+	// The weights of the priorities, in the weighted order, e.g. high=6,normal=3,low=1
+	PriorityWeights string
+
+	// Should jobs be kept in a processing list until their results are published?
+	Reliable bool
+
+	// In reliable mode, after how long are the jobs of an unresponsive worker put back in the queue?
+	VisibilityTimeout time.Duration
+
+	// In reliable mode, or when reading from a stream, the unique identifier of this worker
+	WorkerID string
+
+	// If set, the location of this worker, whose jobs it reads before the shared ones
+	Location string
+
 	// The handle to our redis-server
 	_r *redis.Client
 
-	// The handle to our graphite-server
-	_g *graphite.Graphite
+	// Where jobs are read from
+	_q queue.Backend
+
+	// Where results are published
+	_results queue.ResultSink
+
+	// Where the metrics of the tests are sent, if anywhere
+	_sink metrics.Sink
+
+	// The metrics exposed via HTTP, if enabled
+	_m *workerMetrics
+
+	// What each worker is doing, exposed via HTTP if enabled
+	_slots *workerSlots
+
+	// Set once we've been asked to terminate
+	_draining int32
+
+	// Invoked once we've been asked to terminate, if set
+	_onDrain func()
+
+	// Keeps track of the alerting state of the tests, if any
+	_alerts alert.Store
+
+	// Keeps track of the failing labelled tests, for their dependencies
+	_dependencies alert.Dependencies
+
+	// Collects the results of the locations running the tests with a quorum
+	_consensus alert.Consensus
+
+	// The silences muting the notifications, if any
+	_silences *silence.Cache
+
+	// Where the results of the tests are kept, if enabled
+	_history *history.RedisStore
+
+	// Enforces the concurrency limits, if any
+	_limiter *limits.Limiter
 }
 
 //
@@ -107,48 +222,41 @@ func (*workerCmd) Usage() string {
 `
 }
 
-// MetricsFromEnvironment sets up a carbon connection from the environment
-// if suitable values are found
-func (p *workerCmd) MetricsFromEnvironment() {
+// setupMetricsSink sets up the sink the metrics of the tests are sent to,
+// if any.
+//
+// Without a metrics url, a graphite server is used if found in the
+// environment, like in the previous versions.
+func (p *workerCmd) setupMetricsSink() {
+	sinkURL := p.MetricsURL
 
-	//
-	// Get the hostname to connect to.
-	//
-	host := os.Getenv("METRICS_HOST")
-	if host == "" {
-		host = os.Getenv("METRICS")
-	}
+	if sinkURL == "" {
+		//
+		// Get the hostname to connect to.
+		//
+		host := os.Getenv("METRICS_HOST")
+		if host == "" {
+			host = os.Getenv("METRICS")
+		}
 
-	// No host then we'll return
-	if host == "" {
-		return
-	}
+		// No host then we'll return
+		if host == "" {
+			return
+		}
 
-	// Split the into Host + Port
-	ho, pr, err := net.SplitHostPort(host)
-	if err != nil {
-		// If that failed we assume the port was missing
-		ho = host
-		pr = "2003"
-	}
+		// Setup the protocol to use
+		protocol := os.Getenv("METRICS_PROTOCOL")
+		if protocol == "" {
+			protocol = "udp"
+		}
 
-	// Setup the protocol to use
-	protocol := os.Getenv("METRICS_PROTOCOL")
-	if protocol == "" {
-		protocol = "udp"
+		sinkURL = metrics.FormatGraphite + "+" + protocol + "://" + host
 	}
 
-	// Ensure that the port is an integer
-	port, err := strconv.Atoi(pr)
-	if err == nil {
-		p._g, err = graphite.GraphiteFactory(protocol, ho, port, "")
-
-		if err != nil {
-			fmt.Printf("Error setting up metrics - skipping - %s\n", err.Error())
-		}
-	} else {
-		fmt.Printf("Error setting up metrics - failed to convert port to number - %s\n", err.Error())
-
+	var err error
+	p._sink, err = metrics.NewSink(sinkURL)
+	if err != nil {
+		fmt.Printf("Error setting up metrics - skipping - %s\n", err.Error())
 	}
 }
 
@@ -175,18 +283,43 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 	defaults.Retry = true
 	defaults.RetryCount = 5
 	defaults.RetryDelay = 5 * time.Second
+	defaults.RetryBackoff = retry.BackoffFixed
+	defaults.RetryMaxDelay = 0
+	defaults.RetryJitter = 0
+	defaults.RetryOn = retry.ClassAll
 	defaults.MinDuration = 0
 	defaults.MinDurationCacheFactor = 10
 	defaults.DedupDuration = 0
+	defaults.FlapWindow = 0
+	defaults.FlapHighThreshold = 0.5
+	defaults.FlapLowThreshold = 0.25
+	defaults.SilencedAction = silencedActionMark
+	defaults.HistorySize = 0
+	defaults.HistoryRetention = 7 * 24 * time.Hour
+	defaults.QuorumWindow = time.Minute
 	defaults.Tag = ""
 	defaults.Timeout = 10 * time.Second
+	defaults.DrainTimeout = 30 * time.Second
 	defaults.Verbose = false
 	defaults.RedisHost = "localhost:6379"
 	defaults.RedisDB = 0
 	defaults.RedisPassword = ""
 	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Transport = queue.TransportList
 	defaults.PeriodTestSleep = 5 * time.Second
 	defaults.PeriodTestThreshold = 0
+	defaults.HTTPAddress = ""
+	defaults.MetricsURL = ""
+	defaults.MaxPerTarget = 0
+	defaults.MaxPerType = ""
+	defaults.LimitAction = limitActionWait
+	defaults.ClusterLimits = false
+	defaults.PriorityOrder = queue.OrderWeighted
+	defaults.PriorityWeights = ""
+	defaults.Reliable = false
+	defaults.VisibilityTimeout = 5 * time.Minute
+	defaults.WorkerID, _ = os.Hostname()
+	defaults.Location = ""
 
 	//
 	// If we have a configuration file then load it
@@ -220,16 +353,28 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 
 	// Timeout
 	f.DurationVar(&p.Timeout, "timeout", defaults.Timeout, "The global timeout for all tests, in seconds.")
+	f.DurationVar(&p.DrainTimeout, "drain-timeout", defaults.DrainTimeout, "On shutdown, how long to wait for running tests to complete before cancelling them.")
 
 	// Retry
 	f.BoolVar(&p.Retry, "retry", defaults.Retry, "Should failing tests be retried a few times before raising a notification.")
 	f.UintVar(&p.RetryCount, "retry-count", defaults.RetryCount, "How many times to retry a test, before regarding it as a failure.")
 	f.DurationVar(&p.RetryDelay, "retry-delay", defaults.RetryDelay, "The time to sleep between failing tests.")
+	f.StringVar(&p.RetryBackoff, "retry-backoff", defaults.RetryBackoff, "How the time to sleep between failing tests grows with the retries: fixed, linear, or exponential.")
+	f.DurationVar(&p.RetryMaxDelay, "retry-max-delay", defaults.RetryMaxDelay, "If set, the max time to sleep between failing tests.")
+	f.Var(utils.NewPercentageValue(defaults.RetryJitter, &p.RetryJitter), "retry-jitter", "The max random time added to the time to sleep between failing tests, as a percentage of it.")
+	f.StringVar(&p.RetryOn, "retry-on", defaults.RetryOn, "The comma-separated classes of errors which are retried: all, timeout, connection-refused, connection-reset, dns, or other.")
 
 	f.DurationVar(&p.DedupDuration, "dedup", defaults.DedupDuration, "The maximum duration of a deduplication.")
 	f.DurationVar(&p.MinDuration, "min-duration", defaults.MinDuration, "The minimum duration of an error, for it to generate an alert.")
 	f.UintVar(&p.MinDurationCacheFactor, "min-duration-cache-factor", defaults.MinDurationCacheFactor,
 		"The lifetime factor for a min-duration error, for it to be reset (e.g. min-duration=2sec, min-duration-cache-factor=10 -> if an error is thrown after 20sec, it will be again considered like a first-time error).")
+	f.UintVar(&p.FlapWindow, "flap-window", defaults.FlapWindow, "If set, how many results are used to detect whether a test is flapping.")
+	f.Var(utils.NewPercentageValue(defaults.FlapHighThreshold, &p.FlapHighThreshold), "flap-high-threshold", "The rate of state changes above which a test starts flapping.")
+	f.Var(utils.NewPercentageValue(defaults.FlapLowThreshold, &p.FlapLowThreshold), "flap-low-threshold", "The rate of state changes below which a flapping test stops flapping.")
+	f.UintVar(&p.HistorySize, "history", defaults.HistorySize, "If set, how many results of every test are kept in redis, for the history sub-command.")
+	f.DurationVar(&p.HistoryRetention, "history-retention", defaults.HistoryRetention, "After how long the history of a test which stopped running is forgotten.")
+	f.StringVar(&p.SilencedAction, "silenced-action", defaults.SilencedAction, "What to do with the results matching a silence: mark, or drop.")
+	f.DurationVar(&p.QuorumWindow, "quorum-window", defaults.QuorumWindow, "For how long the results of the locations running a test with a quorum are collected, before being forgotten.")
 
 	// Redis
 	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
@@ -237,6 +382,31 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
 	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
 	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.StringVar(&p.Transport, "transport", defaults.Transport, "How jobs and results are exchanged via redis: list, or stream.")
+
+	// Reliable consumption
+	f.BoolVar(&p.Reliable, "reliable", defaults.Reliable, "Keep jobs in a per-worker processing list until their results are published, so that they are not lost if the worker dies.")
+	f.DurationVar(&p.VisibilityTimeout, "visibility-timeout", defaults.VisibilityTimeout, "In reliable mode, or when reading jobs from a stream, after how long the jobs of an unresponsive worker are given to other workers.")
+	f.StringVar(&p.WorkerID, "worker-id", defaults.WorkerID, "In reliable mode, or when reading jobs from a stream, the identifier of this worker, which must be unique across all the workers.")
+
+	// Location
+	f.StringVar(&p.Location, "location", defaults.Location, "If set, the location of this worker (e.g. eu), which also executes the tests which must run from there.")
+
+	// Priorities
+	f.StringVar(&p.PriorityOrder, "priority-order", defaults.PriorityOrder, "In which order the jobs of the different priorities are read: weighted, or strict.")
+	f.StringVar(&p.PriorityWeights, "priority-weights", defaults.PriorityWeights, "The weights of the priorities in the weighted order (default high=6,normal=3,low=1).")
+
+	// Concurrency limits
+	f.IntVar(&p.MaxPerTarget, "max-per-target", defaults.MaxPerTarget, "If set, how many tests can run at the same time against the same target.")
+	f.StringVar(&p.MaxPerType, "max-per-type", defaults.MaxPerType, "How many tests of each type can run at the same time (e.g. smtp=3,http=10).")
+	f.StringVar(&p.LimitAction, "limit-action", defaults.LimitAction, "What to do with tests over the concurrency limits: wait, or requeue.")
+	f.BoolVar(&p.ClusterLimits, "cluster-limits", defaults.ClusterLimits, "Enforce the concurrency limits across all the workers, via redis.")
+
+	// HTTP
+	f.StringVar(&p.HTTPAddress, "http-address", defaults.HTTPAddress, "If set, the address of the HTTP server exposing /metrics, /healthz, /readyz and /debug/workers (e.g. :9090).")
+
+	// Metrics
+	f.StringVar(&p.MetricsURL, "metrics-url", defaults.MetricsURL, "If set, where the metrics of the tests are sent: graphite, graphite-tagged, statsd, dogstatsd, or influx URL (e.g. influx+tcp://influxdb:8089).")
 
 	// Tag
 	f.StringVar(&p.Tag, "tag", defaults.Tag, "Specify the tag to add to all test-results.")
@@ -247,30 +417,50 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 }
 
 // notify is used to store the result of a test in our redis queue.
-func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultError error, details *string) error {
+//
+// The measurements, if any, are what the test observed while running, and
+// the duration how long it took, including retries.
+func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultError error, details *string, measurements test.Measurements, duration time.Duration) error {
 
 	//
-	// If we don't have a redis-server then return immediately.
+	// If we don't have a results queue then return immediately.
 	//
-	// (This shouldn't happen, as without a redis-handle we can't
+	// (This shouldn't happen, as without a queue we can't
 	// fetch jobs to execute.)
 	//
-	if p._r == nil {
+	if p._results == nil {
 		return nil
 	}
 
+	testResult := p.newResult(testDefinition, uniqueHash, resultError, details, measurements)
+
+	// Keep every result in the history, whether notified or not
+	p.recordHistory(testResult, duration)
+
+	return p.publish(testDefinition, testResult)
+}
+
+// newResult creates the result of a test.
+func (p *workerCmd) newResult(testDefinition test.Test, uniqueHash *string, resultError error, details *string, measurements test.Measurements) *test.Result {
+
 	//
 	// The message we'll publish will be a JSON hash
 	//
 	testResult := &test.Result{
-		Input:      testDefinition.Input,
-		Target:     testDefinition.Target,
-		Time:       time.Now().Unix(),
-		Type:       testDefinition.Type,
-		Tag:        p.Tag,
-		Details:    details,
-		UniqueHash: uniqueHash,
-		TestLabel:  testDefinition.TestLabel,
+		Input:        testDefinition.Input,
+		Target:       testDefinition.Target,
+		Time:         time.Now().Unix(),
+		Type:         testDefinition.Type,
+		Tag:          p.Tag,
+		Details:      details,
+		UniqueHash:   uniqueHash,
+		TestLabel:    testDefinition.TestLabel,
+		Measurements: measurements,
+	}
+
+	// Tests run from specific locations have a result per location
+	if len(testDefinition.RunFrom) > 0 {
+		testResult.Location = p.Location
 	}
 
 	//
@@ -283,147 +473,34 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 		testResult.Error = &errorString
 	}
 
-	now := time.Now()
-
-	// If test has a min duration rule, avoid triggering a notification if not needed, or clean the min duration cache if needed.
-	if testDefinition.MinDuration != nil {
-		minDurationSeconds := int64(*testDefinition.MinDuration / time.Second)
-
-		// We need a minimum cache duration, otherwise the min duration test cannot work
-		if testDefinition.MinDurationCacheFactor == 0 {
-			testDefinition.MinDurationCacheFactor = 2
-		}
-
-		hash := testResult.Hash()
-		firstErrorTime := p.getMinDurationFirstErrorTime(hash)
-		testResult.FirstErrorTime = firstErrorTime
-
-		expireDuration := *testDefinition.MinDuration * time.Duration(testDefinition.MinDurationCacheFactor)
-
-		if testResult.Error != nil {
-
-			// With minDuration, we don't want to trigger the notification, unless the test has failed for a long enough amount of time
-			if firstErrorTime != nil {
-				diffFirstError := now.Unix() - *firstErrorTime
-
-				// We want to keep the ORIGINAL error time as alert shown, just extend the expiry time
-				p.setMinDurationFirstErrorTime(hash, *firstErrorTime, expireDuration)
-
-				if diffFirstError < minDurationSeconds {
-					// There is no need to trigger the notification, because not enough time has passed since the error got fired
-					p.verbose(fmt.Sprintf("Skipping notification (minDuration, alert shown %s ago) for test `%s` (%s)\n",
-						time.Duration(diffFirstError)*time.Second,
-						testDefinition.Input, testDefinition.Target))
-					return nil
-				}
-
-				// Let's show the alert!
-				// Mark it as shown
-				p.setMinDurationAlertShown(hash, true, expireDuration)
-
-			} else {
-				p.setMinDurationFirstErrorTime(hash, now.Unix(), expireDuration)
-
-				// Do not throw alert here, because this is the first generated alert
-				return nil
-			}
-
-		} else {
-			// Check if there was any min duration cache
-
-			if firstErrorTime != nil {
-				diffFirstError := now.Unix() - *firstErrorTime
-
-				alertShown := p.getMinDurationAlertShown(hash)
-
-				// Clear the cache because test got resolved
-				p.clearMinDurationFirstErrorTime(hash)
-				p.clearMinDurationAlertShown(hash)
-				testResult.Recovered = true
-
-				// If the error has never been triggered, because min duration did not expire, do not trigger a recovered message
-				if diffFirstError < minDurationSeconds {
-					p.verbose(fmt.Sprintf("Test recovered (min duration not met, skipping recovered message): `%s` (%s)\n",
-						testDefinition.Input, testDefinition.Target))
-					return nil
-				}
-
-				// Check if we want to show the recovered message
-				if !alertShown {
-					p.verbose(fmt.Sprintf("Test recovered (alert not shown, skipping recovered message): `%s` (%s)\n",
-						testDefinition.Input, testDefinition.Target))
-
-					return nil
-				}
-
-				p.verbose(fmt.Sprintf("Test recovered (min duration cache cleared, showing recovered message): `%s` (%s)\n",
-					testDefinition.Input, testDefinition.Target))
-
-			} else {
-
-				/*
-					If we're here, a recovered message got generated for an error that has never been seen.
-					Skip it, as it is probably a broken test.
-				*/
-
-				p.verbose(fmt.Sprintf("Test recovered (min duration not met, original error never seen): `%s` (%s)\n",
-					testDefinition.Input, testDefinition.Target))
-				return nil
-
-			}
-
-		}
+	return testResult
+}
 
+// publish applies the quorum, dependencies, alert rules and silences of a
+// test to its result, and publishes it to the results queue, unless any of
+// them holds it back.
+func (p *workerCmd) publish(testDefinition test.Test, testResult *test.Result) error {
+	if p._results == nil {
+		return nil
 	}
 
-	// If test has a deduplication rule, avoid re-triggering a notification if not needed, or clean the dedup cache if needed.
-	if testDefinition.DedupDuration != nil {
-
-		hash := testResult.Hash()
-		if testResult.Error != nil {
-
-			// Save the current notification time, this keeps alive the deduplication. *10 so that it's not going to expire
-			// anytime soon.
-			p.setDeduplicationCacheTime(hash, *testDefinition.DedupDuration*10)
-
-			lastAlertTime := p.getDeduplicationLastAlertTime(hash)
-
-			// With dedup, we don't want to trigger same notification, unless we just passed the dedup duration
-			if lastAlertTime != nil {
-				diffLastAlert := now.Unix() - *lastAlertTime
-				dedupDurationSeconds := int64(*testDefinition.DedupDuration / time.Second)
-
-				if diffLastAlert < dedupDurationSeconds {
-					// There is no need to trigger the notification, because not enough time has passed since the last one
-					p.verbose(fmt.Sprintf("Skipping notification (dedup, last notif %s ago) for test `%s` (%s)\n",
-						time.Duration(diffLastAlert)*time.Second,
-						testDefinition.Input, testDefinition.Target))
-					return nil
-				}
-
-				// Let the user know that the generated notification is a duplicate
-				testResult.IsDedup = true
-			}
+	// Wait for enough locations to agree, if the test has a quorum
+	if !p.applyQuorum(testDefinition, testResult) {
+		return nil
+	}
 
-			p.setDeduplicationLastAlertTime(hash, *testDefinition.DedupDuration*10)
+	// Suppress the failure if the test it depends on is failing, in which
+	// case it does not count for the alerting state of the test either
+	p.applyDependencies(testDefinition, testResult)
 
-		} else {
-			// Check if a dedup was happening
-			dedupCacheTime := p.getDeduplicationCacheTime(hash)
-
-			// If there was a dedup cache time, we can mark this test as recovered
-			if dedupCacheTime != nil {
-				// Clear any dedup cache, because the test has passed
-				p.clearDeduplicationCacheTime(hash)
-				p.clearDeduplicationLastAlertTime(hash)
-				testResult.Recovered = true
-
-				p.verbose(fmt.Sprintf("Test recovered (dedup cache cleared): `%s` (%s)\n",
-					testDefinition.Input, testDefinition.Target))
-			}
-
-		}
+	// Apply the min duration and deduplication rules, if any
+	if testResult.SuppressedBy == "" && !p.applyAlertRules(testDefinition, testResult) {
+		return nil
+	}
 
+	// Mute the result, if silenced
+	if !p.applySilences(testDefinition, testResult) {
+		return nil
 	}
 
 	//
@@ -438,7 +515,7 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 	//
 	// Publish the message to the queue.
 	//
-	_, err = p._r.RPush("overseer.results", j).Result()
+	err = p._results.Publish(string(j))
 	if err != nil {
 		fmt.Printf("Result addition failed: %s\n", err)
 		return err
@@ -447,255 +524,171 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 	return nil
 }
 
-func (p *workerCmd) getDeduplicationCacheKey(hash string) string {
-	return fmt.Sprintf("overseer.dedup-cache.%s", hash)
-}
-
-func (p *workerCmd) getDeduplicationCacheTime(hash string) *int64 {
-	if p._r == nil {
-		return nil
+// testMetrics returns the metrics of a test run against the given
+// target, e.g. its duration.
+//
+// The hierarchical names are overseer.test.$testType.$testTarget.$key,
+// except for the DNS-test, whose natural target is the name to lookup
+// rather than the nameserver.
+func (p *workerCmd) testMetrics(tst test.Test, target string, values map[string]float64) []metrics.Point {
+	tags := map[string]string{
+		"type":   tst.Type,
+		"target": tst.Target,
+		"ip":     target,
+		"tag":    p.Tag,
 	}
-
-	cacheKey := p.getDeduplicationCacheKey(hash)
-	cacheTime, err := p._r.Get(cacheKey).Int64()
-	if err != nil {
-		if err == redis.Nil {
-			// Key just does not exist
-			return nil
-		}
-
-		fmt.Printf("Failed to get dedup cache key: %s\n", err)
-		return nil
+	if tst.TestLabel != nil {
+		tags["test_label"] = *tst.TestLabel
+	}
+	if p.Location != "" {
+		tags["location"] = p.Location
 	}
 
-	return &cacheTime
-}
-
-func (p *workerCmd) setDeduplicationCacheTime(hash string, expiry time.Duration) {
-	if p._r == nil {
-		return
+	path := []string{tst.Type, tst.Target}
+	if tst.Type == "dns" {
+		tags["lookup"] = tst.Arguments["lookup"]
+		path = []string{tst.Type, tst.Arguments["lookup"]}
 	}
 
-	cacheKey := p.getDeduplicationCacheKey(hash)
-	_, err := p._r.Set(cacheKey, time.Now().Unix(), expiry).Result()
-	if err != nil {
-		fmt.Printf("Failed to set dedup cache key: %s\n", err)
+	var points []metrics.Point
+	for key, value := range values {
+		points = append(points, metrics.NewPoint("test", path, key, value, tags))
 	}
+	return points
 }
 
-func (p *workerCmd) clearDeduplicationCacheTime(hash string) {
-	if p._r == nil {
-		return
+// runProbe executes a single run of the given protocol-test, enforcing
+// the test timeout as a hard deadline.
+//
+// Well-behaved protocol-tests give up by themselves once the context is
+// done, but a stuck one must not hold the worker forever, so if it fails
+// to return in time we report a timeout and leave it behind.
+func (p *workerCmd) runProbe(ctx context.Context, handler protocols.ProtocolTest, tst test.Test, target string, opts test.Options) (*protocols.ProbeOutcome, error) {
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
 	}
 
-	cacheKey := p.getDeduplicationCacheKey(hash)
-	_, err := p._r.Del(cacheKey).Result()
-	if err != nil {
-		fmt.Printf("Failed to clear dedup cache key: %s\n", err)
+	type probeResult struct {
+		outcome *protocols.ProbeOutcome
+		err     error
 	}
-}
-
-func (p *workerCmd) getDeduplicationLastAlertKey(hash string) string {
-	return fmt.Sprintf("overseer.dedup-last-alert.%s", hash)
-}
 
-func (p *workerCmd) getDeduplicationLastAlertTime(hash string) *int64 {
-	if p._r == nil {
-		return nil
-	}
+	// Buffered, so that a late probe can still complete and be collected.
+	resultChan := make(chan probeResult, 1)
+	go func() {
+		outcome, err := protocols.Probe(ctx, handler, tst, target, opts)
+		resultChan <- probeResult{outcome, err}
+	}()
 
-	cacheKey := p.getDeduplicationLastAlertKey(hash)
-	cacheTime, err := p._r.Get(cacheKey).Int64()
-	if err != nil {
-		if err == redis.Nil {
-			// Key just does not exist
-			return nil
+	select {
+	case result := <-resultChan:
+		return result.outcome, result.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("test timed out after %s", opts.Timeout)
 		}
-
-		fmt.Printf("Failed to get dedup last alert key: %s\n", err)
-		return nil
+		return nil, fmt.Errorf("test cancelled: %s", ctx.Err())
 	}
-
-	return &cacheTime
 }
 
-func (p *workerCmd) setDeduplicationLastAlertTime(hash string, expiry time.Duration) {
-	if p._r == nil {
-		return
-	}
-
-	cacheKey := p.getDeduplicationLastAlertKey(hash)
-	_, err := p._r.Set(cacheKey, time.Now().Unix(), expiry).Result()
-	if err != nil {
-		fmt.Printf("Failed to set dedup last alert key: %s\n", err)
+// sleep pauses for the given duration, returning false if the context
+// got cancelled in the meantime.
+func (p *workerCmd) sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
-func (p *workerCmd) clearDeduplicationLastAlertTime(hash string) {
-	if p._r == nil {
-		return
-	}
-
-	cacheKey := p.getDeduplicationLastAlertKey(hash)
-	_, err := p._r.Del(cacheKey).Result()
-	if err != nil {
-		fmt.Printf("Failed to clear dedup last alert key: %s\n", err)
+// validateRetry makes sure the global retry settings are valid.
+func (p *workerCmd) validateRetry() error {
+	if err := retry.ValidateBackoff(p.RetryBackoff); err != nil {
+		return err
 	}
+	_, err := retry.ParseClasses(p.RetryOn)
+	return err
 }
 
-func (p *workerCmd) getMinDurationFirstErrorKey(hash string) string {
-	return fmt.Sprintf("overseer.min-duration-first-error.%s", hash)
-}
-
-func (p *workerCmd) getMinDurationFirstErrorTime(hash string) *int64 {
-	if p._r == nil {
-		return nil
-	}
-
-	cacheKey := p.getMinDurationFirstErrorKey(hash)
-	cacheTime, err := p._r.Get(cacheKey).Int64()
+// priorityOrder returns the order in which the jobs of the different
+// priorities are read.
+func (p *workerCmd) priorityOrder() (queue.PriorityOrder, error) {
+	weights, err := queue.ParseWeights(p.PriorityWeights)
 	if err != nil {
-		if err == redis.Nil {
-			// Key just does not exist
-			return nil
-		}
-
-		fmt.Printf("Failed to get min-duration alert shown key: %s\n", err)
-		return nil
+		return queue.PriorityOrder{}, err
 	}
 
-	return &cacheTime
-}
-
-func (p *workerCmd) setMinDurationFirstErrorTime(hash string, errorTime int64, expiry time.Duration) {
-	if p._r == nil {
-		return
-	}
-
-	cacheKey := p.getMinDurationFirstErrorKey(hash)
-	_, err := p._r.Set(cacheKey, errorTime, expiry).Result()
-	if err != nil {
-		fmt.Printf("Failed to set min-duration alert shown key: %s\n", err)
+	order := queue.PriorityOrder{
+		Order:   p.PriorityOrder,
+		Weights: weights,
 	}
+	return order, order.Validate()
 }
 
-func (p *workerCmd) clearMinDurationFirstErrorTime(hash string) {
-	if p._r == nil {
-		return
+// retryPolicy returns how the given test is retried, applying its
+// overrides to the global settings.
+func (p *workerCmd) retryPolicy(tst test.Test) retry.Policy {
+	policy := retry.Policy{
+		Delay:    p.RetryDelay,
+		Backoff:  p.RetryBackoff,
+		MaxDelay: p.RetryMaxDelay,
+		Jitter:   p.RetryJitter,
 	}
+	policy.On, _ = retry.ParseClasses(p.RetryOn)
 
-	cacheKey := p.getMinDurationFirstErrorKey(hash)
-	_, err := p._r.Del(cacheKey).Result()
-	if err != nil {
-		fmt.Printf("Failed to clear min-duration alert shown key: %s\n", err)
+	if tst.RetryDelay != nil {
+		policy.Delay = *tst.RetryDelay
 	}
-}
-
-func (p *workerCmd) getMinDurationAlertShownKey(hash string) string {
-	return fmt.Sprintf("overseer.min-duration-alert-shown.%s", hash)
-}
-
-func (p *workerCmd) getMinDurationAlertShown(hash string) bool {
-	if p._r == nil {
-		return false
+	if tst.RetryBackoff != "" {
+		policy.Backoff = tst.RetryBackoff
 	}
-
-	cacheKey := p.getMinDurationAlertShownKey(hash)
-	alertShown, err := p._r.Get(cacheKey).Int64()
-	if err != nil {
-		if err == redis.Nil {
-			// Key just does not exist
-			return false
-		}
-
-		fmt.Printf("Failed to get min-duration alert shown key: %s\n", err)
-		return false
+	if tst.RetryMaxDelay != nil {
+		policy.MaxDelay = *tst.RetryMaxDelay
 	}
-
-	return alertShown > 0
-}
-
-func (p *workerCmd) setMinDurationAlertShown(hash string, shown bool, expiry time.Duration) {
-	if p._r == nil {
-		return
+	if tst.RetryJitter != nil {
+		policy.Jitter = *tst.RetryJitter
 	}
-
-	alertShown := 0
-	if shown {
-		alertShown = 1
+	if tst.RetryOn != nil {
+		policy.On = tst.RetryOn
 	}
 
-	cacheKey := p.getMinDurationAlertShownKey(hash)
-	_, err := p._r.Set(cacheKey, alertShown, expiry).Result()
-	if err != nil {
-		fmt.Printf("Failed to set min-duration alert shown key: %s\n", err)
-	}
+	return policy
 }
 
-func (p *workerCmd) clearMinDurationAlertShown(hash string) {
-	if p._r == nil {
-		return
+// lookupIP resolves the given hostname, giving up once the timeout expires
+// or the context gets cancelled.
+func (p *workerCmd) lookupIP(ctx context.Context, host string, timeout time.Duration) ([]net.IPAddr, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	cacheKey := p.getMinDurationAlertShownKey(hash)
-	_, err := p._r.Del(cacheKey).Result()
-	if err != nil {
-		fmt.Printf("Failed to clear min-duration alert shown key: %s\n", err)
-	}
-}
-
-// alphaNumeric removes all non alpha-numeric characters from the
-// given string, and returns it.  We replace the characters that
-// are invalid with `_`.
-func (p *workerCmd) alphaNumeric(input string) string {
-	//
-	// Remove non alphanumeric
-	//
-	reg, err := regexp.Compile("[^A-Za-z0-9]+")
-	if err != nil {
-		panic(err)
-	}
-	return reg.ReplaceAllString(input, "_")
-}
-
-// formatMetrics Format a test for metrics submission.
-//
-// This is a little weird because ideally we'd want to submit to the
-// metrics-host :
-//
-//    overseer.$testType.$testTarget.$key => value
-//
-// But of course the target might not be what we think it is for all
-// cases - i.e. A DNS test the target is the name of the nameserver rather
-// than the thing to lookup, which is the natural target.
-//
-func (p *workerCmd) formatMetrics(tst test.Test, key string) string {
-
-	prefix := "overseer.test."
-
-	//
-	// Special-case for the DNS-test
-	//
-	if tst.Type == "dns" {
-		return prefix + ".dns." + p.alphaNumeric(tst.Arguments["lookup"]) + "." + key
-	}
-
-	//
-	// Otherwise we have a normal test.
-	//
-	return prefix + tst.Type + "." + p.alphaNumeric(tst.Target) + "." + key
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
 }
 
 // runTest is really the core of our application, as it is responsible
 // for receiving a test to execute, executing it, and then issuing
 // the notification with the result.
-func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) error {
+//
+// If the context is cancelled, e.g. because the worker is shutting down,
+// running tests are aborted and no notification is issued for them.
+func (p *workerCmd) runTest(ctx context.Context, workerIdx uint, tst test.Test, opts test.Options) error {
 
 	workerPrefix := fmt.Sprintf("[W%d] ", workerIdx)
 
-	// Create a map for metric-recording.
+	// The per-test timeout, if any, overrides the worker one.
+	if tst.Timeout != nil {
+		opts.Timeout = *tst.Timeout
+	}
+
+	// Create a list for metric-recording.
 	metricsLock := new(sync.Mutex)
-	metrics := map[string]string{}
+	var points []metrics.Point
 
 	// If there are no deduplication rules, assign the default worker one. Unless the test is a period-test
 	if tst.DedupDuration == nil && tst.PeriodTestDuration == nil && p.DedupDuration > 0 {
@@ -715,6 +708,17 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		tst.MinDurationCacheFactor = p.MinDurationCacheFactor
 	}
 
+	// If there are no flap detection rules, assign the default worker ones. Unless the test is a period-test
+	if tst.FlapWindow == nil && tst.PeriodTestDuration == nil && p.FlapWindow > 0 {
+		tst.FlapWindow = &p.FlapWindow
+	}
+	if tst.FlapHighThreshold == nil {
+		tst.FlapHighThreshold = &p.FlapHighThreshold
+	}
+	if tst.FlapLowThreshold == nil {
+		tst.FlapLowThreshold = &p.FlapLowThreshold
+	}
+
 	//
 	// Setup our local state.
 	//
@@ -726,6 +730,18 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 	//
 	tmp := protocols.ProtocolHandler(testType)
 
+	//
+	// Resolve the references to secrets, which only the probes see.
+	//
+	probeTst, err := p.resolveSecrets(tst)
+	if err != nil {
+		tst.Input = tst.Sanitize()
+		p.notify(tst, nil, err, nil, nil, 0)
+
+		fmt.Printf(workerPrefix+"WARNING: Failed to resolve the secrets of %s test against %s: %s\n", testType, testTarget, err.Error())
+		return err
+	}
+
 	//
 	// Each test will be executed for each address-family, so we need to
 	// keep track of the IPs of the real test-target.
@@ -751,9 +767,14 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		timeA := time.Now()
 
 		// Now resolve the target to IPv4 & IPv6 addresses.
-		ips, err := net.LookupIP(testTarget)
+		ips, err := p.lookupIP(ctx, testTarget, opts.Timeout)
 		if err != nil {
 
+			// Do not report a failure if we're just shutting down.
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
 			//
 			// We failed to resolve the target, so we have to raise
 			// a failure.  But before we do that we need to sanitize
@@ -764,7 +785,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 			//
 			// Notify the world about our DNS-failure.
 			//
-			p.notify(tst, nil, fmt.Errorf("failed to resolve name %s", testTarget), nil)
+			p.notify(tst, nil, fmt.Errorf("failed to resolve name %s", testTarget), nil, nil, time.Since(timeA))
 
 			//
 			// Otherwise we're done.
@@ -776,12 +797,16 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		// Calculate the time the DNS-resolution took - in milliseconds.
 		timeB := time.Now()
 		duration := timeB.Sub(timeA)
-		diff := fmt.Sprintf("%f", float64(duration)/float64(time.Millisecond))
+		diff := float64(duration) / float64(time.Millisecond)
 
-		// Record time in our metric hash
+		// Record time in our metrics
 		metricsLock.Lock()
-		metrics["overseer.dns."+p.alphaNumeric(testTarget)+".duration"] = diff
+		points = append(points, metrics.NewPoint("dns", []string{testTarget}, "duration", diff, map[string]string{
+			"target": testTarget,
+			"tag":    p.Tag,
+		}))
 		metricsLock.Unlock()
+		p._m.dnsResolved(testTarget, duration)
 
 		//
 		// We'll run the test against each of the resulting IPv4 and
@@ -789,7 +814,8 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		//
 		// Save the results in our `targets` array, unless disabled.
 		//
-		for _, ip := range ips {
+		for _, ipAddr := range ips {
+			ip := ipAddr.IP
 			if ip.To4() != nil {
 				if p.IPv4 {
 					targets = append(targets, ip.String())
@@ -813,7 +839,20 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		targets = targets[:tst.MaxTargetsCount]
 	}
 
-	testEndFn := func(startTime time.Time, target string, attempts uint, result error, details *string) {
+	// The results of a test with a quorum, against each target
+	votesLock := new(sync.Mutex)
+	var votes []*test.Result
+
+	testEndFn := func(startTime time.Time, target string, attempts uint, result error, details *string, outcome *protocols.ProbeOutcome) {
+		//
+		// If we got cancelled the result is meaningless, so do not
+		// raise any notification about it.
+		//
+		if ctx.Err() != nil {
+			fmt.Printf(workerPrefix+"Test '%s' against %s cancelled: %s\n", testType, target, ctx.Err())
+			return
+		}
+
 		//
 		// Now the test is complete we can record the time it
 		// took to carry out, and the number of attempts it
@@ -821,11 +860,13 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		//
 		timeB := time.Now()
 		duration := timeB.Sub(startTime)
-		diff := fmt.Sprintf("%f", float64(duration)/float64(time.Millisecond))
+		values := outcome.Measurements().Numbers()
+		values["duration"] = float64(duration) / float64(time.Millisecond)
+		values["attempts"] = float64(attempts)
 		metricsLock.Lock()
-		metrics[p.formatMetrics(tst, "duration")] = diff
-		metrics[p.formatMetrics(tst, "attempts")] = fmt.Sprintf("%d", attempts)
+		points = append(points, p.testMetrics(tst, target, values)...)
 		metricsLock.Unlock()
+		p._m.testCompleted(tst, target, duration, attempts, result)
 
 		//
 		// Post the result of the test to the notifier.
@@ -843,6 +884,9 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		//
 		tstCopy := tst
 		tstCopy.Target = target
+		if tmp.ShouldResolveHostname() {
+			tstCopy.ResolvedFrom = testTarget
+		}
 
 		//
 		// We also want to filter out any password which was found
@@ -850,11 +894,28 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		//
 		tstCopy.Input = tst.Sanitize()
 
+		uniqueHash := tmp.GetUniqueHashForTest(tstCopy, opts)
+
+		//
+		// The results against the different addresses of a test with
+		// a quorum are a single vote of this location, cast once they
+		// are all known.
+		//
+		if p.hasQuorum(tst) {
+			testResult := p.newResult(tstCopy, uniqueHash, result, details, outcome.Measurements())
+			p.recordHistory(testResult, duration)
+
+			votesLock.Lock()
+			votes = append(votes, testResult)
+			votesLock.Unlock()
+			return
+		}
+
 		//
 		// Now we can trigger the notification with our updated
 		// copy of the test.
 		//
-		p.notify(tstCopy, tmp.GetUniqueHashForTest(tstCopy, opts), result, details)
+		p.notify(tstCopy, uniqueHash, result, details, outcome.Measurements(), duration)
 	}
 
 	wg := &sync.WaitGroup{}
@@ -863,8 +924,11 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 	// Now for each target, run the test.
 	//
 	for _, target := range targets {
+		target := target
 		wg.Add(1)
 		go func() {
+			p._m.testStarted(tst)
+			defer p._m.testStopped(tst)
 
 			// Is this a period test?
 			if tst.PeriodTestDuration != nil {
@@ -889,7 +953,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 
 				iteration := 0
 				var errorStrings []string
-				for time.Now().Before(timeEnd) {
+				for time.Now().Before(timeEnd) && ctx.Err() == nil {
 					iteration++
 					iterationStartTime := time.Now()
 
@@ -897,7 +961,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 					currentOpts := opts
 					currentOpts.PeriodTestIndex = iteration
 					currentOpts.PeriodTestStartTime = iterationStartTime.UnixNano() / int64(time.Millisecond)
-					err := tmp.RunTest(tst, target, currentOpts)
+					_, err := p.runProbe(ctx, tmp, probeTst, target, currentOpts)
 
 					iterationDuration := time.Since(iterationStartTime)
 					iterationElapsedString := fmt.Sprintf("%.2fms", float64(iterationDuration)/float64(time.Millisecond))
@@ -911,7 +975,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 						p.verbose(fmt.Sprintf(workerPrefix+"Period-test (test %d success, took %s)\n", iteration, iterationElapsedString))
 					}
 
-					time.Sleep(periodTestSleep)
+					p.sleep(ctx, periodTestSleep)
 				}
 
 				totalAttempts := countFail + countSuccess
@@ -934,7 +998,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 					p.verbose(fmt.Sprintf(workerPrefix+"Test passed: %d tests failed out of %d (%.2f%%)\n", countFail, totalAttempts, errPercentage*100))
 				}
 
-				testEndFn(timeStart, target, totalAttempts, result, failuresString)
+				testEndFn(timeStart, target, totalAttempts, result, failuresString, nil)
 				wg.Done()
 				return
 			}
@@ -946,6 +1010,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 			//
 			var attempt uint = 0
 			var maxAttempts uint = p.RetryCount
+			policy := p.retryPolicy(tst)
 
 			//
 			// If retrying is disabled then don't retry.
@@ -962,6 +1027,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 			// The result of the test.
 			//
 			var result error
+			var outcome *protocols.ProbeOutcome
 
 			//
 			// Record the start-time of the test.
@@ -989,7 +1055,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 				//
 				// Run the test
 				//
-				result = tmp.RunTest(tst, target, opts)
+				outcome, result = p.runProbe(ctx, tmp, probeTst, target, opts)
 
 				//
 				// If the test passed then we're good.
@@ -1000,6 +1066,12 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 					// break out of loop
 					attempt = maxAttempts + 1
 
+				} else if !policy.ShouldRetry(result) {
+					p.verbose(fmt.Sprintf(workerPrefix+"[%d/%d] Test failed, not retrying %s errors: %s\n", attempt, maxAttempts, retry.Classify(result), result.Error()))
+
+					// break out of loop
+					attempt = maxAttempts + 1
+
 				} else {
 
 					//
@@ -1015,20 +1087,36 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 						//
 						// Sleep before retrying the failing test.
 						//
-						p.verbose(fmt.Sprintf(workerPrefix+"Sleeping for %s before retrying\n", p.RetryDelay.String()))
+						delay := policy.DelayBefore(attempt)
+						p.verbose(fmt.Sprintf(workerPrefix+"Sleeping for %s before retrying\n", delay.String()))
 
-						time.Sleep(p.RetryDelay)
+						if !p.sleep(ctx, delay) {
+							break
+						}
 					}
 				}
 			}
 
-			testEndFn(timeA, target, c, result, nil)
+			testEndFn(timeA, target, c, result, nil, outcome)
 			wg.Done()
 		}()
 	}
 
 	wg.Wait()
 
+	//
+	// Cast the vote of this location, unless some of the targets got
+	// cancelled, as it would be missing their results.
+	//
+	if len(votes) > 0 && ctx.Err() == nil {
+		quorumTst := tst
+		quorumTst.Input = tst.Sanitize()
+		if tmp.ShouldResolveHostname() {
+			quorumTst.ResolvedFrom = testTarget
+		}
+		p.publish(quorumTst, mergeVotes(votes))
+	}
+
 	//
 	// If we have a metric-host we can now submit each of the values
 	// to it.
@@ -1042,14 +1130,15 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 	//  3.  The number of attempts (retries, really) before the
 	//      test was completed.
 	//
-	if p._g != nil {
-		for key, val := range metrics {
-			v := os.Getenv("METRICS_VERBOSE")
-			if v != "" {
-				fmt.Printf("%s %s\n", key, val)
+	if p._sink != nil && len(points) > 0 {
+		if os.Getenv("METRICS_VERBOSE") != "" {
+			for _, point := range points {
+				fmt.Printf("%s %f %v\n", point.Name, point.Value, point.Tags)
 			}
+		}
 
-			p._g.SimpleSend(key, val)
+		if err := p._sink.Send(points); err != nil {
+			fmt.Printf("Failed to send the metrics: %s\n", err.Error())
 		}
 	}
 
@@ -1059,13 +1148,40 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 //
 // Entry-point.
 //
-func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (p *workerCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 
 	// Sanity check
 	if p.Parallel == 0 {
 		fmt.Printf("Number of parallel workers must be > 0")
 		return subcommands.ExitFailure
 	}
+	if err := p.validateRetry(); err != nil {
+		fmt.Printf("Invalid retry settings: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if err := p.validateLimits(); err != nil {
+		fmt.Printf("Invalid concurrency limits: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if err := p.validateFlapping(); err != nil {
+		fmt.Printf("Invalid flap detection settings: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if err := p.validateSilences(); err != nil {
+		fmt.Printf("Invalid silences settings: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	priority, err := p.priorityOrder()
+	if err != nil {
+		fmt.Printf("Invalid priorities: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if p.Location != "" {
+		if err = queue.ValidateLocation(p.Location); err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
 
 	//
 	// Connect to the redis-host.
@@ -1090,16 +1206,94 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	//
 	// And run a ping, just to make sure it worked.
 	//
-	_, err := p._r.Ping().Result()
+	_, err = p._r.Ping().Result()
 	if err != nil {
 		fmt.Printf("Redis connection failed: %s\n", err.Error())
 		return subcommands.ExitFailure
 	}
 
+	if p.Transport == queue.TransportStream && p.Reliable {
+		// Jobs read from a stream are acknowledged anyway
+		fmt.Printf("Reliable mode is implied when reading jobs from a stream\n")
+		p.Reliable = false
+	}
+	if (p.Reliable || p.Transport == queue.TransportStream) && p.WorkerID == "" {
+		fmt.Printf("A worker-id is required in reliable mode\n")
+		return subcommands.ExitFailure
+	}
+
+	//
+	// In reliable mode, any job left behind by a previous run is
+	// recovered, and the ones left behind by other workers are
+	// reaped.
+	//
+	backend, err := queue.NewRedisBackend(p._r, queue.RedisOptions{
+		Transport:         p.Transport,
+		Reliable:          p.Reliable,
+		VisibilityTimeout: p.VisibilityTimeout,
+		Priority:          priority,
+		Location:          p.Location,
+	})
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	defer backend.Close()
+
+	return p.run(ctx, backend)
+}
+
+//
+// run executes the jobs of the given backend, until terminated.
+//
+func (p *workerCmd) run(ctx context.Context, backend queue.Backend) subcommands.ExitStatus {
+	var err error
+
+	p._q = backend
+	p._results, err = backend.Results(queue.ResultsKey)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
 	//
 	// Setup our metrics-connection, if enabled
 	//
-	p.MetricsFromEnvironment()
+	p.setupMetricsSink()
+
+	p.setupLimits()
+
+	//
+	// The alerting state of the tests is shared via redis, if we have it,
+	// otherwise it is only known to this process.
+	//
+	if p._alerts == nil {
+		if p._r != nil {
+			p._alerts = alert.NewRedisStore(p._r)
+			p._dependencies = alert.NewRedisDependencies(p._r, dependencyStateTTL)
+			p._consensus = alert.NewRedisConsensus(p._r)
+		} else {
+			p._alerts = alert.NewMemoryStore()
+			p._dependencies = alert.NewMemoryDependencies(dependencyStateTTL)
+			p._consensus = alert.NewMemoryConsensus()
+		}
+	}
+
+	// The silences are managed via redis, so there are none without it
+	if p._silences == nil && p._r != nil {
+		p._silences = silence.NewCache(silence.NewRedisStore(p._r), silencesRefresh)
+	}
+
+	// Likewise, the history is only readable via redis
+	if p._history == nil && p._r != nil && p.HistorySize > 0 {
+		p._history = history.NewRedisStore(p._r, int(p.HistorySize), p.HistoryRetention)
+	}
+
+	if p.HTTPAddress != "" {
+		p._m = newWorkerMetrics(p.Tag, backend)
+		p._slots = newWorkerSlots(p.Parallel)
+		p.serveHTTP()
+	}
 
 	//
 	// Setup the options passed to each test, by copying our
@@ -1114,11 +1308,25 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	//
 	parse := parser.New()
 
+	// Cancelling this context aborts all the tests which are still running.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// We want a graceful shutdown, e.g. if a long-running test is active at the moment we need to wait for it to
 	// complete before brutally exiting!
 	shouldExit := sync.NewCond(&sync.Mutex{})
 	onSignalInterrupt(func() {
+		atomic.StoreInt32(&p._draining, 1)
 		shouldExit.Broadcast()
+		if p._onDrain != nil {
+			p._onDrain()
+		}
+
+		// But we do not want to wait forever
+		time.AfterFunc(p.DrainTimeout, func() {
+			fmt.Printf("Drain timeout (%s) expired, cancelling running tests\n", p.DrainTimeout)
+			cancel()
+		})
 
 		// If there is a second interrupt, immediately exit
 		onSignalInterrupt(func() {
@@ -1133,7 +1341,7 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			p.workerLoop(workerIdx, shouldExit, &opts, parse)
+			p.workerLoop(ctx, workerIdx, shouldExit, &opts, parse)
 		}()
 	}
 
@@ -1142,14 +1350,26 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	return subcommands.ExitSuccess
 }
 
-func (p *workerCmd) workerLoop(workerIdx uint, shouldExit *sync.Cond, opts *test.Options, parse *parser.Parser) {
+func (p *workerCmd) workerLoop(ctx context.Context, workerIdx uint, shouldExit *sync.Cond, opts *test.Options, parse *parser.Parser) {
 	fmt.Printf("worker %d started [tag=%s]\n", workerIdx, p.Tag)
 
 	exitLock := &sync.Mutex{}
 	exit := false
 
+	isExiting := func() bool {
+		exitLock.Lock()
+		defer exitLock.Unlock()
+		return exit
+	}
+
+	jobs, err := p._q.Jobs(fmt.Sprintf("%s.%d", p.WorkerID, workerIdx))
+	if err != nil {
+		fmt.Printf("Worker %d failed to access the job queue: %s\n", workerIdx, err.Error())
+		return
+	}
+
 	workerAvailableChan := make(chan bool)
-	testObjectChan := make(chan []string)
+	jobChan := make(chan *queue.Message)
 
 	go func() {
 		shouldExit.L.Lock()
@@ -1159,73 +1379,121 @@ func (p *workerCmd) workerLoop(workerIdx uint, shouldExit *sync.Cond, opts *test
 		exitLock.Lock()
 		defer exitLock.Unlock()
 		exit = true
-		close(testObjectChan)
+		close(jobChan)
 		close(workerAvailableChan)
 	}()
 
 	go func() {
 		for <-workerAvailableChan {
-			exitLock.Lock()
-			if exit {
-				exitLock.Unlock()
-				return
-			}
-			exitLock.Unlock()
+			// Get a job, checking every now and then if we should exit
+			var job *queue.Message
+			for job == nil {
+				if isExiting() {
+					return
+				}
 
-			// Get a job.
-			testObject, _ := p._r.BLPop(0, "overseer.jobs").Result()
+				job, err = jobs.Receive(time.Second)
+				if err != nil {
+					fmt.Printf("Failed to fetch job: %s\n", err.Error())
+					time.Sleep(time.Second)
+				}
+			}
 
 			exitLock.Lock()
 			if exit {
 				exitLock.Unlock()
-				if len(testObject) >= 1 {
-					// Requeue! Let's not lose the test
-					if _, err := p._r.RPush("overseer.jobs", testObject[1]).Result(); err != nil {
-						fmt.Printf("failed to requeue job `%s`: %v\n", testObject[1], err)
-					} else {
-						fmt.Printf("job requeued: %s\n", testObject[1])
-					}
+				// Requeue! Let's not lose the test
+				if err = jobs.Requeue(job); err != nil {
+					fmt.Printf("failed to requeue job `%s`: %v\n", job.Body, err)
 				} else {
-					fmt.Printf("Popped unsupported value: %v\n", testObject)
+					fmt.Printf("job requeued: %s\n", job.Body)
 				}
 				return
 			}
 			exitLock.Unlock()
-			testObjectChan <- testObject
+			jobChan <- job
 		}
 	}()
 
 	// Wait for jobs
 	workerAvailableChan <- true
-	for testObject := range testObjectChan {
+	for job := range jobChan {
 		//
 		// Parse it
 		//
-		//   testObject[0] will be "overseer.jobs"
-		//
-		//   testObject[1] will be the value removed from the list.
-		//
-		if len(testObject) >= 1 {
-			var job test.Test
-			job, err := parse.ParseLine(testObject[1], nil)
-
-			if err == nil {
-				p.runTest(workerIdx, job, *opts)
-			} else {
-				fmt.Printf("Error parsing job from queue: %s - %s\n", testObject[1], err.Error())
+		tst, errParse := parse.ParseLine(job.Body, nil)
+
+		if errParse == nil {
+			stopKeepAlive := p.keepAlive(func() error { return jobs.Touch(job) })
+
+			lease, acquired := p.acquireLimits(ctx, workerIdx, tst)
+			if acquired {
+				stopRefresh := p.keepAlive(lease.Refresh)
+				p._slots.start(workerIdx, tst)
+				p.runTest(ctx, workerIdx, tst, *opts)
+				p._slots.stop(workerIdx)
+				stopRefresh()
+				lease.Release()
+			}
+			stopKeepAlive()
+
+			if !acquired && ctx.Err() == nil {
+				// Let the test wait in the queue, without hammering the target
+				p.verbose(fmt.Sprintf("Test `%s` is over its concurrency limits, requeuing\n", tst.Input))
+				if errRequeue := jobs.Requeue(job); errRequeue != nil {
+					fmt.Printf("failed to requeue job `%s`: %v\n", job.Body, errRequeue)
+				}
+				p.sleep(ctx, limitedRequeueDelay)
+			} else if ctx.Err() != nil {
+				// A cancelled test published no results, so let another worker run it
+				if errRequeue := jobs.Requeue(job); errRequeue != nil {
+					fmt.Printf("failed to requeue job `%s`: %v\n", job.Body, errRequeue)
+				}
+			} else if errAck := jobs.Ack(job); errAck != nil {
+				fmt.Printf("Failed to acknowledge job `%s`: %s\n", job.Body, errAck.Error())
 			}
 		} else {
-			fmt.Printf("Popped unsupported value: %v\n", testObject)
+			fmt.Printf("Error parsing job from queue: %s - %s\n", job.Body, errParse.Error())
+			jobs.Ack(job)
 		}
 
-		exitLock.Lock()
-		if exit {
-			exitLock.Unlock()
+		if isExiting() {
 			break
 		}
-		exitLock.Unlock()
 		workerAvailableChan <- true
 	}
 
 	fmt.Printf("Worker %d exiting\n", workerIdx)
 }
+
+// keepAlive keeps signalling that a job, or the resources it holds, are
+// still in use, so that they are not given to other workers, until the
+// returned function is invoked.
+func (p *workerCmd) keepAlive(refresh func() error) func() {
+	done := make(chan bool)
+
+	interval := p.VisibilityTimeout / 3
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := refresh(); err != nil {
+					fmt.Printf("Failed to refresh in-flight job: %s\n", err.Error())
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,159 @@
+// Worker alerts
+//
+// The min duration and deduplication rules, which decide whether a test
+// result is notified, according to the alerting state of the test, and the
+// dependencies between tests.
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/alert"
+	"github.com/cmaster11/overseer/test"
+)
+
+// How long the state of a test with flap detection is kept, at least, as
+// its history would otherwise be lost between infrequent runs
+const flapStateTTL = 24 * time.Hour
+
+// How long the failures of a labelled test suppress the failures of the
+// tests depending on it, if it stops running
+const dependencyStateTTL = time.Hour
+
+// validateFlapping makes sure the default flap detection settings are
+// valid.
+func (p *workerCmd) validateFlapping() error {
+	if p.FlapLowThreshold > p.FlapHighThreshold {
+		return fmt.Errorf("flap-low-threshold must be <= flap-high-threshold")
+	}
+	return nil
+}
+
+// alertRules returns the notification rules of the given test.
+func alertRules(tst test.Test) alert.Rules {
+	var rules alert.Rules
+
+	if tst.MinDuration != nil {
+		rules.MinDuration = *tst.MinDuration
+
+		// We need a minimum cache duration, otherwise the min duration test cannot work
+		factor := tst.MinDurationCacheFactor
+		if factor == 0 {
+			factor = 2
+		}
+		rules.TTL = rules.MinDuration * time.Duration(factor)
+	}
+
+	if tst.DedupDuration != nil {
+		rules.Dedup = *tst.DedupDuration
+
+		// Keep the state long enough that it's not going to expire anytime soon
+		if rules.Dedup*10 > rules.TTL {
+			rules.TTL = rules.Dedup * 10
+		}
+	}
+
+	if tst.FlapWindow != nil && *tst.FlapWindow > 0 {
+		rules.FlapWindow = int(*tst.FlapWindow)
+		if tst.FlapHighThreshold != nil {
+			rules.FlapHigh = *tst.FlapHighThreshold
+		}
+		if tst.FlapLowThreshold != nil {
+			rules.FlapLow = *tst.FlapLowThreshold
+		}
+
+		if rules.TTL < flapStateTTL {
+			rules.TTL = flapStateTTL
+		}
+	}
+
+	return rules
+}
+
+// applyAlertRules updates the alerting state of the given test with its
+// result, returning false if the result must not be notified.
+func (p *workerCmd) applyAlertRules(tst test.Test, result *test.Result) bool {
+	rules := alertRules(tst)
+	if p._alerts == nil || rules.Empty() {
+		return true
+	}
+
+	decision, err := p._alerts.Update(result.Hash(), result.Error != nil, rules, time.Now())
+	if err != nil {
+		// Better a duplicate notification than a missing one
+		fmt.Printf("Failed to update the alert state of `%s`: %s\n", tst.Input, err.Error())
+		return true
+	}
+
+	result.FirstErrorTime = decision.FirstFailure
+	result.IsDedup = decision.IsDedup
+	result.Recovered = decision.Action == alert.ActionRecover
+	result.Flapping = decision.Flapping
+
+	switch decision.Reason {
+	case alert.ReasonMinDuration:
+		p.verbose(fmt.Sprintf("Skipping notification (minDuration, failing for %s) for test `%s` (%s)\n",
+			decision.Since.Truncate(time.Second), tst.Input, tst.Target))
+	case alert.ReasonDedup:
+		p.verbose(fmt.Sprintf("Skipping notification (dedup, last notif %s ago) for test `%s` (%s)\n",
+			decision.Since.Truncate(time.Second), tst.Input, tst.Target))
+	case alert.ReasonNotNotified:
+		p.verbose(fmt.Sprintf("Test recovered (min duration not met, skipping recovered message): `%s` (%s)\n",
+			tst.Input, tst.Target))
+	case alert.ReasonFlapping:
+		p.verbose(fmt.Sprintf("Skipping notification (flapping, %.0f%% state changes) for test `%s` (%s)\n",
+			decision.ChangeRate*100, tst.Input, tst.Target))
+	case alert.ReasonNeverFailed:
+		p.verbose(fmt.Sprintf("Test passed (min duration, original error never seen): `%s` (%s)\n",
+			tst.Input, tst.Target))
+	}
+
+	if decision.Flapping != "" {
+		p.verbose(fmt.Sprintf("Test flapping %s (%.0f%% state changes): `%s` (%s)\n",
+			decision.Flapping, decision.ChangeRate*100, tst.Input, tst.Target))
+	}
+	if decision.Action == alert.ActionRecover {
+		p.verbose(fmt.Sprintf("Test recovered, showing recovered message: `%s` (%s)\n",
+			tst.Input, tst.Target))
+	}
+	if decision.Action == alert.ActionSuppress {
+		p._m.notificationSuppressed(tst, decision.Reason)
+	}
+
+	return decision.Notify()
+}
+
+// applyDependencies records the result of a labelled test, and marks the
+// failure of a test as suppressed if the test it depends on is failing.
+func (p *workerCmd) applyDependencies(tst test.Test, result *test.Result) {
+	if p._dependencies == nil {
+		return
+	}
+
+	now := time.Now()
+	if tst.TestLabel != nil {
+		if err := p._dependencies.Record(*tst.TestLabel, result.Hash(), result.Error != nil, now); err != nil {
+			fmt.Printf("Failed to record the state of `%s`: %s\n", tst.Input, err.Error())
+		}
+	}
+
+	if tst.DependsOn == "" || result.Error == nil {
+		return
+	}
+
+	failing, err := p._dependencies.Failing(tst.DependsOn, now)
+	if err != nil {
+		// Better a downstream notification than a missing one
+		fmt.Printf("Failed to check the dependency of `%s`: %s\n", tst.Input, err.Error())
+		return
+	}
+	if !failing {
+		return
+	}
+
+	p.verbose(fmt.Sprintf("Skipping notification (depends on failing test '%s') for test `%s` (%s)\n",
+		tst.DependsOn, tst.Input, tst.Target))
+	p._m.notificationSuppressed(tst, "dependency")
+	result.SuppressedBy = tst.DependsOn
+}
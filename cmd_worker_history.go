@@ -0,0 +1,30 @@
+// Worker history
+//
+// The history of the results of every test, kept in redis, and shown by
+// the history sub-command.
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// recordHistory adds the given result to the history of its test, if
+// enabled.
+//
+// Silenced results are recorded as such, so that reports can exclude
+// them.
+func (p *workerCmd) recordHistory(result *test.Result, duration time.Duration) {
+	if p._history == nil {
+		return
+	}
+
+	recorded := *result
+	recorded.Silenced = p._silences != nil && p._silences.Match(result, time.Now()) != nil
+
+	if err := p._history.Record(&recorded, duration); err != nil {
+		fmt.Printf("Failed to record the history of `%s`: %s\n", result.Input, err.Error())
+	}
+}
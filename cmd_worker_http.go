@@ -0,0 +1,120 @@
+// Worker HTTP
+//
+// The optional HTTP server of the worker, exposing its metrics, health and
+// what it is currently doing.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// workerSlot describes what a worker goroutine is doing.
+type workerSlot struct {
+	Worker uint `json:"worker"`
+
+	// Either idle or running
+	State string `json:"state"`
+
+	// The running test, if any
+	Input   string     `json:"input,omitempty"`
+	Type    string     `json:"type,omitempty"`
+	Target  string     `json:"target,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	Running string     `json:"running,omitempty"`
+}
+
+// workerSlots keeps track of what each worker goroutine is doing.
+//
+// All the methods can be invoked on a nil instance, which does nothing.
+type workerSlots struct {
+	mutex sync.Mutex
+	slots []workerSlot
+}
+
+// newWorkerSlots creates the slots of the given number of workers, all
+// idle.
+func newWorkerSlots(count uint) *workerSlots {
+	s := &workerSlots{}
+
+	var idx uint
+	for idx = 1; idx <= count; idx++ {
+		s.slots = append(s.slots, workerSlot{Worker: idx, State: "idle"})
+	}
+	return s
+}
+
+// start records that the given worker started running a test.
+func (s *workerSlots) start(workerIdx uint, tst test.Test) {
+	if s == nil {
+		return
+	}
+
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.slots[workerIdx-1] = workerSlot{
+		Worker: workerIdx,
+		State:  "running",
+		Input:  tst.Sanitize(),
+		Type:   tst.Type,
+		Target: tst.Target,
+		Since:  &now,
+	}
+}
+
+// stop records that the given worker is idle.
+func (s *workerSlots) stop(workerIdx uint) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.slots[workerIdx-1] = workerSlot{Worker: workerIdx, State: "idle"}
+}
+
+// ServeHTTP shows the state of all the workers, as JSON.
+func (s *workerSlots) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	slots := append([]workerSlot(nil), s.slots...)
+	s.mutex.Unlock()
+
+	for i := range slots {
+		if slots[i].Since != nil {
+			slots[i].Running = time.Since(*slots[i].Since).Round(time.Millisecond).String()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(slots)
+}
+
+// serveHTTP starts the HTTP server of the worker, in the background.
+func (p *workerCmd) serveHTTP() {
+	server := newHealthServer()
+
+	if p._r != nil {
+		server.AddLiveness("redis", redisHealth(p._r))
+	}
+	server.AddReadiness("draining", func() error {
+		if atomic.LoadInt32(&p._draining) != 0 {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+
+	server.Handle("/metrics", p._m.registry)
+	server.Handle("/debug/workers", p._slots)
+
+	server.Start(p.HTTPAddress)
+}
@@ -0,0 +1,90 @@
+// Worker limits
+//
+// The concurrency limits of the worker, which cap how many tests can run at
+// the same time against the same target, or of the same type.
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/limits"
+	"github.com/cmaster11/overseer/test"
+)
+
+// What to do with tests over the concurrency limits
+const (
+	limitActionWait    = "wait"
+	limitActionRequeue = "requeue"
+)
+
+// How long a worker pauses after requeuing a limited test, so that it does
+// not keep picking up the same limited tests.
+const limitedRequeueDelay = time.Second
+
+// validateLimits makes sure the concurrency limits are valid.
+func (p *workerCmd) validateLimits() error {
+	if p.MaxPerTarget < 0 {
+		return fmt.Errorf("max-per-target must be >= 0")
+	}
+	if _, err := limits.ParsePerType(p.MaxPerType); err != nil {
+		return err
+	}
+	if p.LimitAction != limitActionWait && p.LimitAction != limitActionRequeue {
+		return fmt.Errorf("unknown limit-action '%s', expected wait or requeue", p.LimitAction)
+	}
+	return nil
+}
+
+// setupLimits creates the limiter, if any limit is set.
+//
+// Limits are enforced across all the workers if requested, and if redis
+// is available.
+func (p *workerCmd) setupLimits() {
+	perType, _ := limits.ParsePerType(p.MaxPerType)
+	l := limits.Limits{
+		PerTarget: p.MaxPerTarget,
+		PerType:   perType,
+	}
+	if l.Empty() {
+		return
+	}
+
+	if p.ClusterLimits && p._r != nil {
+		lease := p.VisibilityTimeout
+		if lease <= 0 {
+			lease = 5 * time.Minute
+		}
+		p._limiter = limits.New(l, limits.NewRedisSemaphore(p._r, lease), 500*time.Millisecond)
+		return
+	}
+
+	p._limiter = limits.New(l, limits.NewLocalSemaphore(), 100*time.Millisecond)
+}
+
+// acquireLimits acquires the resources needed to run the given test, if
+// it is limited, returning false if the test cannot run now.
+//
+// The returned lease, which can be nil, must be released once done.
+func (p *workerCmd) acquireLimits(ctx context.Context, workerIdx uint, tst test.Test) (*limits.Lease, bool) {
+	if p._limiter == nil {
+		return nil, true
+	}
+
+	holder := fmt.Sprintf("%s.%d", p.WorkerID, workerIdx)
+
+	var lease *limits.Lease
+	var err error
+	if p.LimitAction == limitActionRequeue {
+		lease, err = p._limiter.TryAcquire(tst.Type, tst.Target, holder)
+	} else {
+		lease, err = p._limiter.Acquire(ctx, tst.Type, tst.Target, holder)
+	}
+
+	if err != nil && ctx.Err() == nil {
+		fmt.Printf("Failed to acquire the concurrency limits of `%s`: %s\n", tst.Input, err.Error())
+	}
+
+	return lease, lease != nil
+}
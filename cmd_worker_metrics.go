@@ -0,0 +1,124 @@
+// Worker metrics
+//
+// The metrics the worker exposes to Prometheus, via HTTP.
+package main
+
+import (
+	"time"
+
+	"github.com/cmaster11/overseer/metrics"
+	"github.com/cmaster11/overseer/queue"
+	"github.com/cmaster11/overseer/test"
+)
+
+// workerMetrics holds all the metrics of a worker.
+//
+// All the methods can be invoked on a nil instance, which does nothing, so
+// that callers do not need to know whether metrics are enabled.
+type workerMetrics struct {
+	registry *metrics.Registry
+
+	// The tag applied to all results
+	tag string
+
+	testDuration *metrics.HistogramVec
+	testAttempts *metrics.HistogramVec
+	testResults  *metrics.CounterVec
+	dnsDuration  *metrics.HistogramVec
+	inFlight     *metrics.GaugeVec
+	suppressed   *metrics.CounterVec
+}
+
+// The labels identifying a test
+var testLabels = []string{"type", "target", "test_label", "tag"}
+
+// newWorkerMetrics creates the metrics of a worker, reading jobs from the
+// given backend.
+func newWorkerMetrics(tag string, backend queue.Backend) *workerMetrics {
+	r := metrics.NewRegistry()
+
+	m := &workerMetrics{
+		registry: r,
+		tag:      tag,
+
+		testDuration: r.NewHistogramVec("overseer_test_duration_seconds",
+			"How long tests took to complete, including retries.", nil, testLabels...),
+		testAttempts: r.NewHistogramVec("overseer_test_attempts",
+			"How many attempts tests took to complete.", []float64{1, 2, 3, 5, 10, 20}, testLabels...),
+		testResults: r.NewCounterVec("overseer_test_results_total",
+			"The results of tests, by outcome (pass or fail).", append(testLabels, "result")...),
+		dnsDuration: r.NewHistogramVec("overseer_dns_duration_seconds",
+			"How long it took to resolve test targets.", nil, "target"),
+		inFlight: r.NewGaugeVec("overseer_tests_in_flight",
+			"The tests currently running.", "type"),
+		suppressed: r.NewCounterVec("overseer_notifications_suppressed_total",
+			"The failure notifications suppressed, by reason (dedup or min-duration).", append(testLabels, "reason")...),
+	}
+
+	r.NewGaugeFunc("overseer_queue_depth", "The jobs waiting in the job queues.", func() (float64, error) {
+		pending, err := backend.PendingJobs()
+		return float64(pending), err
+	})
+
+	return m
+}
+
+// labels returns the label values of the given test.
+func (m *workerMetrics) labels(tst test.Test, target string) []string {
+	label := ""
+	if tst.TestLabel != nil {
+		label = *tst.TestLabel
+	}
+	return []string{tst.Type, target, label, m.tag}
+}
+
+// testStarted records that a test started running.
+func (m *workerMetrics) testStarted(tst test.Test) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Inc(tst.Type)
+}
+
+// testStopped records that a test stopped running, whether it completed
+// or not.
+func (m *workerMetrics) testStopped(tst test.Test) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Dec(tst.Type)
+}
+
+// testCompleted records the outcome of a test against the given target.
+func (m *workerMetrics) testCompleted(tst test.Test, target string, duration time.Duration, attempts uint, result error) {
+	if m == nil {
+		return
+	}
+
+	labels := m.labels(tst, target)
+	m.testDuration.Observe(duration.Seconds(), labels...)
+	m.testAttempts.Observe(float64(attempts), labels...)
+
+	outcome := "pass"
+	if result != nil {
+		outcome = "fail"
+	}
+	m.testResults.Inc(append(labels, outcome)...)
+}
+
+// dnsResolved records how long it took to resolve a target.
+func (m *workerMetrics) dnsResolved(target string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.dnsDuration.Observe(duration.Seconds(), target)
+}
+
+// notificationSuppressed records that the failure notification of a test
+// was not published, for the given reason.
+func (m *workerMetrics) notificationSuppressed(tst test.Test, reason string) {
+	if m == nil {
+		return
+	}
+	m.suppressed.Inc(append(m.labels(tst, tst.Target), reason)...)
+}
@@ -0,0 +1,148 @@
+// Worker quorum
+//
+// Tests run from multiple locations can require a quorum of them to agree
+// that the test failed, so that a single worker with a bad network path
+// does not raise false alarms.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/alert"
+	"github.com/cmaster11/overseer/test"
+	"github.com/cmaster11/overseer/utils"
+)
+
+// quorumTarget returns the target of a test, as known to all the
+// locations: its hostname, rather than the address it resolved to from
+// this one.
+func quorumTarget(tst test.Test) string {
+	if tst.ResolvedFrom != "" {
+		return tst.ResolvedFrom
+	}
+	return tst.Target
+}
+
+// quorumKey identifies the test a result is the vote of a location for.
+//
+// Unlike the hash of the result, it is the same from all the locations, so
+// it depends neither on the tag of the worker, nor on the address the
+// target resolved to.
+func quorumKey(tst test.Test, result *test.Result) string {
+	if result.UniqueHash != nil {
+		return utils.GetMD5Hash(*result.UniqueHash + result.Type + quorumTarget(tst))
+	}
+	return utils.GetMD5Hash(result.Input + result.Type + quorumTarget(tst))
+}
+
+// hasQuorum returns true if the given test requires a quorum of locations
+// to agree on its result.
+func (p *workerCmd) hasQuorum(tst test.Test) bool {
+	return tst.Quorum != "" && p._consensus != nil
+}
+
+// mergeVotes merges the results of a test against each of the addresses
+// its target resolved to into the single vote of this location, which
+// failed if any of them failed.
+func mergeVotes(results []*test.Result) *test.Result {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Target < results[j].Target
+	})
+
+	merged := *results[0]
+	var errors []string
+	for _, result := range results {
+		if result.Error == nil {
+			continue
+		}
+		if len(errors) == 0 {
+			merged = *result
+		}
+		if len(results) > 1 {
+			errors = append(errors, result.Target+": "+*result.Error)
+		} else {
+			errors = append(errors, *result.Error)
+		}
+	}
+
+	merged.Error = nil
+	if len(errors) > 0 {
+		errorString := strings.Join(errors, "; ")
+		merged.Error = &errorString
+	}
+	return &merged
+}
+
+// applyQuorum casts the result of a test with a quorum as the vote of the
+// location of the worker, returning false while the locations have not
+// reached a decision yet.
+//
+// Once they have, the result is replaced with the decision, which is the
+// result of the test as a whole, listing which locations failed and which
+// passed.
+func (p *workerCmd) applyQuorum(tst test.Test, result *test.Result) bool {
+	if !p.hasQuorum(tst) {
+		return true
+	}
+
+	quorum, err := alert.ParseQuorum(tst.Quorum)
+	if err != nil {
+		fmt.Printf("Invalid quorum of `%s`: %s\n", tst.Input, err.Error())
+		return true
+	}
+
+	location := result.Location
+	if location == "" {
+		location = p.WorkerID
+	}
+
+	vote := alert.Vote{
+		Location: location,
+		Failed:   result.Error != nil,
+		Time:     result.Time,
+	}
+	if result.Error != nil {
+		vote.Error = *result.Error
+	}
+
+	votes, err := p._consensus.Vote(quorumKey(tst, result), vote, quorum, p.QuorumWindow, time.Now())
+	if err != nil {
+		// Better a false alarm than a missing one
+		fmt.Printf("Failed to collect the result of `%s` from %s: %s\n", tst.Input, location, err.Error())
+		return true
+	}
+	if votes == nil {
+		p.verbose(fmt.Sprintf("Waiting for the quorum (%s) of test `%s` (%s)\n", quorum, tst.Input, tst.Target))
+		return false
+	}
+
+	var errors []string
+	for _, v := range votes {
+		if v.Failed {
+			result.FailedLocations = append(result.FailedLocations, v.Location)
+			errors = append(errors, v.Location+": "+v.Error)
+		} else {
+			result.PassedLocations = append(result.PassedLocations, v.Location)
+		}
+	}
+
+	// The decision is about the test, regardless of the location, and of
+	// what this location observed, so that its alerting state is the same
+	// whichever worker took it
+	result.Location = ""
+	result.Tag = ""
+	result.Target = quorumTarget(tst)
+	result.Measurements = nil
+
+	result.Error = nil
+	if _, failed := quorum.Decide(votes); failed {
+		errorString := fmt.Sprintf("failed from %d out of %d locations (%s)",
+			len(result.FailedLocations), len(votes), strings.Join(errors, "; "))
+		result.Error = &errorString
+	}
+
+	return true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/alert"
+	"github.com/cmaster11/overseer/test"
+)
+
+// Test workers with different tags, which resolved the target to different
+// addresses, vote on the same test
+func TestQuorumAcrossLocations(t *testing.T) {
+	consensus := alert.NewMemoryConsensus()
+	workers := map[string]*workerCmd{
+		"eu": {Tag: "eu-prod", WorkerID: "eu-1", QuorumWindow: time.Minute, _consensus: consensus},
+		"us": {Tag: "us-prod", WorkerID: "us-1", QuorumWindow: time.Minute, _consensus: consensus},
+	}
+
+	tst := test.Test{
+		Type:         "http",
+		Input:        "https://example.com/ must run http with run-from eu,us with quorum 2/2",
+		ResolvedFrom: "example.com",
+		RunFrom:      []string{"eu", "us"},
+		Quorum:       "2/2",
+	}
+	failure := "connection refused"
+
+	vote := func(location string, address string) (*test.Result, bool) {
+		p := workers[location]
+		tstCopy := tst
+		tstCopy.Target = address
+
+		result := &test.Result{
+			Input:    tstCopy.Input,
+			Target:   tstCopy.Target,
+			Time:     time.Now().Unix(),
+			Type:     tstCopy.Type,
+			Tag:      p.Tag,
+			Location: location,
+			Error:    &failure,
+		}
+		return result, p.applyQuorum(tstCopy, result)
+	}
+
+	if _, decided := vote("eu", "192.0.2.1"); decided {
+		t.Fatalf("Expected no decision with a single vote")
+	}
+
+	result, decided := vote("us", "198.51.100.1")
+	if !decided {
+		t.Fatalf("Expected the votes of both locations to reach a decision")
+	}
+	if result.Error == nil || len(result.FailedLocations) != 2 {
+		t.Fatalf("Expected the test to fail from both locations, got %+v", result)
+	}
+	if result.Target != "example.com" || result.Location != "" {
+		t.Errorf("Expected the decision to be about example.com from no location, got %s from '%s'", result.Target, result.Location)
+	}
+}
+
+// Test the decisions taken by workers with different tags share the same
+// alerting state
+func TestQuorumAlertState(t *testing.T) {
+	consensus := alert.NewMemoryConsensus()
+	alerts := alert.NewMemoryStore()
+	workers := []*workerCmd{
+		{Tag: "eu-prod", WorkerID: "eu-1", QuorumWindow: time.Minute, _consensus: consensus, _alerts: alerts},
+		{Tag: "us-prod", WorkerID: "us-1", QuorumWindow: time.Minute, _consensus: consensus, _alerts: alerts},
+	}
+
+	dedup := time.Hour
+	tst := test.Test{
+		Type:          "http",
+		Input:         "https://example.com/ must run http with run-from eu,us with quorum 2/2",
+		Target:        "https://example.com/",
+		RunFrom:       []string{"eu", "us"},
+		Quorum:        "2/2",
+		DedupDuration: &dedup,
+	}
+	failure := "connection refused"
+
+	// Each round is decided by the worker voting last, in turn
+	var notified []string
+	for round, failed := range []bool{true, true, false, false} {
+		for i := range workers {
+			p := workers[(round+i)%len(workers)]
+			result := &test.Result{
+				Input:    tst.Input,
+				Target:   tst.Target,
+				Time:     time.Now().Unix(),
+				Type:     tst.Type,
+				Tag:      p.Tag,
+				Location: p.WorkerID,
+			}
+			if failed {
+				result.Error = &failure
+			}
+
+			if !p.applyQuorum(tst, result) || !p.applyAlertRules(tst, result) {
+				continue
+			}
+			if result.Error != nil {
+				notified = append(notified, "FIRING")
+			}
+			if result.Recovered {
+				notified = append(notified, "RESOLVED")
+			}
+		}
+	}
+
+	if strings.Join(notified, ",") != "FIRING,RESOLVED" {
+		t.Errorf("Expected a single FIRING and RESOLVED sequence, got %v", notified)
+	}
+}
+
+// Test the results against the addresses of a target are a single vote
+func TestMergeVotes(t *testing.T) {
+	failure := "connection refused"
+	ipv4 := &test.Result{Target: "192.0.2.1"}
+	ipv6 := &test.Result{Target: "2001:db8::1", Error: &failure}
+
+	merged := mergeVotes([]*test.Result{ipv6, ipv4})
+	if merged.Error == nil || *merged.Error != "2001:db8::1: connection refused" {
+		t.Errorf("Expected the vote to fail from 2001:db8::1, got %+v", merged)
+	}
+
+	merged = mergeVotes([]*test.Result{ipv4})
+	if merged.Error != nil {
+		t.Errorf("Expected the vote to pass, got %s", *merged.Error)
+	}
+
+	merged = mergeVotes([]*test.Result{ipv6})
+	if merged.Error == nil || *merged.Error != failure {
+		t.Errorf("Expected the error of the only address, got %+v", merged)
+	}
+}
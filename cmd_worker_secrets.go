@@ -0,0 +1,33 @@
+// Worker secrets
+//
+// The references to secrets, e.g. "with password env:DB_PASS", which are
+// resolved right before running the tests, so that the secrets are never
+// enqueued, nor notified.
+package main
+
+import (
+	"github.com/cmaster11/overseer/secret"
+	"github.com/cmaster11/overseer/test"
+)
+
+// resolveSecrets returns a copy of the given test, to be run by the
+// probes, with its references to secrets resolved.
+//
+// The test itself keeps the references, so that the secrets are never
+// notified, and the unique hashes of its results do not change when the
+// secrets do.
+func (p *workerCmd) resolveSecrets(tst test.Test) (test.Test, error) {
+	resolved := tst
+	resolved.Arguments = make(map[string]string, len(tst.Arguments))
+
+	for name, value := range tst.Arguments {
+		if test.SecretArguments[name] {
+			var err error
+			if value, err = secret.Resolve(value); err != nil {
+				return tst, err
+			}
+		}
+		resolved.Arguments[name] = value
+	}
+	return resolved, nil
+}
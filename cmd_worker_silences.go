@@ -0,0 +1,57 @@
+// Worker silences
+//
+// The silences, managed via the silence sub-command, which mute the
+// notifications of matching results, e.g. during planned maintenance.
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// What to do with silenced results
+const (
+	silencedActionMark = "mark"
+	silencedActionDrop = "drop"
+)
+
+// How often the silences are reloaded
+const silencesRefresh = 10 * time.Second
+
+// validateSilences makes sure the silences settings are valid.
+func (p *workerCmd) validateSilences() error {
+	if p.SilencedAction != silencedActionMark && p.SilencedAction != silencedActionDrop {
+		return fmt.Errorf("unknown silenced-action '%s', expected mark or drop", p.SilencedAction)
+	}
+	return nil
+}
+
+// applySilences checks whether the given result is silenced, returning
+// false if it must not be notified.
+//
+// Silenced results are either dropped, or notified marked as silenced, so
+// that the bridges can still record them.
+func (p *workerCmd) applySilences(tst test.Test, result *test.Result) bool {
+	if p._silences == nil {
+		return true
+	}
+
+	s := p._silences.Match(result, time.Now())
+	if s == nil {
+		return true
+	}
+
+	if p.SilencedAction == silencedActionDrop {
+		p.verbose(fmt.Sprintf("Skipping notification (silenced by %s: %s) for test `%s` (%s)\n",
+			s.ID, s.Comment, tst.Input, tst.Target))
+		p._m.notificationSuppressed(tst, "silenced")
+		return false
+	}
+
+	p.verbose(fmt.Sprintf("Marking notification as silenced (by %s: %s) for test `%s` (%s)\n",
+		s.ID, s.Comment, tst.Input, tst.Target))
+	result.Silenced = true
+	return true
+}
@@ -1,4 +1,7 @@
-package main
+// Package filter matches test results against queries, e.g.
+// "type=http,tag=!staging", which are used to route results to different
+// queues, and to silence them.
+package filter
 
 import (
 	"fmt"
@@ -16,6 +19,7 @@ Test results can be filtered using all the following keys:
 	- tag (regex): 			tag=my-k8s-cluster
 							tag=!my-k8s-cluster <- this will match anything that does NOT match 'my-k8s-cluster'
 	- testLabel (regex):	testLabel=A\sLabel
+	- location (regex):		location=eu
 
 	- input (regex)
 	- target (regex): 		target=10\.0\.123\.111
@@ -23,25 +27,30 @@ Test results can be filtered using all the following keys:
 	- error (regex):		error=(ssl|SSL)
 	- isDedup (bool):		isDedup=true/isDedup=false
 	- recovered (bool):		recovered=true/recovered=false
+	- silenced (bool):		silenced=true/silenced=false
+	- flapping (regex):		flapping=started/flapping=stopped/flapping=.+
 
 Notes:
 
 * All regex fields can be negated by prepending the ! character: tag=!my-k8s-cluster.
 
 */
-type resultFilter struct {
+type Filter struct {
 	Type      *k8seventwatcher.Regexp
 	Tag       *k8seventwatcher.Regexp
 	TestLabel *k8seventwatcher.Regexp
+	Location  *k8seventwatcher.Regexp
 	Input     *k8seventwatcher.Regexp
 	Target    *k8seventwatcher.Regexp
 	Error     *k8seventwatcher.Regexp
 	Details   *k8seventwatcher.Regexp
 	IsDedup   *bool
 	Recovered *bool
+	Silenced  *bool
+	Flapping  *k8seventwatcher.Regexp
 }
 
-func (f *resultFilter) Matches(result *test.Result) bool {
+func (f *Filter) Matches(result *test.Result) bool {
 	if f.Type != nil && !f.Type.MatchString(result.Type) {
 		return false
 	}
@@ -51,6 +60,9 @@ func (f *resultFilter) Matches(result *test.Result) bool {
 	if f.TestLabel != nil && (result.TestLabel == nil || !f.TestLabel.MatchString(*result.TestLabel)) {
 		return false
 	}
+	if f.Location != nil && !f.Location.MatchString(result.Location) {
+		return false
+	}
 	if f.Input != nil && !f.Input.MatchString(result.Input) {
 		return false
 	}
@@ -72,6 +84,12 @@ func (f *resultFilter) Matches(result *test.Result) bool {
 	if f.Recovered != nil && result.Recovered != *f.Recovered {
 		return false
 	}
+	if f.Silenced != nil && result.Silenced != *f.Silenced {
+		return false
+	}
+	if f.Flapping != nil && !f.Flapping.MatchString(result.Flapping) {
+		return false
+	}
 
 	return true
 }
@@ -84,14 +102,14 @@ var regexpKeyQuery = regexp.MustCompile(`^(\w+)=(.*)$`)
 //
 // Filter query can be contain multiple options, divided by comma (,)
 // For regex values, comma can be escaped with \,
-func newResultFilterFromQuery(queryString string) (*resultFilter, error) {
+func NewFromQuery(queryString string) (*Filter, error) {
 	// Temporary replacement for comma
 	queryString = strings.ReplaceAll(queryString, "\\,", commaTemporaryReplacement)
 
 	// Split in all the different queries
 	queries := strings.Split(queryString, ",")
 
-	filter := &resultFilter{}
+	filter := &Filter{}
 
 	for _, query := range queries {
 		// Restore comma
@@ -133,6 +151,17 @@ func newResultFilterFromQuery(queryString string) (*resultFilter, error) {
 				return nil, fmt.Errorf("invalid boolean value %s for key %s", queryRegexString, queryKey)
 			}
 			filter.Recovered = &v
+		case "silenced":
+			used = true
+			var v bool
+			if queryRegexString == "true" {
+				v = true
+			} else if queryRegexString == "false" {
+				v = false
+			} else {
+				return nil, fmt.Errorf("invalid boolean value %s for key %s", queryRegexString, queryKey)
+			}
+			filter.Silenced = &v
 		}
 
 		if !used {
@@ -148,6 +177,8 @@ func newResultFilterFromQuery(queryString string) (*resultFilter, error) {
 				filter.Tag = queryRegex
 			case "testLabel":
 				filter.TestLabel = queryRegex
+			case "location":
+				filter.Location = queryRegex
 			case "input":
 				filter.Input = queryRegex
 			case "target":
@@ -156,6 +187,8 @@ func newResultFilterFromQuery(queryString string) (*resultFilter, error) {
 				filter.Error = queryRegex
 			case "details":
 				filter.Details = queryRegex
+			case "flapping":
+				filter.Flapping = queryRegex
 			default:
 				return nil, fmt.Errorf("unhandled filter key: %s", queryKey)
 			}
@@ -1,4 +1,4 @@
-package main
+package filter
 
 import (
 	"testing"
@@ -10,7 +10,7 @@ import (
 func TestNewResultFilterFromQuery(t *testing.T) {
 
 	testSyntaxOK := func(t *testing.T, query string) {
-		filter, err := newResultFilterFromQuery(query)
+		filter, err := NewFromQuery(query)
 		if err != nil {
 			t.Fatalf("bad query: %s, %s", query, err)
 		}
@@ -18,7 +18,7 @@ func TestNewResultFilterFromQuery(t *testing.T) {
 		t.Logf("query: %s, filter:\n%s", query, string(m))
 	}
 	testSyntaxBad := func(t *testing.T, query string) {
-		if _, err := newResultFilterFromQuery(query); err == nil {
+		if _, err := NewFromQuery(query); err == nil {
 			t.Fatalf("should have been bad query: %s", query)
 		}
 	}
@@ -33,6 +33,8 @@ func TestNewResultFilterFromQuery(t *testing.T) {
 	testSyntaxOK(t, "target=a.*")
 	testSyntaxOK(t, "error=a.*")
 	testSyntaxOK(t, "details=a.*")
+	testSyntaxOK(t, "flapping=started")
+	testSyntaxOK(t, "location=eu")
 
 	// Combined
 	testSyntaxOK(t, "error=a.*,input=a.*,isDedup=false")
@@ -44,7 +46,7 @@ func TestNewResultFilterFromQuery(t *testing.T) {
 	testSyntaxBad(t, "error=asd*,,isDedup=true")
 
 	testMatchOK := func(t *testing.T, query string, result *test.Result) {
-		filter, err := newResultFilterFromQuery(query)
+		filter, err := NewFromQuery(query)
 		if err != nil {
 			t.Fatalf("bad query: %s, %s", query, err)
 		}
@@ -55,7 +57,7 @@ func TestNewResultFilterFromQuery(t *testing.T) {
 		t.Logf("query: %s, result:%+v, filter:\n%s", query, result, string(m))
 	}
 	testMatchBad := func(t *testing.T, query string, result *test.Result) {
-		filter, err := newResultFilterFromQuery(query)
+		filter, err := NewFromQuery(query)
 		if err != nil {
 			t.Fatalf("bad query: %s, %s", query, err)
 		}
@@ -69,6 +71,8 @@ func TestNewResultFilterFromQuery(t *testing.T) {
 	// Simple elements
 	testMatchOK(t, "isDedup=true", &test.Result{IsDedup: true})
 	testMatchOK(t, "recovered=true", &test.Result{Recovered: true})
+	testMatchOK(t, "silenced=true", &test.Result{Silenced: true})
+	testMatchOK(t, "flapping=started", &test.Result{Flapping: "started"})
 	testMatchOK(t, "type=a.*", &test.Result{Type: "asd"})
 	testMatchOK(t, "tag=a.*", &test.Result{Tag: "a2"})
 	testLabel := "My label 123"
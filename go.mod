@@ -3,28 +3,32 @@ module github.com/cmaster11/overseer
 go 1.13
 
 require (
+	github.com/alicebob/gopher-json v0.0.0-20180125190556-5a6b3ba71ee6 // indirect
+	github.com/alicebob/miniredis v2.5.0+incompatible
 	github.com/cmaster11/k8s-event-watcher v0.0.8
 	github.com/emersion/go-imap v1.0.0-beta.2
 	github.com/go-redis/redis v6.15.2+incompatible
 	github.com/go-sql-driver/mysql v1.4.1
+	github.com/gomodule/redigo v2.0.0+incompatible // indirect
 	github.com/google/subcommands v1.0.1
 	github.com/jlaffaye/ftp v0.0.0-20190126081051-8019e6774408
+	github.com/kr/pretty v0.1.0 // indirect
 	github.com/lib/pq v1.0.0
-	github.com/marpaia/graphite-golang v0.0.0-20171231172105-134b9af18cf3
+	github.com/marpaia/graphite-golang v0.0.0-20171231172105-134b9af18cf3 // indirect
 	github.com/miekg/dns v1.1.6
-	github.com/mitchellh/mapstructure v1.1.2
 	github.com/onsi/ginkgo v1.8.0 // indirect
 	github.com/onsi/gomega v1.5.0 // indirect
 	github.com/robfig/cron v0.0.0-20180505203441-b41be1df6967
 	github.com/simia-tech/go-pop3 v0.0.0-20150626094726-c9c20550a244
 	github.com/skx/golang-metrics v0.0.0-20180606065905-85a4b4e0641f
-	golang.org/x/lint v0.0.0-20191125180803-fdd1cda4f05f // indirect
+	github.com/yuin/gopher-lua v0.0.0-20180827083657-b942cacc89fe // indirect
+	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550 // indirect
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e // indirect
 	golang.org/x/sys v0.0.0-20191010194322-b09406accb47 // indirect
 	golang.org/x/text v0.3.2 // indirect
-	golang.org/x/tools v0.0.0-20200529172331-a64b76657301 // indirect
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/yaml.v2 v2.2.4
-	honnef.co/go/tools v0.0.1-2020.1.4 // indirect
 	k8s.io/api v0.0.0-20190620084959-7cf5895f2711
 	k8s.io/apimachinery v0.0.0-20190612205821-1799e75a0719
 	k8s.io/client-go v0.0.0-20190620085101-78d2af792bab
@@ -0,0 +1,121 @@
+// Health
+//
+// The optional HTTP server of the long-running sub-commands, exposing
+// their health to e.g. Kubernetes probes.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// healthCheck is a named check, which returns an error if unhealthy.
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// healthServer serves /healthz and /readyz, plus any other handler
+// registered by the sub-command.
+//
+// /healthz fails if any liveness check fails, meaning the process should
+// be restarted.  /readyz fails if any liveness or readiness check fails,
+// meaning the process should not be given work.
+type healthServer struct {
+	mux *http.ServeMux
+
+	mutex     sync.Mutex
+	liveness  []healthCheck
+	readiness []healthCheck
+}
+
+// newHealthServer creates a new server, without any check.
+func newHealthServer() *healthServer {
+	s := &healthServer{
+		mux: http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		s.mutex.Lock()
+		checks := append([]healthCheck(nil), s.liveness...)
+		s.mutex.Unlock()
+
+		writeHealth(w, checks)
+	})
+	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		s.mutex.Lock()
+		checks := append(append([]healthCheck(nil), s.liveness...), s.readiness...)
+		s.mutex.Unlock()
+
+		writeHealth(w, checks)
+	})
+
+	return s
+}
+
+// AddLiveness adds a check which fails if the process is broken.
+func (s *healthServer) AddLiveness(name string, check func() error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.liveness = append(s.liveness, healthCheck{name: name, check: check})
+}
+
+// AddReadiness adds a check which fails if the process is not ready to
+// work, e.g. because it is still starting or shutting down.
+func (s *healthServer) AddReadiness(name string, check func() error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.readiness = append(s.readiness, healthCheck{name: name, check: check})
+}
+
+// Handle registers an additional handler.
+func (s *healthServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start starts serving on the given address, in the background.
+func (s *healthServer) Start(address string) {
+	go func() {
+		err := http.ListenAndServe(address, s.mux)
+		if err != nil {
+			fmt.Printf("HTTP server failed: %s\n", err.Error())
+		}
+	}()
+}
+
+// writeHealth runs the given checks, reporting their outcome as JSON.
+func writeHealth(w http.ResponseWriter, checks []healthCheck) {
+	status := http.StatusOK
+	response := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: "ok",
+		Checks: make(map[string]string),
+	}
+
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			status = http.StatusServiceUnavailable
+			response.Status = "fail"
+			response.Checks[c.name] = err.Error()
+		} else {
+			response.Checks[c.name] = "ok"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// redisHealth returns a check which fails if redis is not reachable.
+func redisHealth(client *redis.Client) func() error {
+	return func() error {
+		return client.Ping().Err()
+	}
+}
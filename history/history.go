@@ -0,0 +1,143 @@
+// Package history keeps a capped timeline of the results of every test, so
+// that it is possible to know when a test started failing, or how often it
+// failed recently.
+package history
+
+import (
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// The statuses of a result
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// Entry is a single result of a test.
+type Entry struct {
+	// When the result was published, as unix time
+	Time int64 `json:"time"`
+
+	// StatusPass or StatusFail
+	Status string `json:"status"`
+
+	// How long the test took, including retries, in milliseconds
+	DurationMs float64 `json:"durationMs"`
+
+	// Why the test failed, if it did
+	Error string `json:"error,omitempty"`
+
+	// Did the result match an active silence?
+	Silenced bool `json:"silenced,omitempty"`
+}
+
+// NewEntry creates the entry of the given result.
+func NewEntry(result *test.Result, duration time.Duration) Entry {
+	entry := Entry{
+		Time:       result.Time,
+		Status:     StatusPass,
+		DurationMs: float64(duration) / float64(time.Millisecond),
+		Silenced:   result.Silenced,
+	}
+	if result.Error != nil {
+		entry.Status = StatusFail
+		entry.Error = *result.Error
+	}
+	return entry
+}
+
+// Test describes a test with a history.
+type Test struct {
+	// The hash of the results of the test
+	Hash string `json:"hash"`
+
+	Input     string `json:"input"`
+	Target    string `json:"target"`
+	Type      string `json:"type"`
+	Tag       string `json:"tag,omitempty"`
+	TestLabel string `json:"testLabel,omitempty"`
+	Location  string `json:"location,omitempty"`
+}
+
+// NewTest describes the test of the given result.
+func NewTest(result *test.Result) Test {
+	t := Test{
+		Hash:     result.Hash(),
+		Input:    result.Input,
+		Target:   result.Target,
+		Type:     result.Type,
+		Tag:      result.Tag,
+		Location: result.Location,
+	}
+	if result.TestLabel != nil {
+		t.TestLabel = *result.TestLabel
+	}
+	return t
+}
+
+// Result returns a result describing the test, without any outcome, e.g.
+// to match it against filters.
+func (t Test) Result() *test.Result {
+	result := &test.Result{
+		Input:    t.Input,
+		Target:   t.Target,
+		Type:     t.Type,
+		Tag:      t.Tag,
+		Location: t.Location,
+	}
+	if t.TestLabel != "" {
+		label := t.TestLabel
+		result.TestLabel = &label
+	}
+	return result
+}
+
+// Change is a change of the status of a test.
+type Change struct {
+	Time int64
+	From string
+	To   string
+}
+
+// Changes returns the status changes within the given entries, oldest
+// first.
+func Changes(entries []Entry) []Change {
+	var changes []Change
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Status != entries[i-1].Status {
+			changes = append(changes, Change{
+				Time: entries[i].Time,
+				From: entries[i-1].Status,
+				To:   entries[i].Status,
+			})
+		}
+	}
+	return changes
+}
+
+// Since returns when the current status of the test started, as far as
+// the entries, oldest first, go, and true if it started before them.
+func Since(entries []Entry) (int64, bool) {
+	if len(entries) == 0 {
+		return 0, false
+	}
+
+	changes := Changes(entries)
+	if len(changes) == 0 {
+		return entries[0].Time, true
+	}
+	return changes[len(changes)-1].Time, false
+}
+
+// Failures returns how many of the entries are failures.
+func Failures(entries []Entry) int {
+	failures := 0
+	for _, entry := range entries {
+		if entry.Status == StatusFail {
+			failures++
+		}
+	}
+	return failures
+}
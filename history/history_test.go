@@ -0,0 +1,96 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func entries(statuses ...string) []Entry {
+	var result []Entry
+	for i, status := range statuses {
+		result = append(result, Entry{Time: int64(100 + i), Status: status})
+	}
+	return result
+}
+
+func TestNewEntry(t *testing.T) {
+	err := "connection refused"
+	entry := NewEntry(&test.Result{Time: 100, Error: &err}, 1500*time.Millisecond)
+
+	if entry.Time != 100 || entry.Status != StatusFail || entry.Error != err || entry.DurationMs != 1500 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+	if entry = NewEntry(&test.Result{Time: 100}, 0); entry.Status != StatusPass || entry.Error != "" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	changes := Changes(entries(StatusPass, StatusPass, StatusFail, StatusFail, StatusPass))
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %+v", changes)
+	}
+	if changes[0] != (Change{Time: 102, From: StatusPass, To: StatusFail}) || changes[1] != (Change{Time: 104, From: StatusFail, To: StatusPass}) {
+		t.Errorf("Unexpected changes %+v", changes)
+	}
+}
+
+func TestSince(t *testing.T) {
+	if since, before := Since(entries(StatusPass, StatusFail, StatusFail)); since != 101 || before {
+		t.Errorf("Expected failing since 101, got %d (%v)", since, before)
+	}
+	if since, before := Since(entries(StatusFail, StatusFail)); since != 100 || !before {
+		t.Errorf("Expected failing since before 100, got %d (%v)", since, before)
+	}
+	if _, before := Since(nil); before {
+		t.Errorf("An empty history has no status")
+	}
+}
+
+func TestFailures(t *testing.T) {
+	if failures := Failures(entries(StatusPass, StatusFail, StatusPass, StatusFail)); failures != 2 {
+		t.Errorf("Expected 2 failures, got %d", failures)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	minute := int64(60)
+	timeline := []Entry{
+		{Time: 0, Status: StatusFail},
+		{Time: 10 * minute, Status: StatusPass},
+		{Time: 20 * minute, Status: StatusFail},
+		{Time: 25 * minute, Status: StatusFail, Error: "maintenance"},
+		{Time: 35 * minute, Status: StatusFail},
+		{Time: 40 * minute, Status: StatusPass},
+		{Time: 50 * minute, Status: StatusFail},
+	}
+
+	// The first failure started before the period
+	from := time.Unix(5*minute, 0)
+	to := time.Unix(60*minute, 0)
+	stats := Compute(timeline, from, to, func(entry Entry) bool { return entry.Error == "maintenance" })
+
+	if stats.Up != 20*time.Minute || stats.Down != 25*time.Minute || stats.Excluded != 10*time.Minute {
+		t.Errorf("Unexpected times %+v", stats)
+	}
+	if stats.Incidents != 3 || stats.Resolved != 2 {
+		t.Errorf("Unexpected incidents %+v", stats)
+	}
+
+	// The excluded time within an incident does not count
+	if stats.Longest != 10*time.Minute || stats.MTTR() != 7*time.Minute+30*time.Second {
+		t.Errorf("Unexpected longest %s, MTTR %s", stats.Longest, stats.MTTR())
+	}
+	if uptime := stats.Uptime(); uptime < 44.44 || uptime > 44.45 {
+		t.Errorf("Unexpected uptime %f", uptime)
+	}
+
+	var total Stats
+	total.Add(stats)
+	total.Add(Compute(nil, from, to, nil))
+	if total != stats {
+		t.Errorf("Adding empty stats should not change anything")
+	}
+}
@@ -0,0 +1,147 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// The prefix of the lists holding the entries of each test, newest first
+const redisKeyPrefix = "overseer.history."
+
+// The hash describing the tests with a history, by hash
+const redisTestsKey = "overseer.history-tests"
+
+// RedisStore keeps the history of the tests in redis.
+//
+// The history of every test is capped to the given number of entries, and
+// forgotten if the test does not run for the given retention.
+type RedisStore struct {
+	client    *redis.Client
+	size      int
+	retention time.Duration
+}
+
+// NewRedisStore creates a store using the given client.
+func NewRedisStore(client *redis.Client, size int, retention time.Duration) *RedisStore {
+	return &RedisStore{
+		client:    client,
+		size:      size,
+		retention: retention,
+	}
+}
+
+// Record adds the given result, which took duration, to the history of
+// its test.
+func (s *RedisStore) Record(result *test.Result, duration time.Duration) error {
+	t := NewTest(result)
+	entry, err := json.Marshal(NewEntry(result, duration))
+	if err != nil {
+		return err
+	}
+	description, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	key := redisKeyPrefix + t.Hash
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(key, entry)
+		pipe.LTrim(key, 0, int64(s.size-1))
+		if s.retention > 0 {
+			pipe.Expire(key, s.retention)
+		}
+		pipe.HSet(redisTestsKey, t.Hash, description)
+		return nil
+	})
+	return err
+}
+
+// Tests returns all the tests with a history, sorted by input and target.
+func (s *RedisStore) Tests() ([]Test, error) {
+	values, err := s.client.HGetAll(redisTestsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []Test
+	for hash, value := range values {
+		var t Test
+		if err = json.Unmarshal([]byte(value), &t); err != nil {
+			return nil, fmt.Errorf("invalid test %s: %s", hash, err.Error())
+		}
+
+		// The history of the test has expired
+		exists, err := s.client.Exists(redisKeyPrefix + hash).Result()
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			s.client.HDel(redisTestsKey, hash)
+			continue
+		}
+
+		tests = append(tests, t)
+	}
+
+	sort.Slice(tests, func(i, j int) bool {
+		if tests[i].Input != tests[j].Input {
+			return tests[i].Input < tests[j].Input
+		}
+		return tests[i].Target < tests[j].Target
+	})
+	return tests, nil
+}
+
+// Find returns the tests with the given label, or input.
+//
+// If no test matches exactly, the tests whose input or target contain the
+// query are returned.
+func (s *RedisStore) Find(query string) ([]Test, error) {
+	tests, err := s.Tests()
+	if err != nil {
+		return nil, err
+	}
+
+	var exact, partial []Test
+	for _, t := range tests {
+		switch {
+		case t.TestLabel == query || t.Input == query:
+			exact = append(exact, t)
+		case strings.Contains(t.Input, query) || strings.Contains(t.Target, query):
+			partial = append(partial, t)
+		}
+	}
+
+	if len(exact) > 0 {
+		return exact, nil
+	}
+	return partial, nil
+}
+
+// Entries returns the last entries of the test with the given hash, oldest
+// first, or all of them if limit <= 0.
+func (s *RedisStore) Entries(hash string, limit int) ([]Entry, error) {
+	stop := int64(limit - 1)
+	if limit <= 0 {
+		stop = -1
+	}
+
+	values, err := s.client.LRange(redisKeyPrefix+hash, 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(values))
+	for i, value := range values {
+		if err = json.Unmarshal([]byte(value), &entries[len(values)-1-i]); err != nil {
+			return nil, fmt.Errorf("invalid history entry of %s: %s", hash, err.Error())
+		}
+	}
+	return entries, nil
+}
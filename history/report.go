@@ -0,0 +1,116 @@
+package history
+
+import (
+	"time"
+)
+
+// Stats is the availability of a test, or of a group of tests, over a
+// period of time.
+type Stats struct {
+	// How long the tests were passing, failing, or excluded, e.g. during
+	// maintenance windows
+	Up       time.Duration
+	Down     time.Duration
+	Excluded time.Duration
+
+	// How many times the tests started failing
+	Incidents int
+
+	// How many incidents ended within the period, and how long they lasted
+	// in total
+	Resolved int
+	Repair   time.Duration
+
+	// The longest incident
+	Longest time.Duration
+}
+
+// Uptime returns the percentage of the time the tests were passing, not
+// counting the excluded time.
+func (s Stats) Uptime() float64 {
+	if s.Up+s.Down == 0 {
+		return 100
+	}
+	return 100 * float64(s.Up) / float64(s.Up+s.Down)
+}
+
+// MTTR returns the mean time to repair of the resolved incidents.
+func (s Stats) MTTR() time.Duration {
+	if s.Resolved == 0 {
+		return 0
+	}
+	return s.Repair / time.Duration(s.Resolved)
+}
+
+// Add merges the stats of another test.
+func (s *Stats) Add(other Stats) {
+	s.Up += other.Up
+	s.Down += other.Down
+	s.Excluded += other.Excluded
+	s.Incidents += other.Incidents
+	s.Resolved += other.Resolved
+	s.Repair += other.Repair
+	if other.Longest > s.Longest {
+		s.Longest = other.Longest
+	}
+}
+
+// Compute returns the availability of a test between from and to, given
+// its entries, oldest first.
+//
+// The status of every entry lasts until the next one, or until to, and the
+// time of the entries for which excluded returns true is not counted.
+// Incidents are the runs of failures, ignoring the excluded entries in
+// between.
+func Compute(entries []Entry, from time.Time, to time.Time, excluded func(Entry) bool) Stats {
+	var stats Stats
+	var incident time.Duration
+	failing := false
+
+	for i, entry := range entries {
+		start := time.Unix(entry.Time, 0)
+		end := to
+		if i+1 < len(entries) {
+			end = time.Unix(entries[i+1].Time, 0)
+		}
+
+		// Only the part within the period counts
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+		duration := end.Sub(start)
+
+		switch {
+		case excluded != nil && excluded(entry):
+			stats.Excluded += duration
+
+		case entry.Status == StatusFail:
+			stats.Down += duration
+			if !failing {
+				failing = true
+				stats.Incidents++
+				incident = 0
+			}
+			incident += duration
+			if incident > stats.Longest {
+				stats.Longest = incident
+			}
+
+		default:
+			stats.Up += duration
+			if failing {
+				failing = false
+				stats.Resolved++
+				stats.Repair += incident
+			}
+		}
+	}
+
+	return stats
+}
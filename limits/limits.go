@@ -0,0 +1,252 @@
+// Package limits caps how many tests can run at the same time against the
+// same target, or of the same type, so that fragile services are not
+// probed by many workers at once.
+package limits
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Semaphore keeps track of the holders of limited resources.
+type Semaphore interface {
+	// TryAcquire adds the holder to the given key, unless it already has
+	// limit holders.
+	TryAcquire(key string, limit int, holder string) (bool, error)
+
+	// Release removes the holder from the given key.
+	Release(key string, holder string) error
+
+	// Refresh signals that the holder is still alive.
+	Refresh(key string, holder string) error
+}
+
+// Limits are the max number of tests running at the same time.
+type Limits struct {
+	// Per target, if > 0
+	PerTarget int
+
+	// Per test type
+	PerType map[string]int
+}
+
+// ParsePerType parses per-type limits, e.g. "smtp=3,http=10".
+func ParsePerType(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid limit '%s', expected type=limit", pair)
+		}
+
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit '%s', expected a number > 0", pair)
+		}
+
+		limits[strings.TrimSpace(parts[0])] = limit
+	}
+
+	return limits, nil
+}
+
+// Empty returns true if nothing is limited.
+func (l Limits) Empty() bool {
+	return l.PerTarget <= 0 && len(l.PerType) == 0
+}
+
+// Host returns the host of a test target, which can be an URL, so that
+// all the tests of the same host share their limit.
+func Host(target string) string {
+	if strings.Contains(target, "://") {
+		if u, err := url.Parse(target); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return target
+}
+
+// slot is a limited resource.
+type slot struct {
+	key   string
+	limit int
+}
+
+// Limiter acquires all the limited resources a test needs, before it runs.
+type Limiter struct {
+	limits    Limits
+	semaphore Semaphore
+
+	// How often to retry acquiring busy resources
+	poll time.Duration
+}
+
+// New creates a limiter, tracking holders via the given semaphore, and
+// checking for busy resources to be released every poll interval.
+func New(limits Limits, semaphore Semaphore, poll time.Duration) *Limiter {
+	return &Limiter{
+		limits:    limits,
+		semaphore: semaphore,
+		poll:      poll,
+	}
+}
+
+// slots returns the resources needed by a test, in a stable order, so that
+// holders never wait for each other.
+func (l *Limiter) slots(testType string, target string) []slot {
+	var slots []slot
+
+	if limit := l.limits.PerType[testType]; limit > 0 {
+		slots = append(slots, slot{key: "type." + testType, limit: limit})
+	}
+	if l.limits.PerTarget > 0 {
+		slots = append(slots, slot{key: "target." + Host(target), limit: l.limits.PerTarget})
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].key < slots[j].key })
+	return slots
+}
+
+// tryAcquire acquires all the given resources, or none.
+func (l *Limiter) tryAcquire(slots []slot, holder string) (bool, error) {
+	for i, s := range slots {
+		ok, err := l.semaphore.TryAcquire(s.key, s.limit, holder)
+		if err != nil || !ok {
+			for _, acquired := range slots[:i] {
+				l.semaphore.Release(acquired.key, holder)
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Lease is a set of acquired resources.
+type Lease struct {
+	limiter *Limiter
+	slots   []slot
+	holder  string
+
+	once sync.Once
+}
+
+// Release releases all the resources.  It can be invoked more than once,
+// and on a nil lease.
+func (l *Lease) Release() {
+	if l == nil {
+		return
+	}
+
+	l.once.Do(func() {
+		for _, s := range l.slots {
+			l.limiter.semaphore.Release(s.key, l.holder)
+		}
+	})
+}
+
+// Refresh signals that the holder of the resources is still alive.
+func (l *Lease) Refresh() error {
+	if l == nil {
+		return nil
+	}
+
+	for _, s := range l.slots {
+		if err := l.limiter.semaphore.Refresh(s.key, l.holder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TryAcquire acquires the resources needed to run a test of the given type
+// against the given target, returning a nil lease if any of them is busy.
+func (l *Limiter) TryAcquire(testType string, target string, holder string) (*Lease, error) {
+	slots := l.slots(testType, target)
+
+	ok, err := l.tryAcquire(slots, holder)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return &Lease{limiter: l, slots: slots, holder: holder}, nil
+}
+
+// Acquire acquires the resources needed to run a test of the given type
+// against the given target, waiting for them to be available, or for the
+// context to be done.
+func (l *Limiter) Acquire(ctx context.Context, testType string, target string, holder string) (*Lease, error) {
+	for {
+		lease, err := l.TryAcquire(testType, target, holder)
+		if lease != nil {
+			return lease, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(l.poll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// LocalSemaphore tracks holders within the current process.
+type LocalSemaphore struct {
+	mutex   sync.Mutex
+	holders map[string]map[string]bool
+}
+
+// NewLocalSemaphore creates a new, empty, local semaphore.
+func NewLocalSemaphore() *LocalSemaphore {
+	return &LocalSemaphore{
+		holders: make(map[string]map[string]bool),
+	}
+}
+
+func (s *LocalSemaphore) TryAcquire(key string, limit int, holder string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	holders := s.holders[key]
+	if holders == nil {
+		holders = make(map[string]bool)
+		s.holders[key] = holders
+	}
+
+	if !holders[holder] && len(holders) >= limit {
+		return false, nil
+	}
+
+	holders[holder] = true
+	return true, nil
+}
+
+func (s *LocalSemaphore) Release(key string, holder string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.holders[key], holder)
+	if len(s.holders[key]) == 0 {
+		delete(s.holders, key)
+	}
+	return nil
+}
+
+// Refresh does nothing, as local holders can't die without the process.
+func (s *LocalSemaphore) Refresh(key string, holder string) error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package limits
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParsePerType(t *testing.T) {
+	limits, err := ParsePerType("smtp=3, http=10")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(limits) != 2 || limits["smtp"] != 3 || limits["http"] != 10 {
+		t.Fatalf("Unexpected limits %v", limits)
+	}
+
+	for _, invalid := range []string{"smtp", "smtp=0", "smtp=many"} {
+		if _, err = ParsePerType(invalid); err == nil {
+			t.Errorf("Expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com:8443/path": "example.com",
+		"example.com":                   "example.com",
+		"1.2.3.4":                       "1.2.3.4",
+	}
+
+	for target, expected := range tests {
+		if host := Host(target); host != expected {
+			t.Errorf("Expected host %s for %s, got %s", expected, target, host)
+		}
+	}
+}
+
+func TestPerTarget(t *testing.T) {
+	l := New(Limits{PerTarget: 2}, NewLocalSemaphore(), time.Millisecond)
+
+	a, _ := l.TryAcquire("http", "https://example.com/a", "w1")
+	b, _ := l.TryAcquire("ssh", "example.com", "w2")
+	if a == nil || b == nil {
+		t.Fatalf("Expected two tests to run against the same target")
+	}
+
+	if c, _ := l.TryAcquire("http", "https://example.com/c", "w3"); c != nil {
+		t.Fatalf("Expected the third test against the same target to be limited")
+	}
+	if d, _ := l.TryAcquire("http", "https://example.org/", "w3"); d == nil {
+		t.Fatalf("Expected tests against other targets not to be limited")
+	}
+
+	a.Release()
+	a.Release()
+	if c, _ := l.TryAcquire("http", "https://example.com/c", "w3"); c == nil {
+		t.Fatalf("Expected the released slot to be available")
+	}
+}
+
+func TestPerTypeAllOrNothing(t *testing.T) {
+	l := New(Limits{PerTarget: 1, PerType: map[string]int{"smtp": 1}}, NewLocalSemaphore(), time.Millisecond)
+
+	a, _ := l.TryAcquire("http", "mail.example.com", "w1")
+	if a == nil {
+		t.Fatalf("Expected the first test to run")
+	}
+
+	// The target is busy, so the type must not stay acquired
+	if b, _ := l.TryAcquire("smtp", "mail.example.com", "w2"); b != nil {
+		t.Fatalf("Expected the busy target to be limited")
+	}
+	if c, _ := l.TryAcquire("smtp", "mail.example.org", "w3"); c == nil {
+		t.Fatalf("Expected the smtp slot to be available")
+	}
+}
+
+func TestAcquireWaits(t *testing.T) {
+	l := New(Limits{PerTarget: 1}, NewLocalSemaphore(), time.Millisecond)
+
+	a, _ := l.TryAcquire("http", "example.com", "w1")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		a.Release()
+	}()
+
+	b, err := l.Acquire(context.Background(), "http", "example.com", "w2")
+	if err != nil || b == nil {
+		t.Fatalf("Expected to acquire the released slot, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if c, err := l.Acquire(ctx, "http", "example.com", "w3"); c != nil || err == nil {
+		t.Fatalf("Expected to give up once the context is done")
+	}
+}
@@ -0,0 +1,74 @@
+package limits
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// The prefix of the keys holding the holders of each resource
+const redisKeyPrefix = "overseer.limits."
+
+// acquireScript adds a holder to a sorted set, scored by the expiry of its
+// lease, unless the set already has enough live holders.
+//
+//	KEYS[1] = holders set
+//	ARGV[1] = limit, ARGV[2] = holder, ARGV[3] = now, ARGV[4] = lease expiry
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+if redis.call('ZSCORE', KEYS[1], ARGV[2]) or redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call('ZADD', KEYS[1], ARGV[4], ARGV[2])
+	redis.call('PEXPIREAT', KEYS[1], ARGV[4])
+	return 1
+end
+return 0
+`)
+
+// RedisSemaphore tracks holders in redis, so that limits are shared by all
+// the workers.
+//
+// Every holder has a lease, which expires unless refreshed, so that the
+// resources of a dead worker are eventually released.
+type RedisSemaphore struct {
+	client *redis.Client
+	lease  time.Duration
+}
+
+// NewRedisSemaphore creates a semaphore, whose holders must refresh their
+// lease within the given duration.
+func NewRedisSemaphore(client *redis.Client, lease time.Duration) *RedisSemaphore {
+	return &RedisSemaphore{
+		client: client,
+		lease:  lease,
+	}
+}
+
+func (s *RedisSemaphore) expiry(now time.Time) int64 {
+	return now.Add(s.lease).UnixNano() / int64(time.Millisecond)
+}
+
+func (s *RedisSemaphore) TryAcquire(key string, limit int, holder string) (bool, error) {
+	now := time.Now()
+
+	res, err := acquireScript.Run(s.client, []string{redisKeyPrefix + key},
+		limit, holder, now.UnixNano()/int64(time.Millisecond), s.expiry(now)).Int64()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (s *RedisSemaphore) Release(key string, holder string) error {
+	return s.client.ZRem(redisKeyPrefix+key, holder).Err()
+}
+
+// Refresh extends the lease of the holder.
+func (s *RedisSemaphore) Refresh(key string, holder string) error {
+	expiry := s.expiry(time.Now())
+
+	pipe := s.client.TxPipeline()
+	pipe.ZAddXX(redisKeyPrefix+key, redis.Z{Score: float64(expiry), Member: holder})
+	pipe.PExpireAt(redisKeyPrefix+key, time.Unix(0, expiry*int64(time.Millisecond)))
+	_, err := pipe.Exec()
+	return err
+}
@@ -21,6 +21,13 @@ func main() {
 	subcommands.Register(&dumpCmd{}, "")
 	subcommands.Register(&enqueueCmd{}, "")
 	subcommands.Register(&examplesCmd{}, "")
+	subcommands.Register(&historyCmd{}, "")
+	subcommands.Register(&lintCmd{}, "")
+	subcommands.Register(&reportCmd{}, "")
+	subcommands.Register(&runCmd{}, "")
+	subcommands.Register(&scheduleCmd{}, "")
+	subcommands.Register(&silenceCmd{}, "")
+	subcommands.Register(&standaloneCmd{}, "")
 	subcommands.Register(&versionCmd{}, "")
 	subcommands.Register(&workerCmd{}, "")
 	subcommands.Register(&k8sEventWatcherCmd{}, "")
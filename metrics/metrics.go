@@ -0,0 +1,386 @@
+// Package metrics implements a minimal set of Prometheus metric types,
+// exposed via HTTP using the Prometheus text format:
+//
+//   https://prometheus.io/docs/instrumenting/exposition_formats/
+//
+// Every metric is a vector, identified by the values of its labels.
+//
+// Measurements can also be pushed to Graphite, StatsD, or InfluxDB, via a
+// Sink.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the default upper bounds of histogram buckets, in
+// seconds, suitable for network probes.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector is implemented by every metric.
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry contains a set of metrics, exposed together.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates a new, empty, registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes all the metrics, using the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mutex.Unlock()
+
+	var buf bytes.Buffer
+	for _, c := range collectors {
+		c.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP exposes the metrics.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// desc describes a metric vector.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// key returns the identifier of the given label values.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels formats the given label values, followed by the extra
+// label, if any.
+func (d *desc) formatLabels(values []string, extra ...string) string {
+	var pairs []string
+	for i, label := range d.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label, escapeLabel(values[i])))
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[0], escapeLabel(extra[1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// series holds the value of a metric for a set of label values.
+type series struct {
+	values []string
+	value  float64
+}
+
+// vector is a metric whose series hold a single value.
+type vector struct {
+	desc
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+func newVector(r *Registry, kind string, name string, help string, labels []string) *vector {
+	v := &vector{
+		desc:   desc{name: name, help: help, kind: kind, labels: labels},
+		series: make(map[string]*series),
+	}
+	r.register(v)
+	return v
+}
+
+func (v *vector) update(values []string, fn func(value float64) float64) {
+	key := v.key(values)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	s := v.series[key]
+	if s == nil {
+		s = &series{values: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	s.value = fn(s.value)
+}
+
+func (v *vector) get(values []string) float64 {
+	key := v.key(values)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if s := v.series[key]; s != nil {
+		return s.value
+	}
+	return 0
+}
+
+func (v *vector) write(w io.Writer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.writeHeader(w)
+	for _, key := range sortedKeys(v.series) {
+		s := v.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.formatLabels(s.values), formatFloat(s.value))
+	}
+}
+
+// CounterVec is a set of counters, partitioned by labels.
+type CounterVec struct {
+	*vector
+}
+
+// NewCounterVec creates and registers a new counter vector.
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVector(r, "counter", name, help, labels)}
+}
+
+// Inc increments the counter with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds the given, non-negative, amount to the counter with the given
+// label values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metric %s: counters cannot decrease", c.name))
+	}
+	c.update(values, func(value float64) float64 { return value + delta })
+}
+
+// Value returns the value of the counter with the given label values.
+func (c *CounterVec) Value(values ...string) float64 {
+	return c.get(values)
+}
+
+// GaugeVec is a set of gauges, partitioned by labels.
+type GaugeVec struct {
+	*vector
+}
+
+// NewGaugeVec creates and registers a new gauge vector.
+func (r *Registry) NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVector(r, "gauge", name, help, labels)}
+}
+
+// Set sets the gauge with the given label values.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.update(values, func(float64) float64 { return v })
+}
+
+// Add adds the given amount, which can be negative, to the gauge with the
+// given label values.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.update(values, func(value float64) float64 { return value + delta })
+}
+
+// Inc increments the gauge with the given label values.
+func (g *GaugeVec) Inc(values ...string) {
+	g.Add(1, values...)
+}
+
+// Dec decrements the gauge with the given label values.
+func (g *GaugeVec) Dec(values ...string) {
+	g.Add(-1, values...)
+}
+
+// Value returns the value of the gauge with the given label values.
+func (g *GaugeVec) Value(values ...string) float64 {
+	return g.get(values)
+}
+
+// gaugeFunc is a gauge without labels, whose value is computed when the
+// metrics are collected.
+type gaugeFunc struct {
+	desc
+	fn func() (float64, error)
+}
+
+// NewGaugeFunc creates and registers a gauge whose value is returned by the
+// given function, every time the metrics are collected.  If the function
+// fails, the gauge is omitted.
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() (float64, error)) {
+	r.register(&gaugeFunc{
+		desc: desc{name: name, help: help, kind: "gauge"},
+		fn:   fn,
+	})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	value, err := g.fn()
+	if err != nil {
+		return
+	}
+
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(value))
+}
+
+// histogramSeries holds the observations of a histogram for a set of label
+// values.
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a set of histograms, partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec creates and registers a new histogram vector, with the
+// given bucket upper bounds, or DefaultBuckets if nil.
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{
+			values: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns the number of observations of the histogram with the given
+// label values.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	key := h.key(values)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if s := h.series[key]; s != nil {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(s.values, "le", formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.formatLabels(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.formatLabels(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.formatLabels(s.values), s.count)
+	}
+}
+
+// sortedKeys returns the keys of the given series, sorted, so that the
+// output is stable.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch series := m.(type) {
+	case map[string]*series:
+		for key := range series {
+			keys = append(keys, key)
+		}
+	case map[string]*histogramSeries:
+		for key := range series {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(value string) string {
+	return helpEscaper.Replace(value)
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func output(r *Registry) string {
+	var buf bytes.Buffer
+	r.WriteTo(&buf)
+	return buf.String()
+}
+
+func TestCounter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("overseer_test_total", "Tests executed.", "type", "result")
+
+	c.Inc("http", "pass")
+	c.Inc("http", "pass")
+	c.Add(3, "ssh", "fail")
+
+	if c.Value("http", "pass") != 2 {
+		t.Fatalf("Unexpected value %f", c.Value("http", "pass"))
+	}
+
+	expected := `# HELP overseer_test_total Tests executed.
+# TYPE overseer_test_total counter
+overseer_test_total{type="http",result="pass"} 2
+overseer_test_total{type="ssh",result="fail"} 3
+`
+	if out := output(r); out != expected {
+		t.Fatalf("Unexpected output:\n%s", out)
+	}
+}
+
+func TestGauge(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("overseer_in_flight", "Running tests.", "type")
+
+	g.Inc("http")
+	g.Inc("http")
+	g.Dec("http")
+	g.Set(7, "ssh")
+
+	if g.Value("http") != 1 || g.Value("ssh") != 7 {
+		t.Fatalf("Unexpected values %f %f", g.Value("http"), g.Value("ssh"))
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("overseer_depth", "Queue depth.", func() (float64, error) {
+		return 12, nil
+	})
+	r.NewGaugeFunc("overseer_broken", "Failing.", func() (float64, error) {
+		return 0, errors.New("unavailable")
+	})
+
+	out := output(r)
+	if !strings.Contains(out, "overseer_depth 12\n") {
+		t.Fatalf("Missing gauge:\n%s", out)
+	}
+	if strings.Contains(out, "overseer_broken") {
+		t.Fatalf("Failing gauges should be omitted:\n%s", out)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("overseer_duration_seconds", "Durations.", []float64{1, 0.1}, "type")
+
+	h.Observe(0.05, "http")
+	h.Observe(0.5, "http")
+	h.Observe(5, "http")
+
+	if h.Count("http") != 3 {
+		t.Fatalf("Unexpected count %d", h.Count("http"))
+	}
+
+	expected := `# HELP overseer_duration_seconds Durations.
+# TYPE overseer_duration_seconds histogram
+overseer_duration_seconds_bucket{type="http",le="0.1"} 1
+overseer_duration_seconds_bucket{type="http",le="1"} 2
+overseer_duration_seconds_bucket{type="http",le="+Inf"} 3
+overseer_duration_seconds_sum{type="http"} 5.55
+overseer_duration_seconds_count{type="http"} 3
+`
+	if out := output(r); out != expected {
+		t.Fatalf("Unexpected output:\n%s", out)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("overseer_escaped", "Line\none.", "label")
+	c.Inc("a \"quoted\"\\value\n")
+
+	out := output(r)
+	if !strings.Contains(out, `# HELP overseer_escaped Line\none.`) {
+		t.Fatalf("Help not escaped:\n%s", out)
+	}
+	if !strings.Contains(out, `overseer_escaped{label="a \"quoted\"\\value\n"} 1`) {
+		t.Fatalf("Label not escaped:\n%s", out)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected a panic on wrong label count")
+		}
+	}()
+
+	r := NewRegistry()
+	c := r.NewCounterVec("overseer_labels", "Labels.", "a", "b")
+	c.Inc("only-one")
+}
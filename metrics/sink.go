@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The formats of the metrics sinks, used as URL schemes
+const (
+	// FormatGraphite is the plain carbon protocol, with hierarchical names
+	// e.g. overseer.test.http.example_com.duration
+	FormatGraphite = "graphite"
+
+	// FormatGraphiteTagged is the carbon protocol, with tagged series
+	// e.g. overseer.test.duration;type=http;target=example.com
+	FormatGraphiteTagged = "graphite-tagged"
+
+	// FormatStatsD is the StatsD protocol, with hierarchical names
+	FormatStatsD = "statsd"
+
+	// FormatDogStatsD is the DogStatsD protocol, with tags
+	FormatDogStatsD = "dogstatsd"
+
+	// FormatInflux is the InfluxDB line protocol
+	FormatInflux = "influx"
+)
+
+// The default ports of the formats
+var defaultPorts = map[string]string{
+	FormatGraphite:       "2003",
+	FormatGraphiteTagged: "2003",
+	FormatStatsD:         "8125",
+	FormatDogStatsD:      "8125",
+	FormatInflux:         "8089",
+}
+
+// Point is a single measurement.
+type Point struct {
+	// What is measured, e.g. test, and which value of it, e.g. duration
+	Measurement string
+	Field       string
+
+	// The hierarchical name, e.g. test.http.example_com.duration
+	Name string
+
+	Value float64
+	Time  time.Time
+
+	// The dimensions of the measurement, e.g. type=http, empty values are
+	// omitted
+	Tags map[string]string
+}
+
+var invalidNameChars = regexp.MustCompile("[^A-Za-z0-9]+")
+
+// NewPoint creates a point, whose hierarchical name is made of the
+// measurement, the path, and the field.
+//
+// Non alpha-numeric characters of the path are replaced by `_`.
+func NewPoint(measurement string, path []string, field string, value float64, tags map[string]string) Point {
+	name := []string{measurement}
+	for _, element := range path {
+		name = append(name, invalidNameChars.ReplaceAllString(element, "_"))
+	}
+	name = append(name, field)
+
+	return Point{
+		Measurement: measurement,
+		Field:       field,
+		Name:        strings.Join(name, "."),
+		Value:       value,
+		Time:        time.Now(),
+		Tags:        tags,
+	}
+}
+
+// tagKeys returns the keys of the non-empty tags of the point, sorted.
+func (p Point) tagKeys() []string {
+	var keys []string
+	for key, value := range p.Tags {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sink sends points to a metrics server.
+type Sink interface {
+	Send(points []Point) error
+	Close() error
+}
+
+// formatter writes a point in a format, e.g. a line of the carbon protocol.
+type formatter func(buf *bytes.Buffer, prefix string, p Point)
+
+var formatters = map[string]formatter{
+	FormatGraphite:       formatGraphite,
+	FormatGraphiteTagged: formatGraphiteTagged,
+	FormatStatsD:         formatStatsD,
+	FormatDogStatsD:      formatDogStatsD,
+	FormatInflux:         formatInflux,
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatGraphite(buf *bytes.Buffer, prefix string, p Point) {
+	fmt.Fprintf(buf, "%s.%s %s %d\n", prefix, p.Name, formatValue(p.Value), p.Time.Unix())
+}
+
+// Tag values can't contain ; nor ~, nor spaces, which break the protocol
+var graphiteTagReplacer = strings.NewReplacer(";", "_", "~", "_", " ", "_", "=", "_")
+
+func formatGraphiteTagged(buf *bytes.Buffer, prefix string, p Point) {
+	fmt.Fprintf(buf, "%s.%s.%s", prefix, p.Measurement, p.Field)
+	for _, key := range p.tagKeys() {
+		fmt.Fprintf(buf, ";%s=%s", key, graphiteTagReplacer.Replace(p.Tags[key]))
+	}
+	fmt.Fprintf(buf, " %s %d\n", formatValue(p.Value), p.Time.Unix())
+}
+
+func formatStatsD(buf *bytes.Buffer, prefix string, p Point) {
+	fmt.Fprintf(buf, "%s.%s:%s|g\n", prefix, p.Name, formatValue(p.Value))
+}
+
+var dogStatsDTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_")
+
+func formatDogStatsD(buf *bytes.Buffer, prefix string, p Point) {
+	fmt.Fprintf(buf, "%s.%s.%s:%s|g", prefix, p.Measurement, p.Field, formatValue(p.Value))
+	for i, key := range p.tagKeys() {
+		separator := ","
+		if i == 0 {
+			separator = "|#"
+		}
+		fmt.Fprintf(buf, "%s%s:%s", separator, key, dogStatsDTagReplacer.Replace(p.Tags[key]))
+	}
+	buf.WriteString("\n")
+}
+
+var influxTagReplacer = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
+
+func formatInflux(buf *bytes.Buffer, prefix string, p Point) {
+	fmt.Fprintf(buf, "%s_%s", influxTagReplacer.Replace(prefix), influxTagReplacer.Replace(p.Measurement))
+	for _, key := range p.tagKeys() {
+		fmt.Fprintf(buf, ",%s=%s", influxTagReplacer.Replace(key), influxTagReplacer.Replace(p.Tags[key]))
+	}
+	fmt.Fprintf(buf, " %s=%s %d\n", influxTagReplacer.Replace(p.Field), formatValue(p.Value), p.Time.UnixNano())
+}
+
+// netSink sends the points over UDP, or TCP, reconnecting if needed.
+type netSink struct {
+	network string
+	address string
+	prefix  string
+	format  formatter
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// NewSink creates a sink from a URL, e.g.
+//
+//   graphite://carbon:2003
+//   graphite-tagged+tcp://carbon:2003?prefix=overseer
+//   statsd://localhost:8125
+//   dogstatsd://localhost:8125
+//   influx+tcp://influxdb:8089
+//
+// The scheme is the format, optionally followed by the transport, udp by
+// default.  The names of the metrics start with the prefix parameter,
+// overseer by default.
+func NewSink(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics url '%s': %s", rawURL, err.Error())
+	}
+
+	format, network := u.Scheme, "udp"
+	if i := strings.Index(u.Scheme, "+"); i >= 0 {
+		format, network = u.Scheme[:i], u.Scheme[i+1:]
+	}
+
+	f := formatters[format]
+	if f == nil {
+		return nil, fmt.Errorf("unknown metrics format '%s', expected graphite, graphite-tagged, statsd, dogstatsd, or influx", format)
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unknown metrics transport '%s', expected udp, or tcp", network)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid metrics url '%s': missing host", rawURL)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[format]
+	}
+
+	prefix := u.Query().Get("prefix")
+	if prefix == "" {
+		prefix = "overseer"
+	}
+
+	return &netSink{
+		network: network,
+		address: net.JoinHostPort(u.Hostname(), port),
+		prefix:  prefix,
+		format:  f,
+	}, nil
+}
+
+// Send writes the points, each as a datagram over UDP, or all at once over
+// TCP.
+func (s *netSink) Send(points []Point) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	var err error
+	buf := &bytes.Buffer{}
+	if s.network == "tcp" {
+		for _, p := range points {
+			s.format(buf, s.prefix, p)
+		}
+		_, err = s.conn.Write(buf.Bytes())
+	} else {
+		for _, p := range points {
+			buf.Reset()
+			s.format(buf, s.prefix, p)
+			if _, err = s.conn.Write(buf.Bytes()); err != nil {
+				break
+			}
+		}
+	}
+
+	// Reconnect the next time
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *netSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
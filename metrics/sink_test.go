@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func testPoint() Point {
+	p := NewPoint("test", []string{"http", "example.com"}, "duration", 12.5, map[string]string{
+		"type":       "http",
+		"target":     "example.com",
+		"ip":         "1.2.3.4",
+		"test_label": "Web site",
+		"tag":        "",
+	})
+	p.Time = time.Unix(1000, 0)
+	return p
+}
+
+func TestFormats(t *testing.T) {
+	expected := map[string]string{
+		FormatGraphite:       "overseer.test.http.example_com.duration 12.5 1000\n",
+		FormatGraphiteTagged: "overseer.test.duration;ip=1.2.3.4;target=example.com;test_label=Web_site;type=http 12.5 1000\n",
+		FormatStatsD:         "overseer.test.http.example_com.duration:12.5|g\n",
+		FormatDogStatsD:      "overseer.test.duration:12.5|g|#ip:1.2.3.4,target:example.com,test_label:Web_site,type:http\n",
+		FormatInflux:         "overseer_test,ip=1.2.3.4,target=example.com,test_label=Web\\ site,type=http duration=12.5 1000000000000\n",
+	}
+
+	for format, line := range expected {
+		buf := &bytes.Buffer{}
+		formatters[format](buf, "overseer", testPoint())
+		if buf.String() != line {
+			t.Errorf("Unexpected %s line:\n%s\nexpected:\n%s", format, buf.String(), line)
+		}
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	s, err := NewSink("graphite-tagged+tcp://carbon?prefix=monitoring")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if ns := s.(*netSink); ns.network != "tcp" || ns.address != "carbon:2003" || ns.prefix != "monitoring" {
+		t.Errorf("Unexpected sink %+v", ns)
+	}
+
+	for _, invalid := range []string{"prometheus://host", "graphite+sctp://host", "statsd://", "::"} {
+		if _, err = NewSink(invalid); err == nil {
+			t.Errorf("Expected an error creating a sink from %s", invalid)
+		}
+	}
+}
+
+func TestSendTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer l.Close()
+
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	s, err := NewSink("statsd+tcp://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer s.Close()
+
+	p := testPoint()
+	if err = s.Send([]Point{p, p}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case line := <-lines:
+			if line != "overseer.test.http.example_com.duration:12.5|g" {
+				t.Errorf("Unexpected line %s", line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for the points")
+		}
+	}
+}
+
+func TestSendUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer conn.Close()
+
+	s, err := NewSink("influx://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer s.Close()
+
+	if err = s.Send([]Point{testPoint()}); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if !bytes.HasPrefix(buf[:n], []byte("overseer_test,")) {
+		t.Errorf("Unexpected datagram %s", buf[:n])
+	}
+}
@@ -0,0 +1,142 @@
+package parser
+
+// Includes
+//
+// Configuration files can include other files, e.g. so that the tests of
+// every team can share the same macros:
+//
+//   include "common/macros.conf"
+//   include "teams/*.conf"
+//
+// Relative paths are resolved from the directory of the including file,
+// globs are expanded, and directories include all their files.  Included
+// files are parsed with the same macros, and every file is read only once,
+// so that the same file can be included by many others.  A file including
+// itself, directly or not, is an error.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var includeLine = regexp.MustCompile(`^include\s+('.+'|".+"|\S+)$`)
+
+// includePattern returns the pattern of the given line, if it is an
+// include directive.
+func includePattern(line string) (string, bool) {
+	match := includeLine.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+
+	pattern := match[1]
+	if len(pattern) >= 2 && (pattern[0] == '"' || pattern[0] == '\'') && pattern[len(pattern)-1] == pattern[0] {
+		pattern = pattern[1 : len(pattern)-1]
+	}
+	return pattern, true
+}
+
+// fileKey identifies a file, regardless of the path used to read it.
+func fileKey(filename string) string {
+	if filename == "-" {
+		return filename
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filepath.Clean(filename)
+}
+
+// include returns the files included by the given pattern, from the given
+// file, making sure none of them is being read already.
+func (s *Parser) include(from string, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		dir := "."
+		if from != "-" {
+			dir = filepath.Dir(from)
+		}
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	var matches []string
+	if strings.ContainsAny(pattern, "*?[") {
+		var err error
+		matches, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern '%s': %s", pattern, err.Error())
+		}
+
+		// Files added to the directory change what is included
+		if dir := filepath.Dir(pattern); !strings.ContainsAny(dir, "*?[") {
+			s.sources = append(s.sources, dir)
+		}
+	} else {
+		if _, err := os.Stat(pattern); err != nil {
+			return nil, fmt.Errorf("cannot include '%s': %s", pattern, err.Error())
+		}
+		matches = []string{pattern}
+	}
+
+	var files []string
+	for _, match := range matches {
+		stat, err := os.Stat(match)
+		if err != nil {
+			return nil, fmt.Errorf("cannot include '%s': %s", match, err.Error())
+		}
+
+		if !stat.IsDir() {
+			files = append(files, match)
+			continue
+		}
+
+		dirFiles, err := s.directoryFiles(match)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, dirFiles...)
+	}
+
+	for _, file := range files {
+		if err := s.checkCycle(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// checkCycle returns an error if the given file is being read, as including
+// it would include itself.
+func (s *Parser) checkCycle(filename string) error {
+	key := fileKey(filename)
+	for i, reading := range s.reading {
+		if reading == key {
+			cycle := append(append([]string{}, s.reading[i:]...), key)
+			return fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+// directoryFiles returns the files of the given directory, sorted, except
+// for hidden files and subdirectories.
+func (s *Parser) directoryFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s - %s", dir, err.Error())
+	}
+	s.sources = append(s.sources, dir)
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	return files, nil
+}
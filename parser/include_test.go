@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// writeFiles creates the given files in a temporary directory, returning
+// its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "include")
+	if err != nil {
+		t.Fatalf("Error creating temporary-directory %s", err.Error())
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Error creating directory %s", err.Error())
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Error writing %s", err.Error())
+		}
+	}
+	return dir
+}
+
+// parseTargets parses the given file, returning the targets of its tests.
+func parseTargets(filename string) ([]string, error) {
+	var targets []string
+	err := New().ParseFile(filename, func(tst test.Test) error {
+		targets = append(targets, tst.Target)
+		return nil
+	})
+	sort.Strings(targets)
+	return targets, err
+}
+
+func TestInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"common/macros.conf": "WEB are a.example.com, b.example.com\n",
+		"common/.hidden":     "this is not a valid line\n",
+		"teams/web.conf":     "include \"../common/*.conf\"\nWEB must run ping\n",
+		"teams/db.conf":      "include '../common/macros.conf'\nWEB must run mysql\ndb.example.com must run mysql\n",
+		"main.conf":          "include teams\n",
+	})
+	defer os.RemoveAll(dir)
+
+	// Macros are shared, and the macros file is only read once
+	targets, err := parseTargets(filepath.Join(dir, "main.conf"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	expected := "a.example.com,a.example.com,b.example.com,b.example.com,db.example.com"
+	if strings.Join(targets, ",") != expected {
+		t.Errorf("Expected %s, got %v", expected, targets)
+	}
+
+	// Directories are parsed like includes
+	targets, err = parseTargets(filepath.Join(dir, "teams"))
+	if err != nil || len(targets) != 5 {
+		t.Errorf("Expected 5 tests, got %v (%v)", targets, err)
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"missing.conf": "include other.conf\n",
+		"a.conf":       "include b.conf\n",
+		"b.conf":       "http://example.com/ must run http\n\ninclude a.conf\n",
+		"nothing.conf": "include none/*.conf\n",
+		"bad.conf":     "include extra.conf\nhttp://example.com/ must run http with dedupp 5m\n",
+		"extra.conf":   "\nhttp://example.org/ must run http with pt-sleep 5s\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := parseTargets(filepath.Join(dir, "missing.conf"))
+	if err == nil || !strings.Contains(err.Error(), "missing.conf:1: cannot include") {
+		t.Errorf("Expected an error including a missing file, got %v", err)
+	}
+
+	_, err = parseTargets(filepath.Join(dir, "a.conf"))
+	if err == nil || !strings.Contains(err.Error(), "b.conf:3: include cycle") {
+		t.Errorf("Expected an include cycle, got %v", err)
+	}
+
+	// Globs can match nothing
+	if _, err = parseTargets(filepath.Join(dir, "nothing.conf")); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	// The errors of the included files are reported with their position
+	l := NewLinter()
+	if err = l.LintFile(filepath.Join(dir, "bad.conf")); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 2 ||
+		!strings.HasSuffix(diagnostics[0].File, "bad.conf") || diagnostics[0].Line != 2 ||
+		!strings.HasSuffix(diagnostics[1].File, "extra.conf") || diagnostics[1].Line != 2 {
+		t.Errorf("Unexpected problems %v", diagnostics)
+	}
+}
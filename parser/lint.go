@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cmaster11/overseer/protocols"
+	"github.com/cmaster11/overseer/test"
+)
+
+// Diagnostic is a problem found in a configuration file.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// aliases are the alternative names of some options
+var aliases = map[string]string{
+	"period-test-duration":  "pt-duration",
+	"period-test-sleep":     "pt-sleep",
+	"period-test-threshold": "pt-threshold",
+}
+
+// conflicts are the options which make no sense together.
+var conflicts = []struct {
+	option string
+	with   string
+	reason string
+}{
+	{"dedup", "pt-duration", "period-tests already aggregate their results over time"},
+	{"min-duration", "pt-duration", "period-tests already aggregate their results over time"},
+	{"flap-window", "pt-duration", "period-tests already aggregate their results over time"},
+}
+
+// requirements are the options which have no effect without another one.
+var requirements = []struct {
+	option   string
+	requires string
+}{
+	{"pt-sleep", "pt-duration"},
+	{"pt-threshold", "pt-duration"},
+}
+
+// Macro-names which look like they were meant to be macros
+var macroLike = regexp.MustCompile(`^[A-Z0-9]*[A-Z][A-Z0-9]*$`)
+
+// Linter checks configuration files, reporting all their problems, with
+// their position, instead of stopping at the first one like ParseFile.
+//
+// Besides the errors which ParseFile would report, it also finds duplicate
+// tests, across all the checked files, unused macros, and options which
+// conflict with each other, or have no effect.
+//
+// Included files are checked too, once per checked file including them.
+type Linter struct {
+	diagnostics []Diagnostic
+
+	// The order in which files were checked, to sort the diagnostics
+	files map[string]int
+
+	// Where every test was first defined, to find the duplicates
+	tests map[string]Diagnostic
+
+	// Where every macro is defined, and whether it is used by any of the
+	// checked files
+	macros map[string]Diagnostic
+	used   map[string]bool
+}
+
+// NewLinter creates a linter, without any problem yet.
+func NewLinter() *Linter {
+	return &Linter{
+		files:  make(map[string]int),
+		tests:  make(map[string]Diagnostic),
+		macros: make(map[string]Diagnostic),
+		used:   make(map[string]bool),
+	}
+}
+
+// Diagnostics returns the problems found so far, sorted by file and
+// position.
+//
+// The problems of a file included by many checked files are only returned
+// once.
+func (l *Linter) Diagnostics() []Diagnostic {
+	diagnostics := append([]Diagnostic{}, l.diagnostics...)
+
+	for key, d := range l.macros {
+		if !l.used[key] {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.File != b.File {
+			return l.files[a.File] < l.files[b.File]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	var result []Diagnostic
+	for i, d := range diagnostics {
+		if i > 0 && d == diagnostics[i-1] {
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// report records a problem at the given offset of a line.
+func (l *Linter) report(line Line, offset int, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, l.diagnostic(line, offset, format, args...))
+}
+
+// diagnostic returns a problem at the given offset of a line.
+func (l *Linter) diagnostic(line Line, offset int, format string, args ...interface{}) Diagnostic {
+	number, column := line.Position(offset)
+	return Diagnostic{
+		File:    line.File,
+		Line:    number,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// fileLint is the state of the linting of a single file, and of the files
+// it includes, as they share the same macros.
+type fileLint struct {
+	*Linter
+
+	parser *Parser
+
+	// Which macro definition each name refers to
+	names map[string]string
+}
+
+// LintFile checks the given file, and the files it includes.  An error is
+// only returned if the file cannot be read: its problems are added to the
+// diagnostics.
+func (l *Linter) LintFile(filename string) error {
+	f := &fileLint{
+		Linter: l,
+		parser: New(),
+		names:  make(map[string]string),
+	}
+
+	return f.parser.readFile(filename, func(line Line) error {
+		f.lintLine(line)
+		return nil
+	})
+}
+
+// lintLine checks a single line, which is either a variable definition, an
+// include directive, a macro definition or a test.
+func (f *fileLint) lintLine(line Line) {
+	if _, ok := f.files[line.File]; !ok {
+		f.files[line.File] = len(f.files)
+	}
+
+	// Problems are found in the expanded line, but reported where they
+	// are in the original one
+	expanded, err := f.parser.expansion(line.Text)
+	if err != nil {
+		offset := 0
+		if e, ok := err.(*expansionError); ok {
+			offset = e.offset
+		}
+		f.report(line, offset, "%s", err.Error())
+		return
+	}
+	input := expanded.text
+	at := expanded.originalOffset
+
+	if name, value, ok := variableDefinition(input); ok {
+		if err = f.parser.define(name, value); err != nil {
+			f.report(line, 0, "%s", err.Error())
+		}
+		return
+	}
+
+	if pattern, ok := includePattern(input); ok {
+		files, err := f.parser.include(line.File, pattern)
+		if err != nil {
+			f.report(line, 0, "%s", err.Error())
+			return
+		}
+
+		for _, file := range files {
+			err = f.parser.readFile(file, func(line Line) error {
+				f.lintLine(line)
+				return nil
+			})
+			if err != nil {
+				f.report(line, 0, "%s", err.Error())
+			}
+		}
+		return
+	}
+
+	macro := regexp.MustCompile(`^([A-Z0-9]+)\s+are\s+(.*)$`)
+	if macro.MatchString(input) {
+		name := macro.FindStringSubmatch(input)[1]
+		if key, ok := f.names[name]; ok {
+			first := f.macros[key]
+			f.report(line, 0, "macro '%s' is already defined at %s:%d:%d", name, first.File, first.Line, first.Column)
+			return
+		}
+
+		f.parser.ParseLine(input, nil)
+
+		d := f.diagnostic(line, 0, "macro '%s' is never used", name)
+		key := fmt.Sprintf("%s:%d:%s", d.File, d.Line, name)
+		f.names[name] = key
+		f.macros[key] = d
+		return
+	}
+
+	re := regexp.MustCompile(`^([^ \t]+)\s+must\s+run\s+([^\s]+)`)
+	match := re.FindStringSubmatchIndex(input)
+	if match == nil {
+		f.report(line, 0, "unrecognized line, expected 'TARGET must run TYPE [with OPTION VALUE]...', 'MACRO are HOST1, HOST2...', 'SET NAME = VALUE' or 'include FILES'")
+		return
+	}
+
+	target := input[match[2]:match[3]]
+	testType := input[match[4]:match[5]]
+
+	targets := []string{target}
+	if hosts := f.parser.MACROS[target]; len(hosts) > 0 {
+		f.used[f.names[target]] = true
+		targets = hosts
+	} else if macroLike.MatchString(target) {
+		f.report(line, at(match[2]), "target '%s' looks like a macro, but no macro with this name is defined before this line", target)
+	}
+
+	handler := protocols.ProtocolHandler(testType)
+	if handler == nil {
+		f.report(line, at(match[4]), "unknown test-type '%s'%s", testType, didYouMean(testType, protocols.Handlers()))
+		return
+	}
+	expected := handler.Arguments()
+
+	tst := test.Test{
+		Target:    target,
+		Type:      testType,
+		Input:     input,
+		Arguments: make(map[string]string),
+	}
+
+	// Where each option is, the last occurrence being the one used
+	offsets := make(map[string]int)
+	values := make(map[string]string)
+	for _, arg := range f.parser.arguments(input) {
+		name := arg.name
+		if alias, ok := aliases[name]; ok {
+			name = alias
+		}
+
+		if _, repeated := offsets[name]; repeated {
+			f.report(line, at(arg.offset), "option '%s' is repeated, only its last value is used", arg.name)
+		}
+		offsets[name] = arg.offset
+		values[name] = arg.value
+
+		if err := f.parser.parseArgument(&tst, expected, arg.name, arg.value); err != nil {
+			f.report(line, at(arg.offset), "%s", withoutInput(err, input))
+		}
+	}
+
+	if err := validateTest(tst); err != nil {
+		f.report(line, 0, "%s", withoutInput(err, input))
+	}
+
+	for _, c := range conflicts {
+		if _, ok := offsets[c.option]; !ok {
+			continue
+		}
+		if offset, ok := offsets[c.with]; ok {
+			f.report(line, at(offset), "option '%s' conflicts with '%s': %s", c.with, c.option, c.reason)
+		}
+	}
+	for _, r := range requirements {
+		offset, ok := offsets[r.option]
+		if !ok {
+			continue
+		}
+		if _, ok = offsets[r.requires]; !ok {
+			f.report(line, at(offset), "option '%s' has no effect without '%s'", r.option, r.requires)
+		}
+	}
+
+	here := f.diagnostic(line, 0, "")
+	for _, host := range targets {
+		key := testKey(host, testType, values)
+
+		// The same line, included by many checked files, is not a
+		// duplicate
+		if first, ok := f.tests[key]; ok && first != here {
+			f.report(line, 0, "duplicate test '%s must run %s', already defined at %s:%d:%d", host, testType, first.File, first.Line, first.Column)
+			continue
+		}
+
+		f.tests[key] = here
+	}
+}
+
+// testKey identifies a test, regardless of the order of its options.
+func testKey(target string, testType string, values map[string]string) string {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := target + " must run " + testType
+	for _, name := range names {
+		key += fmt.Sprintf(" with %s %q", name, values[name])
+	}
+	return key
+}
+
+// withoutInput returns the message of a parsing error, without the input
+// of the test, which the position of the problem already points to.
+func withoutInput(err error, input string) string {
+	return strings.Replace(err.Error(), fmt.Sprintf(" in input '%s'", input), "", 1)
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// lintLines lints the given configuration, returning the problems found.
+func lintLines(t *testing.T, lines string) []Diagnostic {
+	file, err := ioutil.TempFile(os.TempDir(), "lint")
+	if err != nil {
+		t.Fatalf("Error creating temporary-file %s", err.Error())
+	}
+	defer os.Remove(file.Name())
+
+	if err = ioutil.WriteFile(file.Name(), []byte(lines), 0644); err != nil {
+		t.Fatalf("Error writing our test-case")
+	}
+
+	l := NewLinter()
+	if err = l.LintFile(file.Name()); err != nil {
+		t.Fatalf("Unexpected error %s", err.Error())
+	}
+	return l.Diagnostics()
+}
+
+func TestLintValid(t *testing.T) {
+	diagnostics := lintLines(t, `
+HOSTS are a.example.com, b.example.com
+# A comment
+HOSTS must run ping
+http://example.com/ must run http with status 200 \
+    with dedup 5m
+`)
+	if len(diagnostics) != 0 {
+		t.Errorf("Expected no problems, got %v", diagnostics)
+	}
+}
+
+func TestLintProblems(t *testing.T) {
+	diagnostics := lintLines(t, `UNUSED are c.example.com
+http://example.com/ must run htp
+http://example.com/ must run http \
+  with dedupp 5m
+http://example.com/ must run http with status abc
+http://example.com/ must run http with pt-duration 1m with dedup 5m
+http://example.com/ must run http with dedup 5m with pt-duration 1m
+foo bar
+`)
+
+	expected := []struct {
+		line    int
+		column  int
+		message string
+	}{
+		{1, 1, "macro 'UNUSED' is never used"},
+		{2, 30, "did you mean 'ftp' or 'http'?"},
+		{4, 8, "did you mean 'dedup'?"},
+		{5, 40, "did not match pattern"},
+		{6, 40, "option 'pt-duration' conflicts with 'dedup'"},
+		{7, 1, "duplicate test"},
+		{7, 54, "option 'pt-duration' conflicts with 'dedup'"},
+		{8, 1, "unrecognized line"},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+
+	for i, e := range expected {
+		d := diagnostics[i]
+		if d.Line != e.line || d.Column != e.column || !strings.Contains(d.Message, e.message) {
+			t.Errorf("Expected %d:%d: %s, got %s", e.line, e.column, e.message, d)
+		}
+	}
+}
+
+// Test the options listed for suggestions are all handled
+func TestOptions(t *testing.T) {
+	for _, option := range options {
+		tst := New()
+		_, err := tst.ParseLine("http://example.com/ must run http with "+option+" 'invalid value'", nil)
+		if err != nil && strings.Contains(err.Error(), "unsupported argument") {
+			t.Errorf("Option %s is not handled: %s", option, err.Error())
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"dedup", "min-duration", "timeout"}
+
+	if s := suggest("dedupp", candidates); len(s) != 1 || s[0] != "dedup" {
+		t.Errorf("Unexpected suggestions %v", s)
+	}
+	if s := suggest("min-durations", candidates); len(s) != 1 || s[0] != "min-duration" {
+		t.Errorf("Unexpected suggestions %v", s)
+	}
+	if s := suggest("retries", candidates); len(s) != 0 {
+		t.Errorf("Unexpected suggestions %v", s)
+	}
+}
@@ -21,11 +21,17 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
+	"github.com/cmaster11/overseer/alert"
 	"github.com/cmaster11/overseer/protocols"
+	"github.com/cmaster11/overseer/queue"
+	"github.com/cmaster11/overseer/retry"
+	"github.com/cmaster11/overseer/secret"
 	"github.com/cmaster11/overseer/test"
 	"github.com/cmaster11/overseer/utils"
 )
@@ -36,6 +42,17 @@ type Parser struct {
 	//
 	// Macros comprise of a name and a list of hostnames.
 	MACROS map[string][]string
+
+	// The variables defined so far, as described in variables.go
+	variables map[string]string
+
+	// The files which have been read, as each is only read once, and
+	// those being read, innermost last, to detect include cycles.
+	read    map[string]bool
+	reading []string
+
+	// The files, and directories, the configuration comes from
+	sources []string
 }
 
 // ParsedTest is the function-signature of a callback function
@@ -46,6 +63,8 @@ type ParsedTest func(x test.Test) error
 func New() *Parser {
 	m := new(Parser)
 	m.MACROS = make(map[string][]string)
+	m.variables = make(map[string]string)
+	m.read = make(map[string]bool)
 	return m
 }
 
@@ -72,7 +91,138 @@ func (s *Parser) executable(path string) (bool, error) {
 
 // ParseFile processes the filename specified, invoking the supplied
 // callback for every test-case which has been successfully parsed.
+//
+// Parsing stops at the first invalid line, whose error includes the
+// position of the line in the file.
+//
+// Files can include other files, as described in include.go, which are
+// parsed with the same macros and variables.  A directory is parsed like
+// an include of all its files.
+//
+// The references to variables, described in variables.go, are expanded
+// before each line is parsed.
 func (s *Parser) ParseFile(filename string, cb ParsedTest) error {
+	return s.readFile(filename, func(l Line) error {
+		text, err := s.expand(l.Text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", l.File, l.Number, err.Error())
+		}
+
+		if name, value, ok := variableDefinition(text); ok {
+			if err = s.define(name, value); err != nil {
+				return fmt.Errorf("%s:%d: %s", l.File, l.Number, err.Error())
+			}
+			return nil
+		}
+
+		if pattern, ok := includePattern(text); ok {
+			files, err := s.include(l.File, pattern)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", l.File, l.Number, err.Error())
+			}
+
+			for _, file := range files {
+				if err = s.ParseFile(file, cb); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		_, err = s.ParseLine(text, cb)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", l.File, l.Number, err.Error())
+		}
+		return nil
+	})
+}
+
+// Sources returns the files read so far, and the directories whose
+// contents determined which files were read, e.g. to watch them for
+// changes.
+func (s *Parser) Sources() []string {
+	return s.sources
+}
+
+// Line is a logical line of a configuration file, which can span multiple
+// lines of the file, if they end with "\".
+type Line struct {
+	// The file the line comes from
+	File string
+
+	// The text of the line, without leading/trailing space, and joined
+	// with its continuation lines
+	Text string
+
+	// The number of the first line, starting from 1
+	Number int
+
+	// Where each of the lines joined in Text starts
+	parts []linePart
+}
+
+// linePart is a line of the file, which is part of a logical line.
+type linePart struct {
+	// Where the line starts in the text of the logical line
+	offset int
+
+	// The number of the line, and the column of its first non-space
+	// character, starting from 1
+	number int
+	column int
+}
+
+// Position returns the line and column, in the file, of the given offset
+// in the text of the line.
+func (l Line) Position(offset int) (int, int) {
+	part := linePart{number: l.Number, column: 1}
+	for _, p := range l.parts {
+		if p.offset > offset {
+			break
+		}
+		part = p
+	}
+	return part.number, part.column + offset - part.offset
+}
+
+// readFile invokes the supplied callback for every logical line of the
+// given file, skipping empty lines and comments.
+//
+// An executable file is executed, and its output read instead of its
+// contents, while "-" reads from stdin.  The files of a directory are read
+// in turn, and files which have already been read are skipped.
+func (s *Parser) readFile(filename string, cb func(l Line) error) error {
+
+	if filename != "-" {
+		stat, err := os.Stat(filename)
+		if err == nil && stat.IsDir() {
+			files, err := s.directoryFiles(filename)
+			if err != nil {
+				return err
+			}
+			for _, file := range files {
+				if err = s.readFile(file, cb); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	key := fileKey(filename)
+	if s.read[key] {
+		return nil
+	}
+	if s.read == nil {
+		s.read = make(map[string]bool)
+	}
+	s.read[key] = true
+	s.sources = append(s.sources, filename)
+
+	s.reading = append(s.reading, key)
+	defer func() {
+		s.reading = s.reading[:len(s.reading)-1]
+	}()
 
 	// This is the scanner we'll use
 	var scanner *bufio.Scanner
@@ -113,47 +263,57 @@ func (s *Parser) ParseFile(filename string, cb ParsedTest) error {
 	}
 
 	//
-	// We read into this string.
+	// We read into this line.
 	//
-	line := ""
+	line := Line{File: filename}
+	number := 0
 
 	//
 	// Loop
 	//
 	for scanner.Scan() {
+		number++
 
 		//
 		// Get the line, and strip leading/trailing space.
 		//
-		tmp := scanner.Text()
-		tmp = strings.TrimSpace(tmp)
+		raw := scanner.Text()
+		tmp := strings.TrimSpace(raw)
 
 		//
-		// Append to our existing line.
+		// Append to our existing line, remembering where this part
+		// comes from.
 		//
-		line += tmp
+		if line.Number == 0 {
+			line.Number = number
+		}
+		line.parts = append(line.parts, linePart{
+			offset: len(line.Text),
+			number: number,
+			column: len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace)) + 1,
+		})
+		line.Text += tmp
 
 		//
 		// If the line ends with "\" then we remove
 		// that character, and repeat.
 		//
-		if strings.HasSuffix(line, "\\") {
-			line = strings.TrimSuffix(line, "\\")
+		if strings.HasSuffix(line.Text, "\\") {
+			line.Text = strings.TrimSuffix(line.Text, "\\")
 			continue
 		}
 
 		//
 		// OK we've either got a line that doesn't end
 		// with this, or we'll add
-		line = strings.TrimSpace(line)
+		line.Text = strings.TrimSpace(line.Text)
 
 		//
 		// If the line wasn't empty, and didn't start with
 		// a comment then process it.
 		//
-		if (line != "") && (!strings.HasPrefix(line, "#")) {
-			_, err := s.ParseLine(line, cb)
-			if err != nil {
+		if (line.Text != "") && (!strings.HasPrefix(line.Text, "#")) {
+			if err := cb(line); err != nil {
 				return err
 			}
 		}
@@ -161,7 +321,7 @@ func (s *Parser) ParseFile(filename string, cb ParsedTest) error {
 		//
 		// OK we've processed the line.
 		//
-		line = ""
+		line = Line{File: filename}
 	}
 
 	//
@@ -253,7 +413,7 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 	//
 	handler := protocols.ProtocolHandler(testType)
 	if handler == nil {
-		return result, fmt.Errorf("unknown test-type '%s' in input '%s'", testType, input)
+		return result, fmt.Errorf("unknown test-type '%s' in input '%s'%s", testType, input, didYouMean(testType, protocols.Handlers()))
 	}
 
 	//
@@ -299,7 +459,9 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 			//
 			// Call ourselves to run the test.
 			//
-			s.ParseLine(newTst, cb)
+			if _, err := s.ParseLine(newTst, cb); err != nil {
+				return result, err
+			}
 		}
 
 		//
@@ -332,151 +494,330 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 	// For each argument which was supplied..
 	//
 	for arg, val := range arguments {
-		switch arg {
-		// Is there a custom per-test override?
-		case "retries":
-			maxRetries, err := strconv.ParseInt(val, 10, 0)
-			if err != nil {
-				return result, fmt.Errorf("non-numeric argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
-			if maxRetries < 0 {
-				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be >= 0", arg, testType, input)
-			}
-			maxRetriesUInt := uint(maxRetries)
-			result.MaxRetries = &maxRetriesUInt
-			continue
+		if err := s.parseArgument(&result, expected, arg, val); err != nil {
+			return result, err
+		}
+	}
 
-			// Do not re-trigger same errors for the specified amount of time, or until test succeeds again
-		case "dedup":
-			duration, err := time.ParseDuration(val)
-			if err != nil {
-				return result, fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
+	if err := validateTest(result); err != nil {
+		return result, err
+	}
 
-			if duration < 0 {
-				return result, fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
-			}
+	//
+	// Invoke the user-supplied callback on this parsed test.
+	//
+	//
+	// Ensure that we have a callback.
+	//
+	if cb != nil {
+		cb(result)
+	}
 
-			result.DedupDuration = &duration
-			continue
+	return result, nil
+}
 
-			// Do not trigger same errors unless they have been happening for this defined minimum duration
-		case "min-duration":
-			duration, err := time.ParseDuration(val)
-			if err != nil {
-				return result, fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
+// parseArgument parses the given argument of a test, which is either one of
+// the options common to all the tests, or one of the arguments of its
+// type, whose values must match the expected patterns.
+//
+func (s *Parser) parseArgument(result *test.Test, expected map[string]string, arg string, val string) error {
+	testType := result.Type
+	input := result.Input
+
+	switch arg {
+	// Is there a custom per-test override?
+	case "retries":
+		maxRetries, err := strconv.ParseInt(val, 10, 0)
+		if err != nil {
+			return fmt.Errorf("non-numeric argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+		if maxRetries < 0 {
+			return fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be >= 0", arg, testType, input)
+		}
+		maxRetriesUInt := uint(maxRetries)
+		result.MaxRetries = &maxRetriesUInt
+		return nil
+
+	case "retry-delay", "retry-max-delay":
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+		if duration < 0 {
+			return fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
+		}
 
-			if duration < 0 {
-				return result, fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
-			}
+		if arg == "retry-delay" {
+			result.RetryDelay = &duration
+		} else {
+			result.RetryMaxDelay = &duration
+		}
+		return nil
+	case "retry-backoff":
+		if err := retry.ValidateBackoff(val); err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
 
-			result.MinDuration = &duration
-			continue
+		result.RetryBackoff = val
+		return nil
+	case "retry-jitter":
+		percentage, err := utils.ParsePercentage(val)
+		if err != nil {
+			return fmt.Errorf("non-percentage argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
 
-			// Expire min-duration cache by this lifetime factor
-		case "min-duration-cache-factor":
-			factor64, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return result, fmt.Errorf("non-uint argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
+		result.RetryJitter = &percentage
+		return nil
+	case "retry-on":
+		classes, err := retry.ParseClasses(val)
+		if err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
 
-			factor := uint(factor64)
+		result.RetryOn = classes
+		return nil
 
-			result.MinDurationCacheFactor = factor
-			continue
+		// Which job queue the test is enqueued to
+	case "priority":
+		if err := queue.ValidatePriority(val); err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
 
-			// Override worker-default timeout
-		case "timeout":
-			duration, err := time.ParseDuration(val)
-			if err != nil {
-				return result, fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
+		result.Priority = val
+		return nil
 
-			if duration < 0 {
-				return result, fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
-			}
+		// Which locations the test runs from
+	case "run-from":
+		locations, err := queue.ParseLocations(val)
+		if err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
 
-			result.Timeout = &duration
-			continue
+		result.RunFrom = locations
+		return nil
+	case "quorum":
+		if _, err := alert.ParseQuorum(val); err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
 
-		case "pt-duration", "period-test-duration":
-			duration, err := time.ParseDuration(val)
-			if err != nil {
-				return result, fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
-			if duration < 0 {
-				return result, fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
-			}
+		result.Quorum = val
+		return nil
 
-			result.PeriodTestDuration = &duration
-			continue
-		case "pt-sleep", "period-test-sleep":
-			duration, err := time.ParseDuration(val)
-			if err != nil {
-				return result, fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
-			if duration < 0 {
-				return result, fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
-			}
+		// Do not re-trigger same errors for the specified amount of time, or until test succeeds again
+	case "dedup":
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
 
-			result.PeriodTestSleep = duration
-			continue
-		case "pt-threshold", "period-test-threshold":
-			percentage, err := utils.ParsePercentage(val)
-			if err != nil {
-				return result, fmt.Errorf("non-percentage argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
-			}
+		if duration < 0 {
+			return fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
+		}
 
-			result.PeriodTestThreshold = &percentage
-			continue
-		case "max-targets":
-			maxTargets, err := strconv.ParseInt(val, 10, 32)
-			if err != nil {
-				return result, fmt.Errorf("non-numeric argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
-			}
+		result.DedupDuration = &duration
+		return nil
 
-			result.MaxTargetsCount = int(maxTargets)
-			continue
-		case "test-label":
-			valCopy := val
-			result.TestLabel = &valCopy
-			continue
+		// Do not trigger same errors unless they have been happening for this defined minimum duration
+	case "min-duration":
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
 		}
 
-		//
-		// Is that argument present in the arguments the
-		// tester supports?
-		//
-		pattern := expected[arg]
-		if pattern == "" {
-			return result, fmt.Errorf("unsupported argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		if duration < 0 {
+			return fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
 		}
 
-		//
-		// Otherwise we need to look for a match
-		//
-		expr := regexp.MustCompile(pattern)
-		match := expr.FindStringSubmatch(val)
+		result.MinDuration = &duration
+		return nil
+
+		// Expire min-duration cache by this lifetime factor
+	case "min-duration-cache-factor":
+		factor64, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return fmt.Errorf("non-uint argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+
+		factor := uint(factor64)
+
+		result.MinDurationCacheFactor = factor
+		return nil
+
+		// Override worker-default timeout
+	case "timeout":
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
 
-		if match == nil {
-			return result, fmt.Errorf("unsupported argument '%s' for test-type '%s' in input '%s' - did not match pattern '%s'", arg, testType, input, pattern)
+		if duration < 0 {
+			return fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
 		}
 
-		result.Arguments[arg] = val
+		result.Timeout = &duration
+		return nil
+
+	case "pt-duration", "period-test-duration":
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+		if duration < 0 {
+			return fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
+		}
+
+		result.PeriodTestDuration = &duration
+		return nil
+	case "pt-sleep", "period-test-sleep":
+		duration, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+		if duration < 0 {
+			return fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
+		}
+
+		result.PeriodTestSleep = duration
+		return nil
+	case "flap-window":
+		window, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return fmt.Errorf("non-numeric argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+
+		windowUint := uint(window)
+		result.FlapWindow = &windowUint
+		return nil
+	case "flap-high-threshold", "flap-low-threshold":
+		percentage, err := utils.ParsePercentage(val)
+		if err != nil {
+			return fmt.Errorf("non-percentage argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
+
+		if arg == "flap-high-threshold" {
+			result.FlapHighThreshold = &percentage
+		} else {
+			result.FlapLowThreshold = &percentage
+		}
+		return nil
+	case "pt-threshold", "period-test-threshold":
+		percentage, err := utils.ParsePercentage(val)
+		if err != nil {
+			return fmt.Errorf("non-percentage argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
+
+		result.PeriodTestThreshold = &percentage
+		return nil
+	case "max-targets":
+		maxTargets, err := strconv.ParseInt(val, 10, 32)
+		if err != nil {
+			return fmt.Errorf("non-numeric argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+		}
+
+		result.MaxTargetsCount = int(maxTargets)
+		return nil
+	case "test-label":
+		valCopy := val
+		result.TestLabel = &valCopy
+		return nil
+	case "depends-on":
+		result.DependsOn = val
+		return nil
+	case "every":
+		if _, err := utils.ParseSchedule(val); err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
+
+		result.Every = val
+		return nil
 	}
 
 	//
-	// Invoke the user-supplied callback on this parsed test.
+	// Is that argument present in the arguments the
+	// tester supports?
 	//
+	pattern := expected[arg]
+	if pattern == "" {
+		return fmt.Errorf("unsupported argument '%s' for test-type '%s' in input '%s'%s", arg, testType, input, didYouMean(arg, argumentNames(expected)))
+	}
+
 	//
-	// Ensure that we have a callback.
+	// Otherwise we need to look for a match
 	//
-	if cb != nil {
-		cb(result)
+	expr := regexp.MustCompile(pattern)
+	match := expr.FindStringSubmatch(val)
+
+	if match == nil {
+		return fmt.Errorf("unsupported argument '%s' for test-type '%s' in input '%s' - did not match pattern '%s'", arg, testType, input, pattern)
 	}
 
-	return result, nil
+	//
+	// Secrets can be references, resolved by the worker running the test,
+	// while the other arguments would be used as they are
+	//
+	if test.SecretArguments[arg] {
+		if err := secret.Validate(val); err != nil {
+			return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+		}
+	} else if secret.IsReference(val) {
+		return fmt.Errorf("invalid argument '%s' for test-type '%s' in input '%s': only %s can refer to secrets", arg, testType, input, strings.Join(secretArgumentNames(), ", "))
+	}
+
+	result.Arguments[arg] = val
+	return nil
+}
+
+// secretArgumentNames returns the names of the arguments which can refer
+// to secrets, sorted.
+func secretArgumentNames() []string {
+	var names []string
+	for name := range test.SecretArguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateTest makes sure the options of a test are consistent with each
+// other.
+//
+func validateTest(tst test.Test) error {
+	if tst.DependsOn != "" && tst.TestLabel != nil && *tst.TestLabel == tst.DependsOn {
+		return fmt.Errorf("test-type '%s' in input '%s' cannot depend on itself", tst.Type, tst.Input)
+	}
+
+	if tst.Quorum != "" {
+		if err := validateQuorum(tst); err != nil {
+			return fmt.Errorf("invalid quorum for test-type '%s' in input '%s': %s", tst.Type, tst.Input, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// validateQuorum makes sure the quorum of a test can be reached, from the
+// locations it runs from.
+//
+func validateQuorum(tst test.Test) error {
+	quorum, err := alert.ParseQuorum(tst.Quorum)
+	if err != nil {
+		return err
+	}
+
+	if len(tst.RunFrom) == 0 {
+		return fmt.Errorf("a quorum requires the locations to run from (run-from)")
+	}
+
+	for _, location := range tst.RunFrom {
+		if location == queue.LocationAll {
+			return nil
+		}
+	}
+
+	if quorum.Of > len(tst.RunFrom) {
+		return fmt.Errorf("%s locations cannot agree, as the test runs from %d", quorum, len(tst.RunFrom))
+	}
+	return nil
 }
 
 // TrimQuotes removes matching quotes from around a string, if present.
@@ -504,40 +845,59 @@ func (s *Parser) TrimQuotes(in string, c byte) string {
 func (s *Parser) ParseArguments(input string) map[string]string {
 	res := make(map[string]string)
 
+	options := s.arguments(input)
+	for i := len(options) - 1; i >= 0; i-- {
+
+		// Store the value in our map - unless there is already a value
+		// present.
+		//
+		// As we're going through the options backwards, this means
+		// the last value is kept when an option is repeated.
+		//
+		if res[options[i].name] == "" {
+			res[options[i].name] = options[i].value
+		}
+	}
+	return res
+}
+
+// argument is an option of a test, and where its name starts in the
+// input.
+type argument struct {
+	name   string
+	value  string
+	offset int
+}
+
+// arguments returns all the options of the given input, in order,
+// including the repeated ones.
+//
+func (s *Parser) arguments(input string) []argument {
+	var res []argument
+
 	//
 	// Look for each option
 	//
+	// Our regular expression is parsing "backwards", finding the
+	// last option first.
+	//
 	expr := regexp.MustCompile(`^(.*)\s+with\s+([^\s]+)\s+('.+'|\".+\"|\S+)`)
-	match := expr.FindStringSubmatch(input)
+	match := expr.FindStringSubmatchIndex(input)
 
 	for len(match) > 1 {
-		prefix := match[1]
-		name := match[2]
-		value := match[3]
+		prefix := input[match[2]:match[3]]
+		name := input[match[4]:match[5]]
+		value := input[match[6]:match[7]]
 
 		// Strip quotes
 		value = s.TrimQuotes(value, '\'')
 		value = s.TrimQuotes(value, '"')
 
-		// Store the value in our map - unless there is already a value
-		// present.
-		//
-		// This works the way you'd expect because our regular expression
-		// is parsing "backwards". So parsing:
-		//
-		//   with foo bar with foo baz with foo steve
-		//
-		// We first store "steve", then we would store "baz" and
-		// finally "bar".  We skip this because of the non-empty
-		// test here, which means the last value is kept.
-		//
-		if res[name] == "" {
-			res[name] = value
-		}
+		res = append([]argument{{name: name, value: value, offset: match[4]}}, res...)
 
 		// Continue matching the tail of the string.
 		input = prefix
-		match = expr.FindStringSubmatch(input)
+		match = expr.FindStringSubmatchIndex(input)
 	}
 	return res
 }
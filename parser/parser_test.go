@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cmaster11/overseer/test"
 )
@@ -587,6 +588,239 @@ func TestTestLabel(t *testing.T) {
 	}
 }
 
+func TestEvery(t *testing.T) {
+	tests := map[string]string{
+		"http://example.com/ must run http with every 30s":                                 "30s",
+		"http://example.com/ must run http with every '*/5 * * * *' with test-label 'Web'": "*/5 * * * *",
+		"http://example.com/ must run http with every @hourly":                             "@hourly",
+	}
+
+	// Create a parser
+	p := New()
+
+	// Parse each line
+	for input, expected := range tests {
+
+		tst, err := p.ParseLine(input, nil)
+		if err != nil {
+			t.Errorf("We did not expect an error parsing %s - got %s!", input, err)
+
+			continue
+		}
+
+		if tst.Every != expected {
+			t.Errorf("Invalid every value for %s, got '%s'", input, tst.Every)
+		}
+	}
+
+	invalid := []string{
+		"http://example.com/ must run http with every 100ms",
+		"http://example.com/ must run http with every often",
+		"http://example.com/ must run http with every '* * *'",
+	}
+
+	for _, input := range invalid {
+		_, err := p.ParseLine(input, nil)
+		if err == nil {
+			t.Errorf("We expected an error parsing %s, but got none", input)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with retry-delay 2s with retry-backoff exponential with retry-max-delay 1m with retry-jitter 20% with retry-on 'timeout, connection-refused'", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+
+	if tst.RetryDelay == nil || *tst.RetryDelay != 2*time.Second {
+		t.Errorf("Invalid retry-delay %v", tst.RetryDelay)
+	}
+	if tst.RetryBackoff != "exponential" {
+		t.Errorf("Invalid retry-backoff '%s'", tst.RetryBackoff)
+	}
+	if tst.RetryMaxDelay == nil || *tst.RetryMaxDelay != time.Minute {
+		t.Errorf("Invalid retry-max-delay %v", tst.RetryMaxDelay)
+	}
+	if tst.RetryJitter == nil || *tst.RetryJitter != 0.2 {
+		t.Errorf("Invalid retry-jitter %v", tst.RetryJitter)
+	}
+	if len(tst.RetryOn) != 2 || tst.RetryOn[0] != "timeout" || tst.RetryOn[1] != "connection-refused" {
+		t.Errorf("Invalid retry-on %v", tst.RetryOn)
+	}
+
+	invalid := []string{
+		"http://example.com/ must run http with retry-delay soon",
+		"http://example.com/ must run http with retry-backoff random",
+		"http://example.com/ must run http with retry-jitter lots",
+		"http://example.com/ must run http with retry-on 'timeout,sometimes'",
+	}
+
+	for _, input := range invalid {
+		_, err := p.ParseLine(input, nil)
+		if err == nil {
+			t.Errorf("We expected an error parsing %s, but got none", input)
+		}
+	}
+}
+
+func TestFlapDetection(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with flap-window 10 with flap-high-threshold 60% with flap-low-threshold 20%", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+
+	if tst.FlapWindow == nil || *tst.FlapWindow != 10 {
+		t.Errorf("Invalid flap-window %v", tst.FlapWindow)
+	}
+	if tst.FlapHighThreshold == nil || *tst.FlapHighThreshold != 0.6 {
+		t.Errorf("Invalid flap-high-threshold %v", tst.FlapHighThreshold)
+	}
+	if tst.FlapLowThreshold == nil || *tst.FlapLowThreshold != 0.2 {
+		t.Errorf("Invalid flap-low-threshold %v", tst.FlapLowThreshold)
+	}
+
+	invalid := []string{
+		"http://example.com/ must run http with flap-window many",
+		"http://example.com/ must run http with flap-high-threshold high",
+	}
+
+	for _, input := range invalid {
+		_, err := p.ParseLine(input, nil)
+		if err == nil {
+			t.Errorf("We expected an error parsing %s, but got none", input)
+		}
+	}
+}
+
+func TestPriority(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with priority high", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Priority != "high" {
+		t.Errorf("Invalid priority '%s'", tst.Priority)
+	}
+
+	tst, err = p.ParseLine("http://example.com/ must run http", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Priority != "" {
+		t.Errorf("Unexpected default priority '%s'", tst.Priority)
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with priority urgent", nil)
+	if err == nil {
+		t.Errorf("We expected an error parsing an unknown priority, but got none")
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with depends-on 'Core router'", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.DependsOn != "Core router" {
+		t.Errorf("Invalid depends-on '%s'", tst.DependsOn)
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with test-label web with depends-on web", nil)
+	if err == nil {
+		t.Errorf("We expected an error parsing a test depending on itself, but got none")
+	}
+}
+
+func TestRunFrom(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with run-from eu,us,eu", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if len(tst.RunFrom) != 2 || tst.RunFrom[0] != "eu" || tst.RunFrom[1] != "us" {
+		t.Errorf("Invalid run-from %v", tst.RunFrom)
+	}
+
+	tst, err = p.ParseLine("http://example.com/ must run http with run-from all", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if len(tst.RunFrom) != 1 || tst.RunFrom[0] != "all" {
+		t.Errorf("Invalid run-from %v", tst.RunFrom)
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with run-from 'eu west'", nil)
+	if err == nil {
+		t.Errorf("We expected an error parsing an invalid location, but got none")
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with run-from eu,us,ap with quorum 2/3", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Quorum != "2/3" {
+		t.Errorf("Invalid quorum '%s'", tst.Quorum)
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with run-from all with quorum 3/5", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+
+	for _, input := range []string{
+		"http://example.com/ must run http with quorum 2/3",
+		"http://example.com/ must run http with run-from eu,us with quorum 2/3",
+		"http://example.com/ must run http with run-from eu,us with quorum 3/2",
+	} {
+		if _, err = p.ParseLine(input, nil); err == nil {
+			t.Errorf("We expected an error parsing '%s', but got none", input)
+		}
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	p := New()
+
+	// References are kept as they are, to be resolved by the workers
+	tst, err := p.ParseLine("db.example.com must run mysql with username overseer with password env:DB_PASS", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Arguments["password"] != "env:DB_PASS" {
+		t.Errorf("Invalid password '%s'", tst.Arguments["password"])
+	}
+	if tst.Redacted() != "db.example.com must run mysql with username overseer with password 'CENSORED'" {
+		t.Errorf("Invalid redacted input '%s'", tst.Redacted())
+	}
+
+	for _, input := range []string{
+		"db.example.com must run mysql with username overseer with password env:",
+		"db.example.com must run mysql with username overseer with password env:DB-PASS",
+		"ftp.example.com must run ftp with password file:",
+
+		// Only the secret arguments are resolved
+		"db.example.com must run mysql with username env:DB_USER with password env:DB_PASS",
+		"https://example.com/ must run http with data vault-file:/vault/secrets/body",
+	} {
+		if _, err = p.ParseLine(input, nil); err == nil {
+			t.Errorf("We expected an error parsing '%s', but got none", input)
+		}
+	}
+}
+
 func TestParseArguments(t *testing.T) {
 	input := "http://example.com/ must run http with min-duration 5m with test-label \"Hello 0\""
 
@@ -713,3 +947,17 @@ http://example.com/ must run http with username 'steve' with password 'ke'mp'
 		t.Errorf("We see no evidence of censorship")
 	}
 }
+
+// Test the errors of macro-expanded tests are reported
+func TestMacroErrors(t *testing.T) {
+	p := New()
+
+	if _, err := p.ParseLine("HOSTS are a.example.com, b.example.com", nil); err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+
+	_, err := p.ParseLine("HOSTS must run ping with dedup forever", nil)
+	if err == nil || !strings.Contains(err.Error(), "non-duration argument") {
+		t.Errorf("Expected the error of the expanded test, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// options are the options common to all the tests, which are handled by
+// parseArgument, in addition to the arguments of each test-type.
+var options = []string{
+	"retries", "retry-delay", "retry-max-delay", "retry-backoff", "retry-jitter", "retry-on",
+	"priority", "run-from", "quorum",
+	"dedup", "min-duration", "min-duration-cache-factor",
+	"timeout",
+	"pt-duration", "period-test-duration", "pt-sleep", "period-test-sleep", "pt-threshold", "period-test-threshold",
+	"flap-window", "flap-high-threshold", "flap-low-threshold",
+	"max-targets", "test-label", "depends-on", "every",
+}
+
+// argumentNames returns the names of all the arguments supported by a
+// test-type, given its own ones.
+func argumentNames(expected map[string]string) []string {
+	names := append([]string{}, options...)
+	for name := range expected {
+		names = append(names, name)
+	}
+	return names
+}
+
+// didYouMean returns the suggestions for the given unknown name, among the
+// candidates, to append to an error, or an empty string if none is close
+// enough.
+func didYouMean(name string, candidates []string) string {
+	suggestions := suggest(name, candidates)
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" - did you mean '%s'?", strings.Join(suggestions, "' or '"))
+}
+
+// suggest returns the candidates closest to the given name, if they are
+// close enough to be what was meant.
+func suggest(name string, candidates []string) []string {
+	// Allow a typo every few characters
+	max := len(name) / 3
+	if max < 1 {
+		max = 1
+	}
+
+	distances := make(map[string]int)
+	var result []string
+	for _, candidate := range candidates {
+		if _, seen := distances[candidate]; seen || candidate == name {
+			continue
+		}
+
+		d := distance(name, candidate)
+		if d <= max {
+			distances[candidate] = d
+			result = append(result, candidate)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if distances[result[i]] != distances[result[j]] {
+			return distances[result[i]] < distances[result[j]]
+		}
+		return result[i] < result[j]
+	})
+
+	// Only the closest ones
+	for i := range result {
+		if distances[result[i]] > distances[result[0]] {
+			return result[:i]
+		}
+	}
+	return result
+}
+
+// distance returns the Levenshtein distance between two strings: how many
+// characters must be inserted, deleted or replaced to turn one into the
+// other.
+func distance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
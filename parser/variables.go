@@ -0,0 +1,237 @@
+package parser
+
+// Variables
+//
+// Configuration files can define variables, and refer to them, or to the
+// environment, from any later line:
+//
+//   SET env = ${env:OVERSEER_ENV:-staging}
+//   SET domain = ${env}.example.com
+//
+//   https://www.${domain}/ must run http with timeout ${TIMEOUT:-10s}
+//
+// References are expanded before the line is parsed, so they can be used
+// anywhere in it, including macros and includes.  A reference to a variable
+// which is neither defined nor has a default is an error.
+//
+// The values of secret arguments, e.g. passwords, cannot contain references:
+// they would be expanded here, and the secrets enqueued in clear.  They can
+// instead refer to secrets resolved by the workers, e.g. env:NAME.
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+var variableLine = regexp.MustCompile(`^SET\s+(\S+)\s*=\s*(.*)$`)
+
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var argumentValue = regexp.MustCompile(`\swith\s+(\S+)\s+('[^']*'|"[^"]*"|\S+)`)
+
+// The prefix of the references to environment variables
+const envPrefix = "env:"
+
+// variableDefinition returns the name and value of the given line, if it
+// defines a variable.
+func variableDefinition(line string) (string, string, bool) {
+	match := variableLine.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", false
+	}
+
+	value := strings.TrimSpace(match[2])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return match[1], value, true
+}
+
+// define defines a variable, which cannot be redefined, just like macros.
+func (s *Parser) define(name string, value string) error {
+	if !variableName.MatchString(name) {
+		return fmt.Errorf("invalid variable name '%s', expected letters, digits and underscores", name)
+	}
+
+	if _, ok := s.variables[name]; ok {
+		return fmt.Errorf("redeclaring an existing variable is a fatal-error, %s exists already", name)
+	}
+
+	if s.variables == nil {
+		s.variables = make(map[string]string)
+	}
+	s.variables[name] = value
+	return nil
+}
+
+// expansionError is an error expanding a line, at the given offset.
+type expansionError struct {
+	offset  int
+	message string
+}
+
+func (e *expansionError) Error() string {
+	return e.message
+}
+
+// expansionPart is a part of an expanded line, which is either copied from
+// the original line, or the value of a reference.
+type expansionPart struct {
+	// Where the part starts, in the expanded and in the original line
+	offset   int
+	original int
+
+	reference bool
+}
+
+// expansion is a line whose references have been expanded.
+type expansion struct {
+	text  string
+	parts []expansionPart
+}
+
+// originalOffset returns the offset, in the original line, of the given
+// offset of the expanded one: the values of references are mapped to
+// where the references start.
+func (e expansion) originalOffset(offset int) int {
+	part := expansionPart{}
+	for _, p := range e.parts {
+		if p.offset > offset {
+			break
+		}
+		part = p
+	}
+
+	if part.reference {
+		return part.original
+	}
+	return part.original + offset - part.offset
+}
+
+// expand returns the given line, with its references expanded.
+func (s *Parser) expand(line string) (string, error) {
+	e, err := s.expansion(line)
+	if err != nil {
+		return "", err
+	}
+	return e.text, nil
+}
+
+// expansion expands the references of the given line, remembering where
+// each part of the result comes from.
+func (s *Parser) expansion(line string) (expansion, error) {
+	var e expansion
+	var text strings.Builder
+
+	if err := secretReference(line); err != nil {
+		return e, err
+	}
+
+	literal := 0
+	for literal < len(line) {
+		start := strings.Index(line[literal:], "${")
+		if start < 0 {
+			break
+		}
+		start += literal
+
+		end := referenceEnd(line, start)
+		if end < 0 {
+			return e, &expansionError{start, fmt.Sprintf("unterminated reference '%s'", line[start:])}
+		}
+
+		value, err := s.resolve(line[start+2 : end])
+		if err != nil {
+			return e, &expansionError{start, err.Error()}
+		}
+
+		e.parts = append(e.parts, expansionPart{offset: text.Len(), original: literal})
+		text.WriteString(line[literal:start])
+		e.parts = append(e.parts, expansionPart{offset: text.Len(), original: start, reference: true})
+		text.WriteString(value)
+
+		literal = end + 1
+	}
+
+	e.parts = append(e.parts, expansionPart{offset: text.Len(), original: literal})
+	text.WriteString(line[literal:])
+
+	e.text = text.String()
+	return e, nil
+}
+
+// secretReference returns an error if the value of a secret argument of
+// the given line contains a reference.
+func secretReference(line string) error {
+	for _, match := range argumentValue.FindAllStringSubmatchIndex(line, -1) {
+		name := line[match[2]:match[3]]
+		value := line[match[4]:match[5]]
+		if test.SecretArguments[name] && strings.Contains(value, "${") {
+			return &expansionError{match[4], fmt.Sprintf("the value of '%s' cannot contain references, which would be enqueued in clear, refer to a secret instead, e.g. env:NAME", name)}
+		}
+	}
+	return nil
+}
+
+// referenceEnd returns the offset of the brace closing the reference
+// starting at the given offset, as defaults can contain references too, or
+// -1 if it is not closed.
+func referenceEnd(line string, start int) int {
+	depth := 0
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// resolve returns the value of a reference, e.g. "NAME", "env:NAME" or
+// "NAME:-default".
+func (s *Parser) resolve(reference string) (string, error) {
+	name := reference
+	fallback := ""
+	hasDefault := false
+	if i := strings.Index(reference, ":-"); i >= 0 {
+		name = reference[:i]
+		fallback = reference[i+2:]
+		hasDefault = true
+	}
+
+	fromEnv := strings.HasPrefix(name, envPrefix)
+	name = strings.TrimPrefix(name, envPrefix)
+	if !variableName.MatchString(name) {
+		return "", fmt.Errorf("invalid reference '${%s}', expected ${NAME}, ${env:NAME} or ${NAME:-default}", reference)
+	}
+
+	var value string
+	var found bool
+	if fromEnv {
+		value, found = os.LookupEnv(name)
+	} else {
+		value, found = s.variables[name]
+	}
+
+	// Just like in shells, defaults also replace empty values
+	if found && (value != "" || !hasDefault) {
+		return value, nil
+	}
+	if hasDefault {
+		return s.expand(fallback)
+	}
+
+	if fromEnv {
+		return "", fmt.Errorf("environment variable '%s' is not set", name)
+	}
+	return "", fmt.Errorf("undefined variable '%s'", name)
+}
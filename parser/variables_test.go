@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// parseInputs parses the given file, returning the inputs of its tests.
+func parseInputs(filename string) ([]string, error) {
+	var inputs []string
+	err := New().ParseFile(filename, func(tst test.Test) error {
+		inputs = append(inputs, tst.Input)
+		return nil
+	})
+	return inputs, err
+}
+
+func TestVariables(t *testing.T) {
+	os.Setenv("OVERSEER_TEST_ENV", "prod")
+	os.Setenv("OVERSEER_TEST_EMPTY", "")
+	defer os.Unsetenv("OVERSEER_TEST_ENV")
+	defer os.Unsetenv("OVERSEER_TEST_EMPTY")
+
+	dir := writeFiles(t, map[string]string{
+		"common.conf": "SET domain = ${env}.example.com\nWEB are a.${domain}, b.${domain}\n",
+		"main.conf": `SET env = ${env:OVERSEER_TEST_ENV:-staging}
+SET user = "${env:OVERSEER_TEST_EMPTY:-${env}-user}"
+include ${env}/../common.conf
+WEB must run ping
+https://www.${domain}/ must run http with timeout ${TIMEOUT:-10s}
+db.${domain} must run mysql with username ${user} with password env:MYSQL_PASSWORD
+`,
+		"prod/.keep": "",
+	})
+	defer os.RemoveAll(dir)
+
+	inputs, err := parseInputs(filepath.Join(dir, "main.conf"))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	expected := []string{
+		"a.prod.example.com must run ping",
+		"b.prod.example.com must run ping",
+		"https://www.prod.example.com/ must run http with timeout 10s",
+		"db.prod.example.com must run mysql with username prod-user with password env:MYSQL_PASSWORD",
+	}
+	if strings.Join(inputs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected tests %v", inputs)
+	}
+}
+
+func TestVariableErrors(t *testing.T) {
+	os.Unsetenv("OVERSEER_TEST_UNSET")
+
+	tests := []struct {
+		input string
+		error string
+	}{
+		{"localhost must run ping with timeout ${TIMEOUT}", "main.conf:1: undefined variable 'TIMEOUT'"},
+		{"${env:OVERSEER_TEST_UNSET} must run ping", "main.conf:1: environment variable 'OVERSEER_TEST_UNSET' is not set"},
+		{"localhost must run ping with timeout ${TIMEOUT", "main.conf:1: unterminated reference '${TIMEOUT'"},
+		{"localhost must run ping with timeout ${1x}", "main.conf:1: invalid reference '${1x}'"},
+		{"SET a = 1\nSET a = 2", "main.conf:2: redeclaring an existing variable"},
+		{"SET a-b = 1", "main.conf:1: invalid variable name 'a-b'"},
+
+		// Secrets would be enqueued in clear
+		{"localhost must run mysql with password ${env:DB_PASS}", "main.conf:1: the value of 'password' cannot contain references"},
+		{"localhost must run mysql with password 'x${PASS:-y}'", "main.conf:1: the value of 'password' cannot contain references"},
+	}
+
+	for _, tst := range tests {
+		dir := writeFiles(t, map[string]string{"main.conf": tst.input})
+
+		_, err := parseInputs(filepath.Join(dir, "main.conf"))
+		if err == nil || !strings.Contains(err.Error(), tst.error) {
+			t.Errorf("Expected error '%s' parsing '%s', got %v", tst.error, tst.input, err)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLintVariables(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.conf": "SET port = 2121\n" +
+			"localhost must run ftp with port ${port} with timeout ${TIMEOUT}\n" +
+			"${host} must run ftp with port ${port} with dedupp 5m\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := NewLinter()
+	if err := l.LintFile(filepath.Join(dir, "main.conf")); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	var problems []string
+	for _, d := range l.Diagnostics() {
+		problems = append(problems, strings.TrimPrefix(d.String(), filepath.Join(dir, "main.conf")))
+	}
+
+	expected := []string{
+		":2:55: undefined variable 'TIMEOUT'",
+		":3:1: undefined variable 'host'",
+	}
+	if strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	// Problems after a reference are reported in the original line
+	dir2 := writeFiles(t, map[string]string{
+		"main.conf": "SET host = a-rather-long-hostname.example.com\n" +
+			"${host} must run ftp with dedupp 5m\n",
+	})
+	defer os.RemoveAll(dir2)
+
+	l = NewLinter()
+	l.LintFile(filepath.Join(dir2, "main.conf"))
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 || diagnostics[0].Line != 2 || diagnostics[0].Column != 27 {
+		t.Errorf("Unexpected problems %v", diagnostics)
+	}
+}
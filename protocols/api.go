@@ -7,6 +7,7 @@
 package protocols
 
 import (
+	"context"
 	"sync"
 
 	"github.com/cmaster11/overseer/test"
@@ -34,10 +35,14 @@ type ProtocolTest interface {
 	// RunTest actually invokes the protocol-handler to run its
 	// tests.
 	//
+	// The context is cancelled once the test has exceeded its
+	// timeout, or the worker is shutting down, so implementations
+	// must give up as soon as possible when that happens.
+	//
 	// Return a suitable error if the test fails, or nil to indicate
 	// it passed.
 	//
-	RunTest(tst test.Test, target string, opts test.Options) error
+	RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error
 
 	ShouldResolveHostname() bool
 
@@ -0,0 +1,56 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// remainingTimeout returns the time left before the deadline of the given
+// context, capped to the supplied timeout.
+//
+// This is useful for those libraries which only accept a plain timeout,
+// rather than a context, so that they still stop once the worker gives up
+// on the test.
+func remainingTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		// Any non-zero value, as zero would mean "no timeout at all"
+		return time.Nanosecond
+	}
+
+	if timeout <= 0 || remaining < timeout {
+		return remaining
+	}
+
+	return timeout
+}
+
+// dialContext makes a connection to the given address, honouring both the
+// timeout and the cancellation of the context.
+//
+// If the context has a deadline it is also applied to the returned
+// connection, so that any subsequent read or write will not outlive the
+// test itself.
+func dialContext(ctx context.Context, network string, address string, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
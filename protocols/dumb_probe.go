@@ -3,6 +3,7 @@
 package protocols
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -54,7 +55,7 @@ If fail-at is defined, fails only at the specified counter index, then resets co
 
 // RunTest is the part of our API which is invoked to actually execute a
 // test against the given target.
-func (s *DumbTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *DumbTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	durationMin := 0 * time.Second
@@ -109,7 +110,11 @@ func (s *DumbTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	}
 	waitFor := time.Duration(randDiffDuration + int64(durationMin))
 
-	time.Sleep(waitFor)
+	select {
+	case <-time.After(waitFor):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	if fail {
 		return fmt.Errorf("dumb test failed (duration %s)", waitFor.String())
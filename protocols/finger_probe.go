@@ -19,9 +19,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -76,7 +76,7 @@ Finger Tester
 //
 // In this case we make a TCP connection, defaulting to port 79, and
 // look for a non-empty response.
-func (s *FINGERTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *FINGERTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -101,11 +101,6 @@ func (s *FINGERTest) RunTest(tst test.Test, target string, opts test.Options) er
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -121,7 +116,7 @@ func (s *FINGERTest) RunTest(tst test.Test, target string, opts test.Options) er
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
 		return err
 	}
@@ -31,6 +31,7 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -104,7 +105,7 @@ FTP Tester
 //
 // In this case we make a TCP connection, defaulting to port 21, and
 // look for a response which appears to be an FTP-server.
-func (s *FTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *FTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	//
 	// Holder for any error we might encounter.
 	//
@@ -161,7 +162,6 @@ func (s *FTPTest) RunTest(tst test.Test, target string, opts test.Options) error
 		}
 	}
 
-	fmt.Printf("Username: %s -> %s\n", username, password)
 	//
 	// If the user specified a different port update to use it.
 	//
@@ -190,7 +190,7 @@ func (s *FTPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	// Make the connection.
 	//
 	var conn *ftp.ServerConn
-	conn, err = ftp.DialTimeout(address, opts.Timeout)
+	conn, err = ftp.DialTimeout(address, remainingTimeout(ctx, opts.Timeout))
 	if err != nil {
 		return err
 	}
@@ -259,8 +259,8 @@ HTTP Tester
 	return str
 }
 
-// RunTest is the part of our API which is invoked to actually execute a
-// HTTP-test against the given URL.
+// RunTestWithOutcome is the part of our API which is invoked to actually
+// execute a HTTP-test against the given URL.
 //
 // For the purposes of clarity this test makes a HTTP-fetch.  The `test.Test`
 // structure contains our raw test, and the `target` variable contains the
@@ -272,7 +272,8 @@ HTTP Tester
 //
 //    target => "176.9.183.100"
 //
-func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *HTTPTest) RunTestWithOutcome(ctx context.Context, tst test.Test, target string, opts test.Options) (*ProbeOutcome, error) {
+	outcome := &ProbeOutcome{}
 
 	//
 	// Determine the port to connect to, initially via the protocol
@@ -287,7 +288,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	port := "80"
 	u, err := url.Parse(tst.Target)
 	if err != nil {
-		return err
+		return outcome, err
 	}
 	if u.Scheme == "http" {
 		port = "80"
@@ -317,7 +318,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	if connectTimeoutString := tst.Arguments["connect-timeout"]; connectTimeoutString != "" {
 		connectTimeout, errParse := time.ParseDuration(connectTimeoutString)
 		if errParse != nil {
-			return errParse
+			return outcome, errParse
 		}
 		dialer.Timeout = connectTimeout
 	}
@@ -326,7 +327,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	if retriesString := tst.Arguments["connect-retries"]; retriesString != "" {
 		_maxDialerRetries, errParse := strconv.ParseInt(retriesString, 10, 0)
 		if errParse != nil {
-			return errParse
+			return outcome, errParse
 		}
 		maxConnectRetries = int(_maxDialerRetries)
 	}
@@ -392,7 +393,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	if tlsTimeoutString := tst.Arguments["tls-timeout"]; tlsTimeoutString != "" {
 		tlsTimeout, errParse := time.ParseDuration(tlsTimeoutString)
 		if errParse != nil {
-			return errParse
+			return outcome, errParse
 		}
 		tr.TLSHandshakeTimeout = tlsTimeout
 	}
@@ -400,7 +401,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	if headerTimeoutString := tst.Arguments["resp-header-timeout"]; headerTimeoutString != "" {
 		headerTimeout, errParse := time.ParseDuration(headerTimeoutString)
 		if errParse != nil {
-			return errParse
+			return outcome, errParse
 		}
 		tr.ResponseHeaderTimeout = headerTimeout
 	}
@@ -477,9 +478,14 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 			bytes.NewBuffer([]byte(tst.Arguments["data"])))
 	}
 	if err != nil {
-		return err
+		return outcome, err
 	}
 
+	//
+	// Abort the request as soon as the test is cancelled.
+	//
+	req = req.WithContext(ctx)
+
 	//
 	// Are we using basic-auth?
 	//
@@ -502,7 +508,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	response, err := netClient.Do(req)
 	if err != nil {
-		return err
+		return outcome, err
 	}
 
 	//
@@ -511,9 +517,10 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	defer response.Body.Close()
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return err
+		return outcome, err
 	}
 	status := response.StatusCode
+	outcome.HTTPStatus = status
 
 	//
 	// The default status-code we accept as OK
@@ -529,7 +536,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		for _, statusString := range split {
 			allowedStatus, errConv := strconv.Atoi(statusString)
 			if errConv != nil {
-				return errConv
+				return outcome, errConv
 			}
 
 			allowedStatuses = append(allowedStatuses, allowedStatus)
@@ -559,10 +566,10 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 
 		if !found {
 			if len(allowedStatuses) == 1 {
-				return fmt.Errorf("status code was %d not %d", status, allowedStatuses[0])
+				return outcome, fmt.Errorf("status code was %d not %d", status, allowedStatuses[0])
 			}
 
-			return fmt.Errorf("status code was %d not one of %v", status, allowedStatuses)
+			return outcome, fmt.Errorf("status code was %d not one of %v", status, allowedStatuses)
 		}
 
 	}
@@ -572,7 +579,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	if tst.Arguments["content"] != "" {
 		if !strings.Contains(string(body), tst.Arguments["content"]) {
-			return fmt.Errorf("body didn't contain '%s'", tst.Arguments["content"])
+			return outcome, fmt.Errorf("body didn't contain '%s'", tst.Arguments["content"])
 		}
 	}
 
@@ -581,7 +588,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	if tst.Arguments["not-content"] != "" {
 		if strings.Contains(string(body), tst.Arguments["not-content"]) {
-			return fmt.Errorf("body contains '%s'", tst.Arguments["not-content"])
+			return outcome, fmt.Errorf("body contains '%s'", tst.Arguments["not-content"])
 		}
 	}
 
@@ -592,13 +599,13 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		var re *regexp.Regexp
 		re, err = regexp.Compile("(?ms)" + tst.Arguments["pattern"])
 		if err != nil {
-			return err
+			return outcome, err
 		}
 
 		// Skip unless this handler matches the filter.
 		match := re.FindAllStringSubmatch(string(body), -1)
 		if len(match) < 1 {
-			return fmt.Errorf("body didn't match the regular expression '%s'", tst.Arguments["pattern"])
+			return outcome, fmt.Errorf("body didn't match the regular expression '%s'", tst.Arguments["pattern"])
 		}
 	}
 
@@ -609,13 +616,13 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		var re *regexp.Regexp
 		re, err = regexp.Compile("(?ms)" + tst.Arguments["not-pattern"])
 		if err != nil {
-			return err
+			return outcome, err
 		}
 
 		// Skip unless this handler matches the filter.
 		match := re.FindAllStringSubmatch(string(body), -1)
 		if len(match) > 0 {
-			return fmt.Errorf("body matched the regular expression '%s'", tst.Arguments["not-pattern"])
+			return outcome, fmt.Errorf("body matched the regular expression '%s'", tst.Arguments["not-pattern"])
 		}
 	}
 
@@ -638,7 +645,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		// don't care, so we don't even need to test the result.
 		//
 		if tst.Arguments["expiration"] == "any" {
-			return nil
+			return outcome, nil
 		}
 
 		//
@@ -672,7 +679,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 			// Get the period.
 			period, err = strconv.Atoi(expire)
 			if err != nil {
-				return err
+				return outcome, err
 			}
 
 			//
@@ -684,12 +691,15 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		//
 		// Check the expiration
 		//
-		hours, cn, errExpire := s.SSLExpiration(tst.Target, opts.Verbose)
+		hours, cn, errExpire := s.SSLExpiration(ctx, tst.Target, timeout, opts.Verbose)
 		if errExpire == nil {
+			days := hours / 24
+			outcome.CertificateDaysLeft = &days
+
 			// Is the age too short?
 			if int64(hours) < int64(period) {
 
-				return fmt.Errorf("SSL certificate '%s' will expire in %d hours (%d days)", cn, hours, int(hours/24))
+				return outcome, fmt.Errorf("SSL certificate '%s' will expire in %d hours (%d days)", cn, hours, int(hours/24))
 			}
 		}
 
@@ -698,12 +708,18 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// If we reached here all is OK
 	//
-	return nil
+	return outcome, nil
+}
+
+// RunTest executes the test, discarding its outcome.
+func (s *HTTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestWithOutcome(ctx, tst, target, opts)
+	return err
 }
 
 // SSLExpiration returns the number of hours remaining for a given
 // SSL certificate chain.
-func (s *HTTPTest) SSLExpiration(host string, verbose bool) (int64, string, error) {
+func (s *HTTPTest) SSLExpiration(ctx context.Context, host string, timeout time.Duration, verbose bool) (int64, string, error) {
 
 	// Expiry time, in hours
 	var hours int64
@@ -739,7 +755,9 @@ func (s *HTTPTest) SSLExpiration(host string, verbose bool) (int64, string, erro
 		fmt.Printf("SSLExpiration testing: %s\n", host)
 	}
 
-	conn, err := tls.Dial("tcp", host, nil)
+	dialer := &net.Dialer{Timeout: remainingTimeout(ctx, timeout)}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, nil)
 	if err != nil {
 		return 0, "", err
 	}
@@ -12,6 +12,7 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"strconv"
@@ -65,7 +66,7 @@ IMAP Tester
 // In this case we make a IMAP connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *IMAPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *IMAPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 
 	var err error
 
@@ -97,7 +98,7 @@ func (s *IMAPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	}
 
 	var dial = &net.Dialer{
-		Timeout: opts.Timeout,
+		Timeout: remainingTimeout(ctx, opts.Timeout),
 	}
 
 	//
@@ -108,6 +109,7 @@ func (s *IMAPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		return err
 	}
 	defer con.Close()
+	con.Timeout = remainingTimeout(ctx, opts.Timeout)
 
 	//
 	// If we got username/password then use them
@@ -15,6 +15,7 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
@@ -74,7 +75,7 @@ IMAPS Tester
 // In this case we make a IMAP connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *IMAPSTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -116,7 +117,7 @@ func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) err
 	// Setup a dialer so we can have a suitable timeout
 	//
 	var dial = &net.Dialer{
-		Timeout: opts.Timeout,
+		Timeout: remainingTimeout(ctx, opts.Timeout),
 	}
 
 	//
@@ -146,6 +147,7 @@ func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) err
 
 	}
 	defer con.Close()
+	con.Timeout = remainingTimeout(ctx, opts.Timeout)
 
 	//
 	// If we got username/password then use them
@@ -10,6 +10,7 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
@@ -65,7 +66,7 @@ K8SSvc Tester
 
 // RunTest is the part of our API which is invoked to actually execute a
 // test against the given target.
-func (s *K8SSvcTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *K8SSvcTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -105,6 +106,10 @@ func (s *K8SSvcTest) RunTest(tst test.Test, target string, opts test.Options) er
 		}
 	}
 
+	// The client-go API we use does not accept a context, so bound
+	// the request by the time the test has left.
+	k8sConfig.Timeout = remainingTimeout(ctx, opts.Timeout)
+
 	clientset, err := kubernetes.NewForConfig(k8sConfig)
 	if err != nil {
 		return err
@@ -12,6 +12,7 @@
 package protocols
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -64,7 +65,7 @@ MySQL Tester
 //
 // In this case we make a TCP connection to the host and attempt to login
 // with the specified username & password.
-func (s *MYSQLTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *MYSQLTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -94,7 +95,7 @@ func (s *MYSQLTest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// Setup the connection timeout
 	//
-	config.Timeout = opts.Timeout
+	config.Timeout = remainingTimeout(ctx, opts.Timeout)
 
 	//
 	// Populate the username & password fields.
@@ -130,7 +131,11 @@ func (s *MYSQLTest) RunTest(tst test.Test, target string, opts test.Options) err
 	// Show the DSN, if appropriate.
 	//
 	if opts.Verbose {
-		fmt.Printf("\tMySQL DSN is %s\n", dsn)
+		censored := *config
+		if censored.Passwd != "" {
+			censored.Passwd = "CENSORED"
+		}
+		fmt.Printf("\tMySQL DSN is %s\n", censored.FormatDSN())
 	}
 
 	//
@@ -145,7 +150,7 @@ func (s *MYSQLTest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// And test that the connection actually worked.
 	//
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	return err
 }
 
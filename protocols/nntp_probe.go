@@ -17,9 +17,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -71,7 +71,7 @@ NNTP Tester
 //
 // In this case we make a TCP connection, defaulting to port 119, and
 // look for a response which appears to be an NNTP-server.
-func (s *NNTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *NNTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -89,11 +89,6 @@ func (s *NNTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -109,7 +104,7 @@ func (s *NNTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
 		return err
 	}
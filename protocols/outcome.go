@@ -0,0 +1,97 @@
+package protocols
+
+import (
+	"context"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// ProbeOutcome describes what a protocol-test observed while running,
+// regardless of whether it passed or failed.
+//
+// All the fields are optional, and only those which make sense for a
+// given protocol are populated.
+type ProbeOutcome struct {
+	// Latency is how long the test took.
+	Latency time.Duration
+
+	// HTTPStatus is the status-code of the response, for HTTP tests.
+	HTTPStatus int
+
+	// CertificateDaysLeft is the number of days before the first
+	// certificate of the chain expires, for TLS-enabled tests.
+	CertificateDaysLeft *int64
+
+	// Records contains the values returned by a lookup, e.g. DNS records.
+	Records []string
+
+	// Banner is the greeting sent by the remote server.
+	Banner string
+}
+
+// Measurements converts the outcome to the measurements published within
+// test results.
+func (o *ProbeOutcome) Measurements() test.Measurements {
+	if o == nil {
+		return nil
+	}
+
+	m := test.Measurements{}
+
+	if o.Latency > 0 {
+		m[test.MeasurementLatency] = float64(o.Latency) / float64(time.Millisecond)
+	}
+	if o.HTTPStatus != 0 {
+		m[test.MeasurementHTTPStatus] = float64(o.HTTPStatus)
+	}
+	if o.CertificateDaysLeft != nil {
+		m[test.MeasurementCertificateDaysLeft] = float64(*o.CertificateDaysLeft)
+	}
+	if o.Records != nil {
+		m[test.MeasurementRecords] = o.Records
+	}
+	if o.Banner != "" {
+		m[test.MeasurementBanner] = o.Banner
+	}
+
+	return m
+}
+
+// OutcomeProtocolTest is an optional interface which protocol-tests can
+// implement to report what they measured, on top of the plain pass/fail
+// result of RunTest.
+type OutcomeProtocolTest interface {
+	ProtocolTest
+
+	// RunTestWithOutcome behaves like RunTest, but also returns what
+	// the test observed.  The outcome may be returned even if the test
+	// failed, e.g. the unexpected status-code of a HTTP response.
+	RunTestWithOutcome(ctx context.Context, tst test.Test, target string, opts test.Options) (*ProbeOutcome, error)
+}
+
+// Probe runs the given protocol-test, returning its outcome if the test
+// is able to report one.
+//
+// The latency is always measured, unless the test did that by itself.
+func Probe(ctx context.Context, handler ProtocolTest, tst test.Test, target string, opts test.Options) (*ProbeOutcome, error) {
+	start := time.Now()
+
+	var outcome *ProbeOutcome
+	var err error
+
+	if outcomeHandler, ok := handler.(OutcomeProtocolTest); ok {
+		outcome, err = outcomeHandler.RunTestWithOutcome(ctx, tst, target, opts)
+	} else {
+		err = handler.RunTest(ctx, tst, target, opts)
+	}
+
+	if outcome == nil {
+		outcome = &ProbeOutcome{}
+	}
+	if outcome.Latency == 0 {
+		outcome.Latency = time.Since(start)
+	}
+
+	return outcome, err
+}
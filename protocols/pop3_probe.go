@@ -12,6 +12,7 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -64,7 +65,7 @@ POP3 Tester
 // In this case we make a POP3 connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *POP3Test) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *POP3Test) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -97,7 +98,7 @@ func (s *POP3Test) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Connect
 	//
-	c, err := pop3.Dial(address, pop3.UseTimeout(opts.Timeout))
+	c, err := pop3.Dial(address, pop3.UseTimeout(remainingTimeout(ctx, opts.Timeout)))
 	if err != nil {
 		return err
 	}
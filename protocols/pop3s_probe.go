@@ -15,6 +15,7 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"strconv"
@@ -71,7 +72,7 @@ POP3S Tester
 // In this case we make a POP3 connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *POP3STest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *POP3STest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -130,7 +131,7 @@ func (s *POP3STest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// Connect
 	//
-	c, err := pop3.Dial(address, pop3.UseTLS(tlsSetup), pop3.UseTimeout(opts.Timeout))
+	c, err := pop3.Dial(address, pop3.UseTLS(tlsSetup), pop3.UseTimeout(remainingTimeout(ctx, opts.Timeout)))
 	if err != nil {
 		return err
 	}
@@ -17,10 +17,12 @@
 package protocols
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/cmaster11/overseer/test"
 	_ "github.com/lib/pq" // Don't need to import this
@@ -73,7 +75,7 @@ PSQL Tester
 //
 // In this case we make a TCP connection to the database host and attempt
 // to login with the specified username & password.
-func (s *PSQLTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *PSQLTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -105,13 +107,15 @@ func (s *PSQLTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// This is the string we'll use for the database connection.
 	//
-	connect := fmt.Sprintf("host=%s port='%d' user='%s' password='%s' connect_timeout='%d' sslmode='%s'", target, port, tst.Arguments["username"], tst.Arguments["password"], opts.Timeout, ssl)
+	format := "host=%s port='%d' user='%s' password='%s' connect_timeout='%d' sslmode='%s'"
+	connect := fmt.Sprintf(format, target, port, tst.Arguments["username"], tst.Arguments["password"], s.connectTimeout(ctx, opts.Timeout), ssl)
 
 	//
-	// Show the config, if appropriate.
+	// Show the config, if appropriate, without the password.
 	//
 	if opts.Verbose {
-		fmt.Printf("\tPSQL connection string is %s\n", connect)
+		censored := fmt.Sprintf(format, target, port, tst.Arguments["username"], "CENSORED", s.connectTimeout(ctx, opts.Timeout), ssl)
+		fmt.Printf("\tPSQL connection string is %s\n", censored)
 	}
 
 	//
@@ -126,10 +130,23 @@ func (s *PSQLTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// And test that the connection actually worked.
 	//
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	return err
 }
 
+// connectTimeout returns the connection timeout, in whole seconds, as
+// expected by the `connect_timeout` setting of the connection string.
+//
+// Postgres treats zero as "wait forever", so we never return less than
+// a single second.
+func (s *PSQLTest) connectTimeout(ctx context.Context, timeout time.Duration) int {
+	seconds := int(remainingTimeout(ctx, timeout) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
 func (s *PSQLTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
 	return nil
 }
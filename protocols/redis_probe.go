@@ -11,6 +11,7 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -59,7 +60,7 @@ Redis Tester
 //
 // In this case we make a Redis-test against the given target.
 //
-func (s *REDISTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *REDISTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 
 	//
 	// Predeclare our error
@@ -103,14 +104,25 @@ func (s *REDISTest) RunTest(tst test.Test, target string, opts test.Options) err
 		address = fmt.Sprintf("[%s]:%d", target, port)
 	}
 
+	//
+	// Without an explicit timeout the client would wait forever on
+	// a host which accepts the connection but never replies.
+	//
+	timeout := remainingTimeout(ctx, opts.Timeout)
+
 	//
 	// Attempt to connect to the host with the optional password
 	//
 	client := redis.NewClient(&redis.Options{
-		Addr:     address,
-		Password: password,
-		DB:       0, // use default DB
+		Addr:         address,
+		Password:     password,
+		DB:           0, // use default DB
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
 	})
+	defer client.Close()
+	client = client.WithContext(ctx)
 
 	//
 	// And run a ping
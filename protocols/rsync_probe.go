@@ -12,9 +12,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -60,7 +60,7 @@ Rsync Tester
 //
 // In this case we make a TCP connection, defaulting to port 873, and
 // look for a response which appears to be an rsync-server.
-func (s *RSYNCTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *RSYNCTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -78,11 +78,6 @@ func (s *RSYNCTest) RunTest(tst test.Test, target string, opts test.Options) err
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -98,7 +93,7 @@ func (s *RSYNCTest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
 		return err
 	}
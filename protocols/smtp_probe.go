@@ -24,10 +24,10 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"net"
 	"net/smtp"
 	"strconv"
 	"strings"
@@ -89,7 +89,7 @@ SMTP Tester
 //
 // In this case we make a TCP connection, defaulting to port 25, and
 // look for a response which appears to be an SMTP-server.
-func (s *SMTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *SMTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -107,11 +107,6 @@ func (s *SMTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -127,7 +122,7 @@ func (s *SMTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
 		return err
 	}
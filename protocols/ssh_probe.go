@@ -12,9 +12,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -55,12 +55,14 @@ SSH Tester
 	return str
 }
 
-// RunTest is the part of our API which is invoked to actually execute a
-// test against the given target.
+// RunTestWithOutcome is the part of our API which is invoked to actually
+// execute a test against the given target.
 //
 // In this case we make a TCP connection, defaulting to port 22, and
 // look for a response which appears to be an SSH-server.
-func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *SSHTest) RunTestWithOutcome(ctx context.Context, tst test.Test, target string, opts test.Options) (*ProbeOutcome, error) {
+	outcome := &ProbeOutcome{}
+
 	var err error
 
 	//
@@ -74,15 +76,10 @@ func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error
 	if tst.Arguments["port"] != "" {
 		port, err = strconv.Atoi(tst.Arguments["port"])
 		if err != nil {
-			return err
+			return outcome, err
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -98,9 +95,9 @@ func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
-		return err
+		return outcome, err
 	}
 
 	//
@@ -108,15 +105,22 @@ func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	banner, err := bufio.NewReader(conn).ReadString('\n')
 	if err != nil {
-		return err
+		return outcome, err
 	}
+	outcome.Banner = strings.TrimSpace(banner)
 	conn.Close()
 
 	if !strings.Contains(banner, "SSH-") {
-		return errors.New("banner doesn't look like an SSH server")
+		return outcome, errors.New("banner doesn't look like an SSH server")
 	}
 
-	return nil
+	return outcome, nil
+}
+
+// RunTest executes the test, discarding its outcome.
+func (s *SSHTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestWithOutcome(ctx, tst, target, opts)
+	return err
 }
 
 func (s *SSHTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
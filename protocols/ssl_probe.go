@@ -22,8 +22,10 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -76,8 +78,8 @@ expiration period is assumed to be days:
 	return str
 }
 
-// RunTest is the part of our API which is invoked to actually execute a
-// SSL-test against the given URL.
+// RunTestWithOutcome is the part of our API which is invoked to actually
+// execute a SSL-test against the given URL.
 //
 // For the purposes of clarity this test makes a TCP dial and verifies SSL
 // certificates validity. The `test.Test` structure contains our raw test,
@@ -90,7 +92,8 @@ expiration period is assumed to be days:
 //
 //    target => "176.9.183.100"
 //
-func (s *SSLTest) RunTest(tst test.Test, _ string, opts test.Options) error {
+func (s *SSLTest) RunTestWithOutcome(ctx context.Context, tst test.Test, _ string, opts test.Options) (*ProbeOutcome, error) {
+	outcome := &ProbeOutcome{}
 
 	var err error
 	target := tst.Target
@@ -131,7 +134,7 @@ func (s *SSLTest) RunTest(tst test.Test, _ string, opts test.Options) error {
 		// Get the period.
 		period, err = strconv.Atoi(expire)
 		if err != nil {
-			return err
+			return outcome, err
 		}
 
 		//
@@ -143,25 +146,34 @@ func (s *SSLTest) RunTest(tst test.Test, _ string, opts test.Options) error {
 	//
 	// Check the expiration
 	//
-	hours, err := s.SSLExpiration(target, opts.Verbose)
+	hours, err := s.SSLExpiration(ctx, target, opts.Timeout, opts.Verbose)
 
 	if err == nil {
+		days := hours / 24
+		outcome.CertificateDaysLeft = &days
+
 		// Is the age too short?
 		if int64(hours) < int64(period) {
 
-			return fmt.Errorf("SSL certificate will expire in %d hours (%d days)", hours, int(hours/24))
+			return outcome, fmt.Errorf("SSL certificate will expire in %d hours (%d days)", hours, int(hours/24))
 		}
 	}
 
 	//
 	// If we reached here all is OK
 	//
-	return nil
+	return outcome, nil
+}
+
+// RunTest executes the test, discarding its outcome.
+func (s *SSLTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestWithOutcome(ctx, tst, target, opts)
+	return err
 }
 
 // SSLExpiration returns the number of hours remaining for a given
 // SSL certificate chain.
-func (s *SSLTest) SSLExpiration(host string, verbose bool) (int64, error) {
+func (s *SSLTest) SSLExpiration(ctx context.Context, host string, timeout time.Duration, verbose bool) (int64, error) {
 
 	// Expiry time, in hours
 	var hours int64
@@ -184,7 +196,9 @@ func (s *SSLTest) SSLExpiration(host string, verbose bool) (int64, error) {
 
 	cfg := &tls.Config{}
 
-	conn, err := tls.Dial("tcp", host, cfg)
+	dialer := &net.Dialer{Timeout: remainingTimeout(ctx, timeout)}
+
+	conn, err := tls.DialWithDialer(dialer, "tcp", host, cfg)
 	if err != nil {
 		return 0, err
 	}
@@ -21,9 +21,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"regexp"
 	"strconv"
 	"strings"
@@ -75,12 +75,16 @@ TCP Tester
 	return str
 }
 
-// RunTest is the part of our API which is invoked to actually execute a
-// test against the given target.
+// RunTestWithOutcome is the part of our API which is invoked to actually
+// execute a test against the given target.
 //
 // In this case we make a TCP connection to the specified port, and assume
 // that everything is OK if that succeeded.
-func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+//
+// If a banner was read it is reported in the outcome.
+func (s *TCPTest) RunTestWithOutcome(ctx context.Context, tst test.Test, target string, opts test.Options) (*ProbeOutcome, error) {
+	outcome := &ProbeOutcome{}
+
 	var err error
 
 	//
@@ -94,7 +98,7 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	if tst.Arguments["port"] != "" {
 		port, err = strconv.Atoi(tst.Arguments["port"])
 		if err != nil {
-			return err
+			return outcome, err
 		}
 	}
 
@@ -102,14 +106,9 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	// If there was no port that's an error
 	//
 	if port == -1 {
-		return errors.New("you must specify the port when running a TCP test")
+		return outcome, errors.New("you must specify the port when running a TCP test")
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -125,9 +124,9 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
-		return err
+		return outcome, err
 	}
 
 	defer conn.Close()
@@ -141,25 +140,32 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 		// Compile the regular expression
 		re, errCompile := regexp.Compile("(?ms)" + tst.Arguments["banner"])
 		if errCompile != nil {
-			return errCompile
+			return outcome, errCompile
 		}
 
 		// Read a single line of input
 		banner, errRead := bufio.NewReader(conn).ReadString('\n')
 		if errRead != nil {
-			return errRead
+			return outcome, errRead
 		}
+		outcome.Banner = strings.TrimSpace(banner)
 
 		//
 		// If the regexp doesn't match that's an error.
 		//
 		match := re.FindAllStringSubmatch(string(banner), -1)
 		if len(match) < 1 {
-			return fmt.Errorf("remote banner '%s' didn't match the regular expression '%s'", banner, tst.Arguments["banner"])
+			return outcome, fmt.Errorf("remote banner '%s' didn't match the regular expression '%s'", banner, tst.Arguments["banner"])
 		}
 	}
 
-	return nil
+	return outcome, nil
+}
+
+// RunTest executes the test, discarding its outcome.
+func (s *TCPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestWithOutcome(ctx, tst, target, opts)
+	return err
 }
 
 func (s *TCPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
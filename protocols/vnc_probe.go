@@ -12,9 +12,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -60,7 +60,7 @@ VNC Tester
 //
 // In this case we make a TCP connection, defaulting to port 5900, and
 // look for a response which appears to be an VNC-server.
-func (s *VNCTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *VNCTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -78,11 +78,6 @@ func (s *VNCTest) RunTest(tst test.Test, target string, opts test.Options) error
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -98,7 +93,7 @@ func (s *VNCTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := dialContext(ctx, "tcp", address, opts.Timeout)
 	if err != nil {
 		return err
 	}
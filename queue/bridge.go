@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ConsumerFlags holds the command-line settings of a results consumer, as
+// shared by all the bridges.
+type ConsumerFlags struct {
+	Transport string
+	Group     string
+	Name      string
+	ClaimIdle time.Duration
+}
+
+// RegisterConsumerFlags registers the consumer command-line flags, using
+// the given consumer group by default.
+//
+// Every bridge should use its own consumer group, so that it receives all
+// the results when using the stream transport.
+func RegisterConsumerFlags(f *flag.FlagSet, defaultGroup string) *ConsumerFlags {
+	hostname, _ := os.Hostname()
+
+	c := &ConsumerFlags{}
+	f.StringVar(&c.Transport, "transport", TransportList, "How results are read from redis: list, or stream.")
+	f.StringVar(&c.Group, "consumer-group", defaultGroup, "When reading from a stream, the consumer group of this bridge.")
+	f.StringVar(&c.Name, "consumer-name", hostname, "When reading from a stream, the name of this consumer, unique within its group.")
+	f.DurationVar(&c.ClaimIdle, "claim-idle", time.Minute, "When reading from a stream, after how long the results left pending by other consumers of the group are claimed.")
+	return c
+}
+
+// NewBackend creates the redis backend, as configured via the command-line.
+func (c *ConsumerFlags) NewBackend(client *redis.Client) (Backend, error) {
+	return NewRedisBackend(client, RedisOptions{
+		Transport: c.Transport,
+		ClaimIdle: c.ClaimIdle,
+	})
+}
+
+// NewConsumer creates a consumer of the given results queue, as configured
+// via the command-line.
+func (c *ConsumerFlags) NewConsumer(client *redis.Client, key string) (Consumer, error) {
+	backend, err := c.NewBackend(client)
+	if err != nil {
+		return nil, err
+	}
+	return backend.ResultSource(key, c.Group, c.Name)
+}
+
+// Consume keeps reading messages, invoking the given function for each of
+// them, and acknowledging them once processed.
+//
+// It only returns once the done channel, if any, is closed.
+func Consume(consumer Consumer, process func(msg []byte), done <-chan bool) {
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		msg, err := consumer.Receive(time.Second)
+		if err != nil {
+			fmt.Printf("Failed to read from queue: %s\n", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		process([]byte(msg.Body))
+
+		if err = consumer.Ack(msg); err != nil {
+			fmt.Printf("Failed to acknowledge message %s: %s\n", msg.ID, err.Error())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ListConsumer pops messages from a redis list.
+//
+// Messages are removed from the list as soon as they are read, so there is
+// nothing to acknowledge.
+type ListConsumer struct {
+	client *redis.Client
+	key    string
+}
+
+// NewListConsumer creates a consumer of the given list.
+func NewListConsumer(client *redis.Client, key string) *ListConsumer {
+	return &ListConsumer{
+		client: client,
+		key:    key,
+	}
+}
+
+// Receive pops the first message of the list.
+func (c *ListConsumer) Receive(block time.Duration) (*Message, error) {
+	res, err := c.client.BLPop(block, c.key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	//   res[0] will be the name of the list
+	//
+	//   res[1] will be the value removed from the list.
+	//
+	return &Message{Body: res[1]}, nil
+}
+
+// Ack does nothing, as messages are removed from lists when read.
+func (c *ListConsumer) Ack(msg *Message) error {
+	return nil
+}
+
+// ListPublisher appends messages to a redis list.
+type ListPublisher struct {
+	client *redis.Client
+	key    string
+}
+
+// NewListPublisher creates a publisher for the given list.
+func NewListPublisher(client *redis.Client, key string) *ListPublisher {
+	return &ListPublisher{
+		client: client,
+		key:    key,
+	}
+}
+
+// Publish appends a message to the list.
+func (p *ListPublisher) Publish(body string) error {
+	return p.client.RPush(p.key, body).Err()
+}
+
+// listJobs is the plain job queue, where a job is lost if the worker dies
+// while executing it.
+type listJobs struct {
+	client   *redis.Client
+	location string
+	picker   *picker
+}
+
+func (q *listJobs) Push(job string, priority string, location string) error {
+	return pushToLocations(q.client, location, func(location string) error {
+		return q.client.RPush(JobsKeyAt(location, priority), job).Err()
+	})
+}
+
+// Receive pops the first job of the lists, which BLPOP checks in the
+// order given by the picker.
+func (q *listJobs) Receive(block time.Duration) (*Message, error) {
+	var keys []string
+	queues := make(map[string]route)
+	for _, r := range routes(q.picker.next(), q.location) {
+		keys = append(keys, r.key())
+		queues[r.key()] = r
+	}
+
+	res, err := q.client.BLPop(block, keys...).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := queues[res[0]]
+	return &Message{Body: res[1], Priority: r.priority, Location: r.location}, nil
+}
+
+func (q *listJobs) Ack(msg *Message) error {
+	return nil
+}
+
+func (q *listJobs) Requeue(msg *Message) error {
+	return q.client.RPush(JobsKeyAt(msg.Location, msg.Priority), msg.Body).Err()
+}
+
+func (q *listJobs) Touch(msg *Message) error {
+	return nil
+}
@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Job locations
+//
+// Tests can be run from specific locations, e.g. from within every VPC:
+// their jobs are pushed to a queue per location, instead of the shared
+// one, and only the workers of that location read them.  Workers read the
+// queues of their location first, then the shared ones.
+//
+// Workers register their location, so that jobs can be pushed to all the
+// known locations at once.
+
+// LocationAll pushes a job to every known location
+const LocationAll = "all"
+
+const (
+	// The hash containing the last time each location was seen
+	locationsKey = "overseer.locations"
+
+	// After how long a location whose workers are gone is forgotten
+	locationTTL = 5 * time.Minute
+
+	// How often workers register their location
+	locationHeartbeat = time.Minute
+)
+
+var validLocation = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+// ValidateLocation returns an error if the given location is invalid.
+func ValidateLocation(location string) error {
+	if !validLocation.MatchString(location) {
+		return fmt.Errorf("invalid location '%s', must only contain letters, digits, _ and -", location)
+	}
+	if location == LocationAll {
+		return fmt.Errorf("invalid location '%s', it is reserved", location)
+	}
+	return nil
+}
+
+// ParseLocations parses a comma-separated list of locations, e.g. "eu,us",
+// which can include LocationAll.
+func ParseLocations(value string) ([]string, error) {
+	var locations []string
+	seen := make(map[string]bool)
+
+	for _, location := range strings.Split(value, ",") {
+		location = strings.TrimSpace(location)
+		if location != LocationAll {
+			if err := ValidateLocation(location); err != nil {
+				return nil, err
+			}
+		}
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+
+	return locations, nil
+}
+
+// JobsKeyAt returns the queue of the jobs with the given priority, for the
+// given location, or the shared one if empty.
+func JobsKeyAt(location string, priority string) string {
+	if location == "" {
+		return JobsKeyFor(priority)
+	}
+	return JobsKey + ".at." + location + strings.TrimPrefix(JobsKeyFor(priority), JobsKey)
+}
+
+// route identifies a job queue.
+type route struct {
+	priority string
+
+	// Empty for the shared queue
+	location string
+}
+
+func (r route) key() string {
+	return JobsKeyAt(r.location, r.priority)
+}
+
+// routes returns the queues to read, given the order of the priorities:
+// for every priority, the queue of the location, if any, comes first.
+func routes(priorities []string, location string) []route {
+	var result []route
+	for _, priority := range priorities {
+		if location != "" {
+			result = append(result, route{priority: priority, location: location})
+		}
+		result = append(result, route{priority: priority})
+	}
+	return result
+}
+
+// registerLocation records that a worker of the given location is alive.
+func registerLocation(client *redis.Client, location string) error {
+	return client.HSet(locationsKey, location, time.Now().Unix()).Err()
+}
+
+// locationLoop periodically registers the given location, until the done
+// channel is closed.
+func locationLoop(client *redis.Client, location string, done chan bool) {
+	ticker := time.NewTicker(locationHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := registerLocation(client, location); err != nil {
+				fmt.Printf("Failed to register location %s: %s\n", location, err.Error())
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// knownLocations returns the locations whose workers registered recently,
+// forgetting the others.
+func knownLocations(client *redis.Client) ([]string, error) {
+	values, err := client.HGetAll(locationsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []string
+	staleBefore := time.Now().Add(-locationTTL).Unix()
+	for location, seen := range values {
+		var unix int64
+		fmt.Sscan(seen, &unix)
+		if unix < staleBefore {
+			client.HDel(locationsKey, location)
+			continue
+		}
+		locations = append(locations, location)
+	}
+
+	sort.Strings(locations)
+	return locations, nil
+}
+
+// pushToLocations pushes a job to the given location, or to all the known
+// ones for LocationAll.
+func pushToLocations(client *redis.Client, location string, push func(location string) error) error {
+	if location != LocationAll {
+		return push(location)
+	}
+
+	locations, err := knownLocations(client)
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return fmt.Errorf("no known location to push the job to")
+	}
+
+	for _, location := range locations {
+		if err = push(location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
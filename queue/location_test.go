@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobsKeyAt(t *testing.T) {
+	tests := []struct {
+		location string
+		priority string
+		expected string
+	}{
+		{"", PriorityNormal, "overseer.jobs"},
+		{"", PriorityHigh, "overseer.jobs.high"},
+		{"eu", PriorityNormal, "overseer.jobs.at.eu"},
+		{"eu", PriorityLow, "overseer.jobs.at.eu.low"},
+	}
+
+	for _, tst := range tests {
+		if key := JobsKeyAt(tst.location, tst.priority); key != tst.expected {
+			t.Errorf("Expected %s for %s/%s, got %s", tst.expected, tst.location, tst.priority, key)
+		}
+	}
+}
+
+func TestParseLocations(t *testing.T) {
+	locations, err := ParseLocations("eu, us,eu,all")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(locations) != 3 || locations[0] != "eu" || locations[1] != "us" || locations[2] != LocationAll {
+		t.Errorf("Unexpected locations %v", locations)
+	}
+
+	for _, invalid := range []string{"", "eu,", "eu west", "a.b"} {
+		if _, err := ParseLocations(invalid); err == nil {
+			t.Errorf("Expected an error parsing '%s'", invalid)
+		}
+	}
+
+	if err := ValidateLocation(LocationAll); err == nil {
+		t.Errorf("Expected an error validating the reserved location")
+	}
+}
+
+// Test consumers read the jobs of their location first, then the shared
+// ones, and jobs cannot be pushed to locations nobody reads
+func TestMemoryLocations(t *testing.T) {
+	b := NewMemoryBackend()
+	b.Location = "eu"
+
+	jobs, _ := b.Jobs("worker")
+	jobs.Push("shared", PriorityNormal, "")
+	jobs.Push("eu", PriorityNormal, "eu")
+	jobs.Push("all", PriorityNormal, LocationAll)
+
+	if err := jobs.Push("us", PriorityNormal, "us"); err == nil {
+		t.Errorf("Expected an error pushing to an unknown location")
+	}
+
+	if pending, _ := b.PendingJobs(); pending != 3 {
+		t.Fatalf("Expected 3 pending jobs, got %d", pending)
+	}
+
+	for _, expected := range []Message{
+		{Body: "eu", Location: "eu"},
+		{Body: "all", Location: "eu"},
+		{Body: "shared"},
+	} {
+		msg, _ := jobs.Receive(time.Second)
+		if msg == nil || msg.Body != expected.Body || msg.Location != expected.Location {
+			t.Fatalf("Expected job %+v, got %+v", expected, msg)
+		}
+	}
+
+	shared, _ := NewMemoryBackend().Jobs("")
+	if err := shared.Push("x", PriorityNormal, LocationAll); err == nil {
+		t.Errorf("Expected an error pushing to all the locations, without any")
+	}
+}
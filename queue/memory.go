@@ -0,0 +1,270 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryList is an in-process FIFO queue.
+type memoryList struct {
+	mutex sync.Mutex
+	items []string
+
+	// Closed, and replaced, every time an item is added, to wake up the
+	// waiting consumers
+	added chan bool
+}
+
+func newMemoryList() *memoryList {
+	return &memoryList{
+		added: make(chan bool),
+	}
+}
+
+func (l *memoryList) push(item string, front bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if front {
+		l.items = append([]string{item}, l.items...)
+	} else {
+		l.items = append(l.items, item)
+	}
+
+	close(l.added)
+	l.added = make(chan bool)
+}
+
+// pop removes the first item of the list, waiting up to the given duration
+// for one to be available.  A zero duration waits forever, and a negative
+// one does not wait at all.
+func (l *memoryList) pop(block time.Duration) (string, bool) {
+	var timeout <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		l.mutex.Lock()
+		if len(l.items) > 0 {
+			item := l.items[0]
+			l.items = l.items[1:]
+			l.mutex.Unlock()
+			return item, true
+		}
+		added := l.added
+		l.mutex.Unlock()
+
+		if block < 0 {
+			return "", false
+		}
+
+		select {
+		case <-added:
+		case <-timeout:
+			return "", false
+		}
+	}
+}
+
+func (l *memoryList) len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.items)
+}
+
+// MemoryBackend keeps jobs and results within the current process, which
+// lets enqueue, worker and bridges run together without redis, e.g. for
+// small installations and integration tests.
+//
+// Results queues behave like redis lists: every result is received by a
+// single consumer, regardless of its group.  Nothing survives a restart.
+//
+// As all the consumers are in the same process, they share the same
+// location, and jobs can only be pushed to it, or to the shared queues.
+type MemoryBackend struct {
+	// Priority is the order in which consumers read the jobs of the
+	// different priorities.  It must be set before getting any job queue.
+	Priority PriorityOrder
+
+	// Location of the consumers, if any.  It must be set before getting
+	// any job queue.
+	Location string
+
+	mutex   sync.Mutex
+	jobs    map[string]*memoryList
+	results map[string]*memoryList
+}
+
+// NewMemoryBackend creates a new, empty, in-memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		jobs:    make(map[string]*memoryList),
+		results: make(map[string]*memoryList),
+	}
+}
+
+// jobList returns the job queue of the given route, creating it if needed.
+func (b *MemoryBackend) jobList(r route) *memoryList {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	l := b.jobs[r.key()]
+	if l == nil {
+		l = newMemoryList()
+		b.jobs[r.key()] = l
+	}
+	return l
+}
+
+// list returns the results queue with the given key, creating it if needed.
+func (b *MemoryBackend) list(key string) *memoryList {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	l := b.results[key]
+	if l == nil {
+		l = newMemoryList()
+		b.results[key] = l
+	}
+	return l
+}
+
+// Jobs returns the job queue, which is shared by all the consumers.
+func (b *MemoryBackend) Jobs(consumer string) (JobQueue, error) {
+	if b.Location != "" {
+		if err := ValidateLocation(b.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	return &memoryJobs{
+		backend: b,
+		picker:  newPicker(b.Priority),
+	}, nil
+}
+
+// Results returns a sink for the given results queue.
+func (b *MemoryBackend) Results(key string) (ResultSink, error) {
+	return &memorySink{list: b.list(key)}, nil
+}
+
+// ResultSource returns a consumer of the given results queue.
+func (b *MemoryBackend) ResultSource(key string, group string, consumer string) (Consumer, error) {
+	return &memoryConsumer{list: b.list(key)}, nil
+}
+
+// Close does nothing.
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+// PendingJobs returns the number of jobs waiting to be received.
+func (b *MemoryBackend) PendingJobs() (int64, error) {
+	var total int64
+	for _, r := range routes(Priorities, b.Location) {
+		total += int64(b.jobList(r).len())
+	}
+	return total, nil
+}
+
+// memoryConsumer reads from an in-memory queue.
+type memoryConsumer struct {
+	list *memoryList
+
+	// Used to give every message an ID
+	counter uint64
+}
+
+func (c *memoryConsumer) Receive(block time.Duration) (*Message, error) {
+	item, ok := c.list.pop(block)
+	if !ok {
+		return nil, nil
+	}
+
+	c.counter++
+	return &Message{ID: strconv.FormatUint(c.counter, 10), Body: item}, nil
+}
+
+// Ack does nothing, as messages are removed when received.
+func (c *memoryConsumer) Ack(msg *Message) error {
+	return nil
+}
+
+// memorySink appends to an in-memory queue.
+type memorySink struct {
+	list *memoryList
+}
+
+func (s *memorySink) Publish(result string) error {
+	s.list.push(result, false)
+	return nil
+}
+
+// How often in-memory consumers look for jobs in the queues they're not
+// waiting on
+const memoryPriorityPoll = 100 * time.Millisecond
+
+// memoryJobs is the in-memory job queue, with a list per priority, and
+// per location.
+type memoryJobs struct {
+	backend *MemoryBackend
+	picker  *picker
+
+	// Used to give every message an ID
+	counter uint64
+}
+
+// list returns the list of the jobs of the given priority and location.
+func (q *memoryJobs) list(priority string, location string) *memoryList {
+	if ValidatePriority(priority) != nil {
+		priority = PriorityNormal
+	}
+	return q.backend.jobList(route{priority: priority, location: location})
+}
+
+func (q *memoryJobs) Push(job string, priority string, location string) error {
+	if location == LocationAll {
+		location = q.backend.Location
+		if location == "" {
+			return fmt.Errorf("no known location to push the job to")
+		}
+	}
+	if location != "" && location != q.backend.Location {
+		return fmt.Errorf("no worker reads the jobs of location '%s'", location)
+	}
+
+	q.list(priority, location).push(job, false)
+	return nil
+}
+
+func (q *memoryJobs) Receive(block time.Duration) (*Message, error) {
+	return receiveInOrder(routes(q.picker.next(), q.backend.Location), block, memoryPriorityPoll, func(r route, block time.Duration) (*Message, error) {
+		item, ok := q.list(r.priority, r.location).pop(block)
+		if !ok {
+			return nil, nil
+		}
+
+		q.counter++
+		return &Message{ID: strconv.FormatUint(q.counter, 10), Body: item, Priority: r.priority, Location: r.location}, nil
+	})
+}
+
+// Ack does nothing, as jobs are removed when received.
+func (q *memoryJobs) Ack(msg *Message) error {
+	return nil
+}
+
+// Requeue puts the job back at the head of its queue.
+func (q *memoryJobs) Requeue(msg *Message) error {
+	q.list(msg.Priority, msg.Location).push(msg.Body, true)
+	return nil
+}
+
+func (q *memoryJobs) Touch(msg *Message) error {
+	return nil
+}
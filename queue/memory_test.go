@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test jobs are received in order, and only once
+func TestMemoryJobs(t *testing.T) {
+	b := NewMemoryBackend()
+
+	producer, _ := b.Jobs("")
+	consumer, _ := b.Jobs("worker.1")
+
+	for _, job := range []string{"a", "b", "c"} {
+		if err := producer.Push(job, PriorityNormal, ""); err != nil {
+			t.Fatalf("Unexpected error %s", err)
+		}
+	}
+
+	if pending, _ := b.PendingJobs(); pending != 3 {
+		t.Fatalf("Expected 3 pending jobs, got %d", pending)
+	}
+
+	msg, _ := consumer.Receive(time.Second)
+	if msg == nil || msg.Body != "a" {
+		t.Fatalf("Expected job a, got %+v", msg)
+	}
+
+	// Requeued jobs are the first to be received again
+	consumer.Requeue(msg)
+	for _, expected := range []string{"a", "b", "c"} {
+		msg, _ = consumer.Receive(time.Second)
+		if msg == nil || msg.Body != expected {
+			t.Fatalf("Expected job %s, got %+v", expected, msg)
+		}
+		consumer.Ack(msg)
+	}
+
+	msg, _ = consumer.Receive(10 * time.Millisecond)
+	if msg != nil {
+		t.Fatalf("Expected no more jobs, got %+v", msg)
+	}
+}
+
+// Test consumers waiting for jobs are woken up
+func TestMemoryBlockingReceive(t *testing.T) {
+	b := NewMemoryBackend()
+	jobs, _ := b.Jobs("")
+
+	received := make(chan string, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer, _ := b.Jobs("worker")
+			msg, _ := consumer.Receive(0)
+			received <- msg.Body
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	jobs.Push("x", PriorityNormal, "")
+	jobs.Push("y", PriorityNormal, "")
+	jobs.Push("z", PriorityNormal, "")
+
+	wg.Wait()
+	close(received)
+
+	seen := map[string]bool{}
+	for body := range received {
+		if seen[body] {
+			t.Errorf("Job %s received twice", body)
+		}
+		seen[body] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected 3 different jobs, got %v", seen)
+	}
+}
+
+// Test results are delivered to the consumers of the same key
+func TestMemoryResults(t *testing.T) {
+	b := NewMemoryBackend()
+
+	sink, _ := b.Results(ResultsKey)
+	other, _ := b.Results("overseer.results.email")
+	source, _ := b.ResultSource(ResultsKey, "webhook-bridge", "host")
+
+	sink.Publish("result")
+	other.Publish("other")
+
+	msg, _ := source.Receive(time.Second)
+	if msg == nil || msg.Body != "result" {
+		t.Fatalf("Expected result, got %+v", msg)
+	}
+
+	msg, _ = source.Receive(10 * time.Millisecond)
+	if msg != nil {
+		t.Fatalf("Expected no more results, got %+v", msg)
+	}
+}
+
+// Test Consume stops when asked to
+func TestConsume(t *testing.T) {
+	b := NewMemoryBackend()
+
+	sink, _ := b.Results(ResultsKey)
+	source, _ := b.ResultSource(ResultsKey, "", "")
+
+	sink.Publish("1")
+	sink.Publish("2")
+
+	done := make(chan bool)
+	var processed []string
+	queueConsumed := make(chan bool)
+
+	go func() {
+		Consume(source, func(msg []byte) {
+			processed = append(processed, string(msg))
+			if len(processed) == 2 {
+				close(done)
+			}
+		}, done)
+		close(queueConsumed)
+	}()
+
+	select {
+	case <-queueConsumed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Consume did not return")
+	}
+
+	if len(processed) != 2 {
+		t.Errorf("Expected 2 processed results, got %v", processed)
+	}
+}
@@ -0,0 +1,241 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job priorities
+//
+// Jobs of each priority are kept in a separate queue, and consumers pick
+// which queue to read first every time they receive a job:
+//
+//  * weighted: queues are picked in proportion to their weight, e.g. with
+//    weights high=6,normal=3,low=1 six jobs out of ten are read from the
+//    high priority queue, if it has any.
+//  * strict: the high priority queue is always read first, then the normal
+//    one, and finally the low one, except every StrictFairness receives,
+//    when the order is reversed.
+//
+// Either way a queue is only skipped if it is empty or it is not its turn,
+// so that low priority jobs are never starved completely.
+
+const (
+	// PriorityHigh is for critical tests
+	PriorityHigh = "high"
+
+	// PriorityNormal is the default priority, whose queue is JobsKey
+	PriorityNormal = "normal"
+
+	// PriorityLow is for tests which can wait
+	PriorityLow = "low"
+)
+
+// Priorities contains all the priorities, from the highest
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+const (
+	// OrderWeighted picks queues in proportion to their weight
+	OrderWeighted = "weighted"
+
+	// OrderStrict always picks the highest priority queue first
+	OrderStrict = "strict"
+)
+
+// StrictFairness is how often, in receives, the strict order is reversed
+const StrictFairness = 10
+
+// DefaultWeights are the weights of the priorities, when not set
+var DefaultWeights = map[string]int{
+	PriorityHigh:   6,
+	PriorityNormal: 3,
+	PriorityLow:    1,
+}
+
+// ValidatePriority returns an error if the given priority is unknown.
+func ValidatePriority(priority string) error {
+	switch priority {
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return nil
+	}
+	return fmt.Errorf("unknown priority '%s', must be one of: %s", priority, strings.Join(Priorities, ", "))
+}
+
+// JobsKeyFor returns the queue of the jobs with the given priority.
+//
+// Normal priority jobs use JobsKey, so that jobs enqueued by older
+// versions are still executed.
+func JobsKeyFor(priority string) string {
+	switch priority {
+	case PriorityHigh, PriorityLow:
+		return JobsKey + "." + priority
+	}
+	return JobsKey
+}
+
+// ParseWeights parses the weights of the priorities, e.g.
+// "high=6,normal=3,low=1".  Priorities which are not listed get their
+// default weight.
+func ParseWeights(value string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for priority, weight := range DefaultWeights {
+		weights[priority] = weight
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid weight '%s', expected priority=weight", pair)
+		}
+
+		priority := strings.TrimSpace(parts[0])
+		if err := ValidatePriority(priority); err != nil {
+			return nil, err
+		}
+
+		// A zero weight would starve the priority
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid weight '%s', expected a number > 0", pair)
+		}
+
+		weights[priority] = weight
+	}
+
+	return weights, nil
+}
+
+// PriorityOrder configures the order in which the queues of the different
+// priorities are read.
+type PriorityOrder struct {
+	// Order is either OrderWeighted, the default, or OrderStrict
+	Order string
+
+	// Weights of the priorities, used by the weighted order.  Missing
+	// priorities get their default weight.
+	Weights map[string]int
+}
+
+// Validate returns an error if the order is unknown.
+func (o PriorityOrder) Validate() error {
+	switch o.Order {
+	case "", OrderWeighted, OrderStrict:
+		return nil
+	}
+	return fmt.Errorf("unknown priority order '%s', must be one of: %s, %s", o.Order, OrderWeighted, OrderStrict)
+}
+
+// picker returns the queues to read, in order, for every receive.
+//
+// The weighted order uses a smooth weighted round-robin, so that the
+// priorities are interleaved, and every one of them comes first exactly
+// weight times in every sum-of-weights receives.
+type picker struct {
+	mutex sync.Mutex
+
+	order   PriorityOrder
+	current map[string]int
+	count   uint64
+}
+
+func newPicker(order PriorityOrder) *picker {
+	return &picker{
+		order:   order,
+		current: make(map[string]int),
+	}
+}
+
+func (p *picker) weight(priority string) int {
+	if weight := p.order.Weights[priority]; weight > 0 {
+		return weight
+	}
+	return DefaultWeights[priority]
+}
+
+// next returns all the priorities, in the order their queues should be
+// read for the next receive.
+func (p *picker) next() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.count++
+
+	if p.order.Order == OrderStrict {
+		if p.count%StrictFairness == 0 {
+			return []string{PriorityLow, PriorityNormal, PriorityHigh}
+		}
+		return Priorities
+	}
+
+	total := 0
+	first := ""
+	for _, priority := range Priorities {
+		weight := p.weight(priority)
+		total += weight
+		p.current[priority] += weight
+		if first == "" || p.current[priority] > p.current[first] {
+			first = priority
+		}
+	}
+	p.current[first] -= total
+
+	// The other queues are read from the highest priority one
+	order := []string{first}
+	for _, priority := range Priorities {
+		if priority != first {
+			order = append(order, priority)
+		}
+	}
+	return order
+}
+
+// How often consumers which can't wait on multiple queues at once look for
+// jobs in the queues they're not waiting on
+const priorityPoll = time.Second
+
+// receiveInOrder receives a message from the first queue, in the given
+// order, which has any.  The receive function must not wait at all if
+// given a negative duration.
+//
+// As not every transport can wait on multiple queues at once, this only
+// waits on the first queue, but up to the given poll interval, after which
+// the other queues are checked again.
+func receiveInOrder(order []route, block time.Duration, poll time.Duration, receive func(r route, block time.Duration) (*Message, error)) (*Message, error) {
+	var deadline time.Time
+	if block > 0 {
+		deadline = time.Now().Add(block)
+	}
+
+	for {
+		for _, r := range order {
+			msg, err := receive(r, -1)
+			if err != nil || msg != nil {
+				return msg, err
+			}
+		}
+
+		wait := poll
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return nil, nil
+			}
+			if remaining < wait {
+				wait = remaining
+			}
+		}
+
+		msg, err := receive(order[0], wait)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+}
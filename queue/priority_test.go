@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJobsKeyFor(t *testing.T) {
+	if JobsKeyFor(PriorityNormal) != JobsKey || JobsKeyFor("") != JobsKey {
+		t.Errorf("Normal priority jobs must use the default queue")
+	}
+	if JobsKeyFor(PriorityHigh) != "overseer.jobs.high" {
+		t.Errorf("Unexpected high priority queue %s", JobsKeyFor(PriorityHigh))
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	weights, err := ParseWeights("high=10, low=2")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if weights[PriorityHigh] != 10 || weights[PriorityNormal] != DefaultWeights[PriorityNormal] || weights[PriorityLow] != 2 {
+		t.Fatalf("Unexpected weights %v", weights)
+	}
+
+	for _, invalid := range []string{"high", "urgent=3", "low=0", "low=some"} {
+		if _, err = ParseWeights(invalid); err == nil {
+			t.Errorf("Expected an error parsing %s", invalid)
+		}
+	}
+}
+
+// Test every priority comes first in proportion to its weight
+func TestWeightedPicker(t *testing.T) {
+	p := newPicker(PriorityOrder{Order: OrderWeighted, Weights: map[string]int{PriorityHigh: 6, PriorityNormal: 3, PriorityLow: 1}})
+
+	first := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		order := p.next()
+		if len(order) != len(Priorities) {
+			t.Fatalf("Expected all the priorities, got %v", order)
+		}
+		first[order[0]]++
+	}
+
+	if first[PriorityHigh] != 60 || first[PriorityNormal] != 30 || first[PriorityLow] != 10 {
+		t.Errorf("Unexpected distribution %v", first)
+	}
+}
+
+// Test the strict order is regularly reversed, so that low is not starved
+func TestStrictPicker(t *testing.T) {
+	p := newPicker(PriorityOrder{Order: OrderStrict})
+
+	for i := 1; i <= 2*StrictFairness; i++ {
+		expected := PriorityHigh
+		if i%StrictFairness == 0 {
+			expected = PriorityLow
+		}
+		if order := p.next(); order[0] != expected {
+			t.Fatalf("Expected %s first at receive %d, got %v", expected, i, order)
+		}
+	}
+}
+
+// Test in-memory jobs are received by priority, and requeued to their queue
+func TestMemoryPriorities(t *testing.T) {
+	b := NewMemoryBackend()
+	b.Priority = PriorityOrder{Order: OrderStrict}
+
+	jobs, _ := b.Jobs("worker.1")
+	jobs.Push("low", PriorityLow, "")
+	jobs.Push("normal", PriorityNormal, "")
+	jobs.Push("high", PriorityHigh, "")
+
+	msg, _ := jobs.Receive(time.Second)
+	if msg == nil || msg.Body != "high" || msg.Priority != PriorityHigh {
+		t.Fatalf("Expected the high priority job, got %+v", msg)
+	}
+
+	jobs.Requeue(msg)
+	for _, expected := range []string{"high", "normal", "low"} {
+		msg, _ = jobs.Receive(time.Second)
+		if msg == nil || msg.Body != expected {
+			t.Fatalf("Expected job %s, got %+v", expected, msg)
+		}
+	}
+
+	// Jobs pushed to any queue wake up waiting consumers
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		jobs.Push("late", PriorityLow, "")
+	}()
+	msg, _ = jobs.Receive(time.Second)
+	if msg == nil || msg.Body != "late" {
+		t.Fatalf("Expected the late job, got %+v", msg)
+	}
+}
@@ -0,0 +1,145 @@
+// Package queue contains the backends used to exchange jobs and results
+// between the overseer components.
+//
+// The jobs to execute are read from a JobQueue, and test results are
+// published to a ResultSink, from where bridges read them.  All of them are
+// provided by a Backend, of which two implementations exist:
+//
+//  * redis, which is what overseer uses when its components run as separate
+//    processes.  It supports two transports:
+//     * list: plain redis lists, where every message is delivered to a
+//       single consumer.  This is the default one.
+//     * stream: redis streams, read through consumer groups.  Every group
+//       sees every message, and each message is delivered to a single
+//       consumer of the group, which acknowledges it once processed.
+//       Messages which are not acknowledged in time are claimed by other
+//       consumers.
+//  * memory, which keeps everything within the current process, so that
+//    multiple components can run together without redis.
+//
+// Jobs have a priority, and those of each priority are kept in a separate
+// queue, as described in priority.go.  Jobs can also be pushed to the
+// queues of a location, as described in location.go.
+package queue
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// TransportList uses redis lists
+	TransportList = "list"
+
+	// TransportStream uses redis streams, and consumer groups
+	TransportStream = "stream"
+)
+
+const (
+	// JobsKey is the queue of the jobs to execute
+	JobsKey = "overseer.jobs"
+
+	// ResultsKey is the queue of the test results
+	ResultsKey = "overseer.results"
+
+	// WorkersGroup is the consumer group of the workers, when reading jobs
+	// from a stream
+	WorkersGroup = "overseer.workers"
+
+	// ResultsMaxLen is the approximate max number of results kept in the
+	// results stream, as they can't be deleted when acknowledged by a
+	// single consumer group
+	ResultsMaxLen = 100000
+)
+
+// Message is a single message read from a queue.
+type Message struct {
+	// ID of the message, used to acknowledge it, if supported by the
+	// transport
+	ID string
+
+	// Body is the content of the message, e.g. a test definition or a
+	// JSON-encoded result
+	Body string
+
+	// Priority of the job, for messages received from a JobQueue
+	Priority string
+
+	// Location of the queue of the job, for messages received from a
+	// JobQueue, empty for the shared queue
+	Location string
+}
+
+// Consumer reads messages from a queue.
+type Consumer interface {
+	// Receive waits for a message for up to the given duration, returning
+	// nil if none has been found.  A zero duration waits forever.
+	Receive(block time.Duration) (*Message, error)
+
+	// Ack marks a message as processed.
+	Ack(msg *Message) error
+}
+
+// JobQueue is the queue of the tests to execute.
+type JobQueue interface {
+	Consumer
+
+	// Push adds a job to the queue of the given priority, for the given
+	// location, or to the shared one if empty.  LocationAll pushes the
+	// job to the queues of all the known locations.
+	Push(job string, priority string, location string) error
+
+	// Requeue puts back in the queue a job which has been received, but
+	// will not be executed, e.g. because the worker is exiting.
+	Requeue(msg *Message) error
+
+	// Touch signals that a received job is still being executed, so that
+	// it is not given to another worker.
+	Touch(msg *Message) error
+}
+
+// ResultSink is where test results are published.
+type ResultSink interface {
+	Publish(result string) error
+}
+
+// Backend provides the queues used by overseer.
+type Backend interface {
+	// Jobs returns the job queue, as seen by the given consumer (e.g. a
+	// single worker).  The consumer can be empty if jobs are only pushed.
+	//
+	// Jobs of all the priorities are received, in the order configured
+	// for the backend, from the queues of the location of the backend,
+	// if any, and from the shared ones.
+	Jobs(consumer string) (JobQueue, error)
+
+	// Results returns a sink for the results queue with the given key.
+	Results(key string) (ResultSink, error)
+
+	// ResultSource returns a consumer of the results queue with the given
+	// key.  Consumers of different groups all see every result, if the
+	// backend supports groups.
+	ResultSource(key string, group string, consumer string) (Consumer, error)
+
+	// PendingJobs returns the number of jobs waiting to be received, of
+	// all the priorities, by the consumers of the backend.
+	PendingJobs() (int64, error)
+
+	// Close releases any resource used by the backend.
+	Close() error
+}
+
+// StreamKey returns the name of the stream used in place of the given
+// list, as the two can't share the same key.
+func StreamKey(key string) string {
+	return key + ".stream"
+}
+
+// ValidateTransport returns an error if the given transport is unknown.
+func ValidateTransport(transport string) error {
+	switch transport {
+	case TransportList, TransportStream:
+		return nil
+	}
+	return fmt.Errorf("unknown transport '%s', must be one of: %s, %s", transport, TransportList, TransportStream)
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// RedisOptions configures the redis backend.
+type RedisOptions struct {
+	// Transport is either TransportList or TransportStream
+	Transport string
+
+	// Reliable keeps jobs read from lists in a per-consumer processing
+	// list, until they are acknowledged.  Jobs read from streams are
+	// always acknowledged.
+	Reliable bool
+
+	// VisibilityTimeout is how long a received job can go without being
+	// touched, before it is given to another consumer.  Required by
+	// reliable lists; with streams, zero means jobs are never claimed.
+	VisibilityTimeout time.Duration
+
+	// ClaimIdle is how long a result can stay pending in a stream before
+	// being claimed by another consumer of the same group.
+	ClaimIdle time.Duration
+
+	// Priority is the order in which consumers read the jobs of the
+	// different priorities.
+	Priority PriorityOrder
+
+	// Location of the consumers, whose queues they read before the
+	// shared ones.  Empty if they only read the shared queues.
+	Location string
+}
+
+// RedisBackend exchanges jobs and results via redis.
+type RedisBackend struct {
+	client *redis.Client
+	opts   RedisOptions
+
+	// Can we use BLMOVE to claim jobs from reliable lists?
+	useBLMove bool
+
+	// The reaper of stale jobs of reliable lists
+	reaperOnce sync.Once
+
+	// The registration of the location of the consumers
+	locationOnce sync.Once
+
+	// Closed to stop the background activities
+	done chan bool
+}
+
+// NewRedisBackend creates a new redis backend, using the given client.
+func NewRedisBackend(client *redis.Client, opts RedisOptions) (*RedisBackend, error) {
+	if err := ValidateTransport(opts.Transport); err != nil {
+		return nil, err
+	}
+
+	if opts.Reliable && opts.VisibilityTimeout <= 0 {
+		return nil, fmt.Errorf("the visibility timeout must be > 0")
+	}
+	if err := opts.Priority.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Location != "" {
+		if err := ValidateLocation(opts.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &RedisBackend{
+		client: client,
+		opts:   opts,
+		done:   make(chan bool),
+	}
+
+	if opts.Reliable && opts.Transport == TransportList {
+		b.useBLMove = supportsBLMove(client)
+	}
+
+	return b, nil
+}
+
+// Jobs returns the job queue.
+//
+// When using reliable lists, the first time a consumer gets its queue any
+// job it left behind in a previous run is put back in the queue, and the
+// jobs left behind by other consumers start being reaped.
+//
+// The location of the consumers, if any, is registered as long as the
+// backend is open.
+func (b *RedisBackend) Jobs(consumer string) (JobQueue, error) {
+	if consumer != "" && b.opts.Location != "" {
+		b.locationOnce.Do(func() {
+			if err := registerLocation(b.client, b.opts.Location); err != nil {
+				fmt.Printf("Failed to register location %s: %s\n", b.opts.Location, err.Error())
+			}
+			go locationLoop(b.client, b.opts.Location, b.done)
+		})
+	}
+
+	if b.opts.Transport == TransportStream {
+		return newStreamJobs(b.client, consumer, b.opts.Location, b.opts.VisibilityTimeout, newPicker(b.opts.Priority))
+	}
+
+	if !b.opts.Reliable || consumer == "" {
+		return &listJobs{
+			client:   b.client,
+			location: b.opts.Location,
+			picker:   newPicker(b.opts.Priority),
+		}, nil
+	}
+
+	jobs := &reliableJobs{
+		client:     b.client,
+		processing: processingKeyPrefix + consumer,
+		location:   b.opts.Location,
+		useBLMove:  b.useBLMove,
+		picker:     newPicker(b.opts.Priority),
+	}
+	jobs.recover()
+
+	b.reaperOnce.Do(func() {
+		reapJobs(b.client, b.opts.VisibilityTimeout)
+		go reaperLoop(b.client, b.opts.VisibilityTimeout, b.done)
+	})
+
+	return jobs, nil
+}
+
+// Results returns a sink for the given results queue.
+func (b *RedisBackend) Results(key string) (ResultSink, error) {
+	if b.opts.Transport == TransportStream {
+		return NewStreamPublisher(b.client, StreamKey(key), ResultsMaxLen), nil
+	}
+	return NewListPublisher(b.client, key), nil
+}
+
+// ResultSource returns a consumer of the given results queue.
+//
+// The group and consumer names are only used by the stream transport.
+func (b *RedisBackend) ResultSource(key string, group string, consumer string) (Consumer, error) {
+	if b.opts.Transport == TransportStream {
+		return NewStreamConsumer(b.client, StreamKey(key), group, consumer, b.opts.ClaimIdle)
+	}
+	return NewListConsumer(b.client, key), nil
+}
+
+// PendingJobs returns the number of jobs waiting to be received, in the
+// shared queues and in those of the location, if any.
+//
+// With streams, this also includes the jobs being executed, as they are
+// only deleted once acknowledged.
+func (b *RedisBackend) PendingJobs() (int64, error) {
+	pipe := b.client.Pipeline()
+
+	var counts []*redis.IntCmd
+	for _, r := range routes(Priorities, b.opts.Location) {
+		if b.opts.Transport == TransportStream {
+			counts = append(counts, pipe.XLen(StreamKey(r.key())))
+		} else {
+			counts = append(counts, pipe.LLen(r.key()))
+		}
+	}
+
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, count := range counts {
+		total += count.Val()
+	}
+	return total, nil
+}
+
+// Close stops the background activities of the backend.
+//
+// The redis client is not closed, as it is owned by the caller.
+func (b *RedisBackend) Close() error {
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+	return nil
+}
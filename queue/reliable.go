@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Reliable job consumption
+//
+// By default jobs are popped from the queue, so a job is lost if the
+// worker dies while running it.  With reliable lists, each job is instead
+// atomically moved to a processing list owned by the consumer, and removed
+// from it only once acknowledged.
+//
+// Every processing list has a claim time, which is refreshed while the job
+// is running.  If a consumer stops refreshing it for longer than the
+// visibility timeout (e.g. because it got OOM-killed), any other consumer
+// will move the job back to the queue.
+//
+// The processing lists do not record the priority of their jobs, so jobs
+// recovered or reaped from them go back to the normal priority queue, of
+// the location of their consumer, as they may have been read from it.
+
+const (
+	// The prefix of the per-consumer processing lists
+	processingKeyPrefix = "overseer.jobs.processing."
+
+	// The hash containing the last claim time of each processing list
+	inflightKey = "overseer.jobs.inflight"
+
+	// The hash containing the location of the consumer of each processing
+	// list, if any
+	processingLocationsKey = "overseer.jobs.processing-locations"
+)
+
+// reapScript moves the jobs of a stale processing list back to the queue.
+//
+// A list which has no claim time is given one, so that it gets reaped later
+// if nobody claims it in the meantime.
+//
+//   KEYS[1] = inflight hash, KEYS[2] = processing list, KEYS[3] = jobs queue
+//   ARGV[1] = claims older than this are stale, ARGV[2] = now
+var reapScript = redis.NewScript(`
+local claimed = redis.call('HGET', KEYS[1], KEYS[2])
+if not claimed then
+	if redis.call('EXISTS', KEYS[2]) == 1 then
+		redis.call('HSET', KEYS[1], KEYS[2], ARGV[2])
+	end
+	return 0
+end
+if tonumber(claimed) > tonumber(ARGV[1]) then
+	return 0
+end
+local count = 0
+while redis.call('RPOPLPUSH', KEYS[2], KEYS[3]) do
+	count = count + 1
+end
+redis.call('HDEL', KEYS[1], KEYS[2])
+return count
+`)
+
+// moveScript moves the first job of the queue to the processing list,
+// like LMOVE LEFT RIGHT does on Redis 6.2.
+//
+//   KEYS[1] = jobs queue, KEYS[2] = processing list
+var moveScript = redis.NewScript(`
+local job = redis.call('LPOP', KEYS[1])
+if job then
+	redis.call('RPUSH', KEYS[2], job)
+end
+return job
+`)
+
+// supportsBLMove returns true if the redis server knows the BLMOVE command.
+func supportsBLMove(client *redis.Client) bool {
+	res, err := client.Do("COMMAND", "INFO", "BLMOVE").Result()
+	if err != nil {
+		return false
+	}
+
+	info, ok := res.([]interface{})
+	return ok && len(info) > 0 && info[0] != nil
+}
+
+// reliableJobs is the job queue of a single consumer, using a processing
+// list.
+type reliableJobs struct {
+	client     *redis.Client
+	processing string
+	location   string
+	useBLMove  bool
+	picker     *picker
+}
+
+func (q *reliableJobs) Push(job string, priority string, location string) error {
+	return pushToLocations(q.client, location, func(location string) error {
+		return q.client.RPush(JobsKeyAt(location, priority), job).Err()
+	})
+}
+
+// Receive waits for a job, moving it to the processing list.
+//
+// Jobs can only be moved atomically from a single list, so the lists of
+// the different priorities, and locations, are checked in turn.
+func (q *reliableJobs) Receive(block time.Duration) (*Message, error) {
+	msg, err := receiveInOrder(routes(q.picker.next(), q.location), block, priorityPoll, q.receive)
+	if err != nil || msg == nil {
+		return msg, err
+	}
+	return msg, q.Touch(msg)
+}
+
+// receive moves a job of the given queue to the processing list, waiting
+// for up to the given duration, or not at all if negative.
+func (q *reliableJobs) receive(r route, block time.Duration) (*Message, error) {
+	key := r.key()
+
+	var job string
+	var err error
+
+	//
+	// (BL)MOVE requires Redis 6.2.  On older servers jobs are moved by a
+	// script, as (B)RPOPLPUSH takes the newest job, and BRPOPLPUSH is only
+	// used to wait for a job once the queue is empty, when the first job
+	// pushed is also the oldest one.
+	//
+	switch {
+	case q.useBLMove && block < 0:
+		job, err = q.client.Do("LMOVE", key, q.processing, "LEFT", "RIGHT").String()
+	case q.useBLMove:
+		job, err = q.client.Do("BLMOVE", key, q.processing, "LEFT", "RIGHT", block.Seconds()).String()
+	default:
+		job, err = moveScript.Run(q.client, []string{key, q.processing}).String()
+		if err == redis.Nil && block >= 0 {
+			// BRPOPLPUSH counts whole seconds, and zero would block forever
+			if block < time.Second {
+				block = time.Second
+			}
+			job, err = q.client.BRPopLPush(key, q.processing, block).Result()
+		}
+	}
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{Body: job, Priority: r.priority, Location: r.location}, nil
+}
+
+// Touch refreshes the claim time of the processing list.
+func (q *reliableJobs) Touch(msg *Message) error {
+	return q.client.HSet(inflightKey, q.processing, time.Now().Unix()).Err()
+}
+
+// Ack removes a completed job from the processing list.
+func (q *reliableJobs) Ack(msg *Message) error {
+	pipe := q.client.TxPipeline()
+	pipe.LRem(q.processing, 1, msg.Body)
+	pipe.HDel(inflightKey, q.processing)
+	_, err := pipe.Exec()
+	return err
+}
+
+// Requeue moves a job from the processing list back to the head of the
+// queue, so that it is the first to be received again.
+func (q *reliableJobs) Requeue(msg *Message) error {
+	pipe := q.client.TxPipeline()
+	pipe.LRem(q.processing, 1, msg.Body)
+	pipe.LPush(JobsKeyAt(msg.Location, msg.Priority), msg.Body)
+	pipe.HDel(inflightKey, q.processing)
+	_, err := pipe.Exec()
+	return err
+}
+
+// recover moves back to the queue the jobs left behind by a previous run
+// of this same consumer, e.g. after a restart with the same worker-id, and
+// records its location, for the reapers.
+func (q *reliableJobs) recover() {
+	if q.location != "" {
+		q.client.HSet(processingLocationsKey, q.processing, q.location)
+	} else {
+		q.client.HDel(processingLocationsKey, q.processing)
+	}
+
+	for {
+		job, err := q.client.RPopLPush(q.processing, JobsKeyAt(q.location, PriorityNormal)).Result()
+		if err != nil {
+			if err != redis.Nil {
+				fmt.Printf("Failed to recover jobs of %s: %s\n", q.processing, err.Error())
+			}
+			break
+		}
+		fmt.Printf("job recovered: %s\n", job)
+	}
+
+	q.client.HDel(inflightKey, q.processing)
+}
+
+// reapJobs moves back to the queue the jobs of all the processing lists
+// whose claim time is older than the visibility timeout.
+func reapJobs(client *redis.Client, visibilityTimeout time.Duration) {
+	now := time.Now()
+	staleBefore := now.Add(-visibilityTimeout).Unix()
+
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(cursor, processingKeyPrefix+"*", 100).Result()
+		if err != nil {
+			fmt.Printf("Failed to look for stale jobs: %s\n", err.Error())
+			return
+		}
+
+		for _, key := range keys {
+			location, err := client.HGet(processingLocationsKey, key).Result()
+			if err != nil && err != redis.Nil {
+				fmt.Printf("Failed to get the location of %s: %s\n", key, err.Error())
+				continue
+			}
+
+			count, err := reapScript.Run(client, []string{inflightKey, key, JobsKeyAt(location, PriorityNormal)}, staleBefore, now.Unix()).Int()
+			if err != nil {
+				fmt.Printf("Failed to reap stale jobs of %s: %s\n", key, err.Error())
+				continue
+			}
+			if count > 0 {
+				fmt.Printf("Requeued %d stale jobs from %s\n", count, key)
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+// reaperLoop periodically reaps stale jobs, until the done channel is
+// closed.
+func reaperLoop(client *redis.Client, visibilityTimeout time.Duration, done chan bool) {
+	ticker := time.NewTicker(visibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reapJobs(client, visibilityTimeout)
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+)
+
+// newReliableBackend returns a reliable lists backend, using a fresh redis
+// server.
+func newReliableBackend(t *testing.T, location string) (*RedisBackend, *miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start redis: %s", err)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	b, err := NewRedisBackend(client, RedisOptions{
+		Transport:         TransportList,
+		Reliable:          true,
+		VisibilityTimeout: time.Minute,
+		Location:          location,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	return b, s, client
+}
+
+// Test received jobs are kept in the processing list, until acknowledged
+func TestReliableJobsAck(t *testing.T) {
+	b, s, client := newReliableBackend(t, "")
+	defer s.Close()
+	defer b.Close()
+
+	producer, _ := b.Jobs("")
+	consumer, _ := b.Jobs("worker.1")
+
+	producer.Push("a", PriorityNormal, "")
+	producer.Push("b", PriorityNormal, "")
+
+	msg, err := consumer.Receive(time.Second)
+	if err != nil || msg == nil || msg.Body != "a" {
+		t.Fatalf("Expected job a, got %+v, %v", msg, err)
+	}
+
+	processing := client.LRange(processingKeyPrefix+"worker.1", 0, -1).Val()
+	if len(processing) != 1 || processing[0] != "a" {
+		t.Fatalf("Expected job a to be processing, got %v", processing)
+	}
+	if !client.HExists(inflightKey, processingKeyPrefix+"worker.1").Val() {
+		t.Fatalf("Expected the processing list to be claimed")
+	}
+
+	if err := consumer.Ack(msg); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if n := client.LLen(processingKeyPrefix + "worker.1").Val(); n != 0 {
+		t.Fatalf("Expected no processing jobs, got %d", n)
+	}
+	if client.HExists(inflightKey, processingKeyPrefix+"worker.1").Val() {
+		t.Fatalf("Expected the processing list not to be claimed")
+	}
+	if pending, _ := b.PendingJobs(); pending != 1 {
+		t.Fatalf("Expected 1 pending job, got %d", pending)
+	}
+}
+
+// Test requeued jobs are the first to be received again
+func TestReliableJobsRequeue(t *testing.T) {
+	b, s, client := newReliableBackend(t, "")
+	defer s.Close()
+	defer b.Close()
+
+	producer, _ := b.Jobs("")
+	consumer, _ := b.Jobs("worker.1")
+
+	for _, job := range []string{"a", "b", "c"} {
+		producer.Push(job, PriorityNormal, "")
+	}
+
+	msg, _ := consumer.Receive(time.Second)
+	if msg == nil || msg.Body != "a" {
+		t.Fatalf("Expected job a, got %+v", msg)
+	}
+
+	if err := consumer.Requeue(msg); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if n := client.LLen(processingKeyPrefix + "worker.1").Val(); n != 0 {
+		t.Fatalf("Expected no processing jobs, got %d", n)
+	}
+
+	for _, expected := range []string{"a", "b", "c"} {
+		msg, _ = consumer.Receive(time.Second)
+		if msg == nil || msg.Body != expected {
+			t.Fatalf("Expected job %s, got %+v", expected, msg)
+		}
+		consumer.Ack(msg)
+	}
+
+	msg, _ = consumer.Receive(10 * time.Millisecond)
+	if msg != nil {
+		t.Fatalf("Expected no more jobs, got %+v", msg)
+	}
+}
+
+// Test consumers waiting for jobs receive them in order
+func TestReliableJobsBlockingReceive(t *testing.T) {
+	b, s, _ := newReliableBackend(t, "")
+	defer s.Close()
+	defer b.Close()
+
+	producer, _ := b.Jobs("")
+	consumer, _ := b.Jobs("worker.1")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		producer.Push("a", PriorityNormal, "")
+		producer.Push("b", PriorityNormal, "")
+	}()
+
+	for _, expected := range []string{"a", "b"} {
+		msg, _ := consumer.Receive(2 * time.Second)
+		if msg == nil || msg.Body != expected {
+			t.Fatalf("Expected job %s, got %+v", expected, msg)
+		}
+		consumer.Ack(msg)
+	}
+}
+
+// Test a consumer recovers the jobs it left behind in a previous run
+func TestReliableJobsRecover(t *testing.T) {
+	b, s, client := newReliableBackend(t, "eu")
+	defer s.Close()
+	defer b.Close()
+
+	client.RPush(processingKeyPrefix+"worker.1", "left-behind")
+	client.HSet(inflightKey, processingKeyPrefix+"worker.1", time.Now().Unix())
+
+	consumer, _ := b.Jobs("worker.1")
+
+	if n := client.LLen(processingKeyPrefix + "worker.1").Val(); n != 0 {
+		t.Fatalf("Expected no processing jobs, got %d", n)
+	}
+	if location := client.HGet(processingLocationsKey, processingKeyPrefix+"worker.1").Val(); location != "eu" {
+		t.Fatalf("Expected the location eu to be recorded, got %s", location)
+	}
+
+	msg, _ := consumer.Receive(time.Second)
+	if msg == nil || msg.Body != "left-behind" || msg.Location != "eu" {
+		t.Fatalf("Expected the recovered job, got %+v", msg)
+	}
+}
+
+// Test the reaper only requeues the jobs of stale processing lists
+func TestReapJobs(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start redis: %s", err)
+	}
+	defer s.Close()
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	now := time.Now()
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	fresh := strconv.FormatInt(now.Unix(), 10)
+
+	client.RPush(processingKeyPrefix+"stale", "s1", "s2")
+	client.HSet(inflightKey, processingKeyPrefix+"stale", stale)
+
+	client.RPush(processingKeyPrefix+"stale-eu", "e1")
+	client.HSet(inflightKey, processingKeyPrefix+"stale-eu", stale)
+	client.HSet(processingLocationsKey, processingKeyPrefix+"stale-eu", "eu")
+
+	client.RPush(processingKeyPrefix+"fresh", "f1")
+	client.HSet(inflightKey, processingKeyPrefix+"fresh", fresh)
+
+	client.RPush(processingKeyPrefix+"unclaimed", "u1")
+
+	reapJobs(client, 5*time.Minute)
+
+	if jobs := client.LRange(JobsKeyAt("", PriorityNormal), 0, -1).Val(); len(jobs) != 2 || jobs[0] != "s1" || jobs[1] != "s2" {
+		t.Fatalf("Expected the stale jobs to be requeued in order, got %v", jobs)
+	}
+	if jobs := client.LRange(JobsKeyAt("eu", PriorityNormal), 0, -1).Val(); len(jobs) != 1 || jobs[0] != "e1" {
+		t.Fatalf("Expected the stale job to be requeued at its location, got %v", jobs)
+	}
+	if client.HExists(inflightKey, processingKeyPrefix+"stale").Val() {
+		t.Fatalf("Expected the stale claim to be removed")
+	}
+
+	if n := client.LLen(processingKeyPrefix + "fresh").Val(); n != 1 {
+		t.Fatalf("Expected the fresh job to be left alone, got %d jobs", n)
+	}
+
+	// Unclaimed lists are only given a claim time, to be reaped later
+	if n := client.LLen(processingKeyPrefix + "unclaimed").Val(); n != 1 {
+		t.Fatalf("Expected the unclaimed job to be left alone, got %d jobs", n)
+	}
+	claimed, err := client.HGet(inflightKey, processingKeyPrefix+"unclaimed").Int64()
+	if err != nil || claimed < now.Unix() {
+		t.Fatalf("Expected the unclaimed list to be given a claim time, got %d, %v", claimed, err)
+	}
+
+	// Once stale, it is reaped too
+	reapJobs(client, -time.Minute)
+	if n := client.LLen(processingKeyPrefix + "unclaimed").Val(); n != 0 {
+		t.Fatalf("Expected the unclaimed job to be reaped, got %d jobs", n)
+	}
+}
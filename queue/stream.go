@@ -0,0 +1,369 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// The field of stream entries containing the message body
+const streamBodyField = "body"
+
+// StreamConsumer reads messages from a redis stream, as a member of a
+// consumer group.
+//
+// Messages stay pending until they are acknowledged: if that does not
+// happen within claimIdle, e.g. because the consumer died, another consumer
+// of the same group claims them.
+type StreamConsumer struct {
+	client   *redis.Client
+	stream   string
+	group    string
+	consumer string
+
+	// How long a message can stay pending before being claimed by another
+	// consumer.  If zero, messages are never claimed.
+	claimIdle time.Duration
+
+	// If true, messages are deleted from the stream once acknowledged,
+	// which is useful when there is a single consumer group.
+	DeleteOnAck bool
+
+	// Have we already gone through the messages left pending by a previous
+	// run of this same consumer?
+	recovered bool
+
+	// The last time we looked for messages to claim
+	lastClaim time.Time
+}
+
+// NewStreamConsumer creates a consumer of the given stream, creating the
+// consumer group if needed.
+//
+// New groups only receive messages published after their creation.
+func NewStreamConsumer(client *redis.Client, stream string, group string, consumer string, claimIdle time.Duration) (*StreamConsumer, error) {
+	return NewStreamConsumerFrom(client, stream, group, consumer, claimIdle, "$")
+}
+
+// NewStreamConsumerFrom is like NewStreamConsumer, but if the group does not
+// exist yet it receives messages starting from the given ID, e.g. "0" for
+// all the messages still present in the stream.
+func NewStreamConsumerFrom(client *redis.Client, stream string, group string, consumer string, claimIdle time.Duration, start string) (*StreamConsumer, error) {
+	if group == "" || consumer == "" {
+		return nil, fmt.Errorf("consumer group and name are required to read from a stream")
+	}
+
+	err := client.XGroupCreateMkStream(stream, group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create consumer group %s on %s: %s", group, stream, err.Error())
+	}
+
+	return &StreamConsumer{
+		client:    client,
+		stream:    stream,
+		group:     group,
+		consumer:  consumer,
+		claimIdle: claimIdle,
+	}, nil
+}
+
+// toMessage converts a stream entry to a message.
+func toMessage(msg redis.XMessage) *Message {
+	body, _ := msg.Values[streamBodyField].(string)
+	return &Message{
+		ID:   msg.ID,
+		Body: body,
+	}
+}
+
+// Receive returns the next message for this consumer.
+//
+// Messages left pending by a previous run of this same consumer are
+// returned first, then those left pending for too long by other consumers,
+// and finally new ones.
+func (c *StreamConsumer) Receive(block time.Duration) (*Message, error) {
+	if !c.recovered {
+		msg, err := c.read("0", -1)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+		c.recovered = true
+	}
+
+	if c.claimIdle > 0 && time.Since(c.lastClaim) > c.claimIdle/2 {
+		msg, err := c.claim()
+		if err != nil || msg != nil {
+			return msg, err
+		}
+		c.lastClaim = time.Now()
+	}
+
+	return c.read(">", block)
+}
+
+// read reads a single message of the group, starting from the given ID.
+func (c *StreamConsumer) read(id string, block time.Duration) (*Message, error) {
+	streams, err := c.client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, id},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		for _, msg := range stream.Messages {
+			return toMessage(msg), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// claim takes over a message which has been pending for too long.
+func (c *StreamConsumer) claim() (*Message, error) {
+	pending, err := c.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: c.stream,
+		Group:  c.group,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range pending {
+		if p.Idle < c.claimIdle || p.Consumer == c.consumer {
+			continue
+		}
+
+		claimed, err := c.client.XClaim(&redis.XClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.consumer,
+			MinIdle:  c.claimIdle,
+			Messages: []string{p.Id},
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		// Someone else may have been faster
+		if len(claimed) > 0 {
+			return toMessage(claimed[0]), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Touch resets the idle time of a message, so that it is not claimed by
+// other consumers while it is still being processed.
+func (c *StreamConsumer) Touch(msg *Message) error {
+	return c.client.XClaimJustID(&redis.XClaimArgs{
+		Stream:   c.stream,
+		Group:    c.group,
+		Consumer: c.consumer,
+		Messages: []string{msg.ID},
+	}).Err()
+}
+
+// Ack acknowledges a message, so that it is not delivered again to this
+// consumer group.
+func (c *StreamConsumer) Ack(msg *Message) error {
+	if err := c.client.XAck(c.stream, c.group, msg.ID).Err(); err != nil {
+		return err
+	}
+
+	if c.DeleteOnAck {
+		return c.client.XDel(c.stream, msg.ID).Err()
+	}
+
+	return nil
+}
+
+// StreamPublisher appends messages to a redis stream.
+type StreamPublisher struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewStreamPublisher creates a publisher for the given stream, which is
+// capped to approximately maxLen messages, if > 0.
+func NewStreamPublisher(client *redis.Client, stream string, maxLen int64) *StreamPublisher {
+	return &StreamPublisher{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+// Publish appends a message to the stream.
+func (p *StreamPublisher) Publish(body string) error {
+	return p.client.XAdd(&redis.XAddArgs{
+		Stream:       p.stream,
+		MaxLenApprox: p.maxLen,
+		Values:       map[string]interface{}{streamBodyField: body},
+	}).Err()
+}
+
+// streamJobs is the job queue of a single consumer of the workers group,
+// which reads a stream per priority, and per location.
+type streamJobs struct {
+	client    *redis.Client
+	location  string
+	consumers map[string]*StreamConsumer
+	picker    *picker
+
+	// Publishers are created on first use, as jobs can be pushed to the
+	// streams of any location
+	mutex      sync.Mutex
+	publishers map[string]*StreamPublisher
+	pushOnly   bool
+}
+
+// newStreamJobs creates the job queue of a consumer of the workers group,
+// reading the streams of the given location, if any, and the shared ones.
+//
+// If the group does not exist yet, it is created so that it receives all
+// the jobs already in the streams.
+func newStreamJobs(client *redis.Client, consumer string, location string, visibilityTimeout time.Duration, picker *picker) (*streamJobs, error) {
+	jobs := &streamJobs{
+		client:     client,
+		location:   location,
+		picker:     picker,
+		publishers: make(map[string]*StreamPublisher),
+		pushOnly:   consumer == "",
+	}
+
+	for _, r := range routes(Priorities, location) {
+		stream := StreamKey(r.key())
+
+		// A consumer-less queue is only used to push jobs
+		if consumer == "" {
+			if err := createWorkersGroup(client, stream); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		c, err := NewStreamConsumerFrom(client, stream, WorkersGroup, consumer, visibilityTimeout, "0")
+		if err != nil {
+			return nil, err
+		}
+
+		// Jobs are read by a single group
+		c.DeleteOnAck = true
+
+		if jobs.consumers == nil {
+			jobs.consumers = make(map[string]*StreamConsumer)
+		}
+		jobs.consumers[r.key()] = c
+	}
+
+	return jobs, nil
+}
+
+// createWorkersGroup creates the workers group of the given stream, if
+// needed, so that it receives all the jobs pushed before any worker reads
+// the stream.
+func createWorkersGroup(client *redis.Client, stream string) error {
+	err := client.XGroupCreateMkStream(stream, WorkersGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group %s on %s: %s", WorkersGroup, stream, err.Error())
+	}
+	return nil
+}
+
+// publisher returns the publisher of the stream with the given key.
+func (q *streamJobs) publisher(key string) (*StreamPublisher, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if p := q.publishers[key]; p != nil {
+		return p, nil
+	}
+
+	stream := StreamKey(key)
+	if q.pushOnly {
+		if err := createWorkersGroup(q.client, stream); err != nil {
+			return nil, err
+		}
+	}
+
+	p := NewStreamPublisher(q.client, stream, 0)
+	q.publishers[key] = p
+	return p, nil
+}
+
+func (q *streamJobs) Push(job string, priority string, location string) error {
+	return pushToLocations(q.client, location, func(location string) error {
+		p, err := q.publisher(JobsKeyAt(location, priority))
+		if err != nil {
+			return err
+		}
+		return p.Publish(job)
+	})
+}
+
+// Receive reads the next job from the streams, in the order given by the
+// picker.
+func (q *streamJobs) Receive(block time.Duration) (*Message, error) {
+	if q.consumers == nil {
+		return nil, fmt.Errorf("cannot receive jobs without a consumer name")
+	}
+
+	return receiveInOrder(routes(q.picker.next(), q.location), block, priorityPoll, func(r route, block time.Duration) (*Message, error) {
+		msg, err := q.consumers[r.key()].Receive(block)
+		if msg != nil {
+			msg.Priority = r.priority
+			msg.Location = r.location
+		}
+		return msg, err
+	})
+}
+
+// consumer returns the consumer of the stream the given job was read from.
+func (q *streamJobs) consumer(msg *Message) (*StreamConsumer, error) {
+	c := q.consumers[JobsKeyAt(msg.Location, msg.Priority)]
+	if c == nil {
+		return nil, fmt.Errorf("no consumer for the jobs of priority '%s'", msg.Priority)
+	}
+	return c, nil
+}
+
+func (q *streamJobs) Ack(msg *Message) error {
+	c, err := q.consumer(msg)
+	if err != nil {
+		return err
+	}
+	return c.Ack(msg)
+}
+
+func (q *streamJobs) Touch(msg *Message) error {
+	c, err := q.consumer(msg)
+	if err != nil {
+		return err
+	}
+	return c.Touch(msg)
+}
+
+// Requeue adds the job back to the stream, so that it is immediately
+// available to other workers, instead of waiting to be claimed.
+func (q *streamJobs) Requeue(msg *Message) error {
+	if err := q.Push(msg.Body, msg.Priority, msg.Location); err != nil {
+		return err
+	}
+	return q.Ack(msg)
+}
@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+// Test a consumer first receives the messages it left pending in a
+// previous run
+func TestStreamConsumerRecover(t *testing.T) {
+	s, client := newStreamServer(t)
+	defer s.Close()
+
+	c, err := NewStreamConsumerFrom(client, "stream", "group", "c1", 0, "0")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	p := NewStreamPublisher(client, "stream", 0)
+	p.Publish("a")
+	p.Publish("b")
+
+	msg, _ := c.Receive(10 * time.Millisecond)
+	if msg == nil || msg.Body != "a" {
+		t.Fatalf("Expected message a, got %+v", msg)
+	}
+
+	// Restart without acknowledging it
+	c, _ = NewStreamConsumerFrom(client, "stream", "group", "c1", 0, "0")
+	for _, expected := range []string{"a", "b"} {
+		msg, _ = c.Receive(10 * time.Millisecond)
+		if msg == nil || msg.Body != expected {
+			t.Fatalf("Expected message %s, got %+v", expected, msg)
+		}
+		c.Ack(msg)
+	}
+
+	msg, _ = c.Receive(10 * time.Millisecond)
+	if msg != nil {
+		t.Fatalf("Expected no more messages, got %+v", msg)
+	}
+}
+
+// Test messages pending for too long are claimed by other consumers, unless
+// touched
+func TestStreamConsumerClaim(t *testing.T) {
+	s, client := newStreamServer(t)
+	defer s.Close()
+
+	claimIdle := 50 * time.Millisecond
+	c1, _ := NewStreamConsumerFrom(client, "stream", "group", "c1", claimIdle, "0")
+	c2, _ := NewStreamConsumerFrom(client, "stream", "group", "c2", claimIdle, "0")
+
+	p := NewStreamPublisher(client, "stream", 0)
+	p.Publish("a")
+	p.Publish("b")
+
+	a, _ := c1.Receive(10 * time.Millisecond)
+	b, _ := c1.Receive(10 * time.Millisecond)
+	if a == nil || b == nil {
+		t.Fatalf("Expected two messages, got %+v and %+v", a, b)
+	}
+
+	// Nothing is idle for long enough yet
+	msg, _ := c2.Receive(10 * time.Millisecond)
+	if msg != nil {
+		t.Fatalf("Expected no messages, got %+v", msg)
+	}
+
+	time.Sleep(2 * claimIdle)
+	if err := c1.Touch(a); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	msg, _ = c2.Receive(10 * time.Millisecond)
+	if msg == nil || msg.Body != "b" {
+		t.Fatalf("Expected message b to be claimed, got %+v", msg)
+	}
+
+	pending := s.pending("stream", "group")
+	if pending[a.ID] != "c1" || pending[b.ID] != "c2" {
+		t.Fatalf("Expected a to be pending for c1, and b for c2, got %v", pending)
+	}
+
+	msg, _ = c2.Receive(10 * time.Millisecond)
+	if msg != nil {
+		t.Fatalf("Expected the touched message not to be claimed, got %+v", msg)
+	}
+}
+
+// Test acknowledged messages are only deleted if asked to
+func TestStreamConsumerDeleteOnAck(t *testing.T) {
+	s, client := newStreamServer(t)
+	defer s.Close()
+
+	c, _ := NewStreamConsumerFrom(client, "stream", "group", "c1", 0, "0")
+
+	p := NewStreamPublisher(client, "stream", 0)
+	p.Publish("a")
+	p.Publish("b")
+
+	msg, _ := c.Receive(10 * time.Millisecond)
+	if err := c.Ack(msg); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if pending := s.pending("stream", "group"); len(pending) != 0 {
+		t.Fatalf("Expected no pending messages, got %v", pending)
+	}
+	if n := s.length("stream"); n != 2 {
+		t.Fatalf("Expected the message to be kept, got %d messages", n)
+	}
+
+	c.DeleteOnAck = true
+	msg, _ = c.Receive(10 * time.Millisecond)
+	if err := c.Ack(msg); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if n := s.length("stream"); n != 1 {
+		t.Fatalf("Expected the message to be deleted, got %d messages", n)
+	}
+}
+
+// Test requeued jobs are pushed again before being acknowledged, so that
+// they are not lost if pushing fails
+func TestStreamJobsRequeue(t *testing.T) {
+	s, client := newStreamServer(t)
+	defer s.Close()
+
+	b, err := NewRedisBackend(client, RedisOptions{Transport: TransportStream})
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	defer b.Close()
+
+	producer, _ := b.Jobs("")
+	consumer, _ := b.Jobs("worker.1")
+	stream := StreamKey(JobsKeyAt("", PriorityNormal))
+
+	producer.Push("a", PriorityNormal, "")
+
+	msg, _ := consumer.Receive(10 * time.Millisecond)
+	if msg == nil || msg.Body != "a" {
+		t.Fatalf("Expected job a, got %+v", msg)
+	}
+
+	s.mutex.Lock()
+	s.failAdd = true
+	s.mutex.Unlock()
+
+	if err := consumer.Requeue(msg); err == nil {
+		t.Fatalf("Expected an error requeueing the job")
+	}
+	if pending := s.pending(stream, WorkersGroup); pending[msg.ID] != "worker.1" {
+		t.Fatalf("Expected the job to be still pending, got %v", pending)
+	}
+
+	s.mutex.Lock()
+	s.failAdd = false
+	s.mutex.Unlock()
+
+	if err := consumer.Requeue(msg); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if pending := s.pending(stream, WorkersGroup); len(pending) != 0 {
+		t.Fatalf("Expected no pending jobs, got %v", pending)
+	}
+
+	// Jobs are read by a single group, so the original is deleted
+	if n := s.length(stream); n != 1 {
+		t.Fatalf("Expected only the requeued job in the stream, got %d", n)
+	}
+
+	msg, _ = consumer.Receive(10 * time.Millisecond)
+	if msg == nil || msg.Body != "a" {
+		t.Fatalf("Expected job a again, got %+v", msg)
+	}
+}
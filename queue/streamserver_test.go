@@ -0,0 +1,365 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/server"
+	"github.com/go-redis/redis"
+)
+
+// streamServer is a minimal redis server, which only knows the stream
+// commands used by the queues, as miniredis does not support streams.
+//
+// Blocking reads return immediately.
+type streamServer struct {
+	*server.Server
+
+	mutex   sync.Mutex
+	seq     int
+	streams map[string]*fakeStream
+
+	// If true, XADD fails
+	failAdd bool
+}
+
+type fakeStream struct {
+	entries []fakeEntry
+	groups  map[string]*fakeGroup
+}
+
+type fakeEntry struct {
+	seq    int
+	fields []string
+}
+
+type fakeGroup struct {
+	// The last delivered entry
+	last int
+
+	pending map[int]*fakePending
+}
+
+type fakePending struct {
+	consumer  string
+	delivered time.Time
+	count     int
+}
+
+// newStreamServer starts a stream server, and returns a client of it.
+func newStreamServer(t *testing.T) (*streamServer, *redis.Client) {
+	srv, err := server.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start the stream server: %s", err)
+	}
+
+	s := &streamServer{Server: srv, streams: make(map[string]*fakeStream)}
+	for name, cmd := range map[string]func(args []string) (interface{}, error){
+		"XADD":       s.xadd,
+		"XLEN":       s.xlen,
+		"XDEL":       s.xdel,
+		"XGROUP":     s.xgroup,
+		"XREADGROUP": s.xreadgroup,
+		"XACK":       s.xack,
+		"XPENDING":   s.xpending,
+		"XCLAIM":     s.xclaim,
+	} {
+		cmd := cmd
+		srv.Register(name, func(c *server.Peer, name string, args []string) {
+			s.mutex.Lock()
+			res, err := cmd(args)
+			s.mutex.Unlock()
+
+			if err != nil {
+				c.WriteError(err.Error())
+				return
+			}
+			writeReply(c, res)
+		})
+	}
+
+	return s, redis.NewClient(&redis.Options{Addr: srv.Addr().String()})
+}
+
+// writeReply writes a reply made of strings, integers, nils and arrays.
+func writeReply(c *server.Peer, res interface{}) {
+	switch v := res.(type) {
+	case nil:
+		c.WriteNull()
+	case string:
+		c.WriteBulk(v)
+	case int:
+		c.WriteInt(v)
+	case []interface{}:
+		c.WriteLen(len(v))
+		for _, e := range v {
+			writeReply(c, e)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected reply %T", res))
+	}
+}
+
+func formatID(seq int) string {
+	return fmt.Sprintf("%d-0", seq)
+}
+
+func parseID(id string) int {
+	seq, _ := strconv.Atoi(strings.SplitN(id, "-", 2)[0])
+	return seq
+}
+
+// group returns the given consumer group.
+func (s *streamServer) group(stream string, group string) (*fakeStream, *fakeGroup, error) {
+	st := s.streams[stream]
+	if st == nil || st.groups[group] == nil {
+		return nil, nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", stream, group)
+	}
+	return st, st.groups[group], nil
+}
+
+// entry returns the entry with the given sequence number, if it was not
+// deleted.
+func (st *fakeStream) entry(seq int) *fakeEntry {
+	for i := range st.entries {
+		if st.entries[i].seq == seq {
+			return &st.entries[i]
+		}
+	}
+	return nil
+}
+
+func (e *fakeEntry) reply() interface{} {
+	var fields []interface{}
+	for _, f := range e.fields {
+		fields = append(fields, f)
+	}
+	return []interface{}{formatID(e.seq), fields}
+}
+
+// pendingIDs returns the sorted IDs of the pending entries of a group.
+func (g *fakeGroup) pendingIDs() []int {
+	var ids []int
+	for seq := range g.pending {
+		ids = append(ids, seq)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// XADD stream [MAXLEN [~] n] * field value...
+func (s *streamServer) xadd(args []string) (interface{}, error) {
+	if s.failAdd {
+		return nil, fmt.Errorf("ERR XADD is failing")
+	}
+
+	stream := args[0]
+	args = args[1:]
+	if strings.ToUpper(args[0]) == "MAXLEN" {
+		args = args[1:]
+		if args[0] == "~" {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+
+	st := s.streams[stream]
+	if st == nil {
+		st = &fakeStream{groups: make(map[string]*fakeGroup)}
+		s.streams[stream] = st
+	}
+
+	s.seq++
+	st.entries = append(st.entries, fakeEntry{seq: s.seq, fields: args[1:]})
+	return formatID(s.seq), nil
+}
+
+// XLEN stream
+func (s *streamServer) xlen(args []string) (interface{}, error) {
+	if st := s.streams[args[0]]; st != nil {
+		return len(st.entries), nil
+	}
+	return 0, nil
+}
+
+// XDEL stream id...
+func (s *streamServer) xdel(args []string) (interface{}, error) {
+	st := s.streams[args[0]]
+	if st == nil {
+		return 0, nil
+	}
+
+	deleted := 0
+	for _, id := range args[1:] {
+		for i, e := range st.entries {
+			if e.seq == parseID(id) {
+				st.entries = append(st.entries[:i], st.entries[i+1:]...)
+				deleted++
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// XGROUP CREATE stream group start [MKSTREAM]
+func (s *streamServer) xgroup(args []string) (interface{}, error) {
+	if strings.ToUpper(args[0]) != "CREATE" {
+		return nil, fmt.Errorf("ERR unsupported XGROUP %s", args[0])
+	}
+
+	stream, group, start := args[1], args[2], args[3]
+	st := s.streams[stream]
+	if st == nil {
+		st = &fakeStream{groups: make(map[string]*fakeGroup)}
+		s.streams[stream] = st
+	}
+	if st.groups[group] != nil {
+		return nil, fmt.Errorf("BUSYGROUP Consumer Group name already exists")
+	}
+
+	last := parseID(start)
+	if start == "$" {
+		last = s.seq
+	}
+	st.groups[group] = &fakeGroup{last: last, pending: make(map[int]*fakePending)}
+	return "OK", nil
+}
+
+// XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms] STREAMS stream id
+//
+// Only a single stream, and a single entry, are read.
+func (s *streamServer) xreadgroup(args []string) (interface{}, error) {
+	group, consumer := args[1], args[2]
+	stream, id := args[len(args)-2], args[len(args)-1]
+
+	st, g, err := s.group(stream, group)
+	if err != nil {
+		return nil, err
+	}
+
+	// New entries
+	if id == ">" {
+		for _, e := range st.entries {
+			if e.seq > g.last {
+				g.last = e.seq
+				g.pending[e.seq] = &fakePending{consumer: consumer, delivered: time.Now(), count: 1}
+				return []interface{}{[]interface{}{stream, []interface{}{e.reply()}}}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	// The history of the pending entries of the consumer
+	for _, seq := range g.pendingIDs() {
+		p := g.pending[seq]
+		if seq <= parseID(id) || p.consumer != consumer {
+			continue
+		}
+		if e := st.entry(seq); e != nil {
+			p.count++
+			return []interface{}{[]interface{}{stream, []interface{}{e.reply()}}}, nil
+		}
+	}
+	return []interface{}{[]interface{}{stream, []interface{}{}}}, nil
+}
+
+// XACK stream group id...
+func (s *streamServer) xack(args []string) (interface{}, error) {
+	_, g, err := s.group(args[0], args[1])
+	if err != nil {
+		return 0, nil
+	}
+
+	acked := 0
+	for _, id := range args[2:] {
+		if g.pending[parseID(id)] != nil {
+			delete(g.pending, parseID(id))
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+// XPENDING stream group start end count
+func (s *streamServer) xpending(args []string) (interface{}, error) {
+	_, g, err := s.group(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	res := []interface{}{}
+	for _, seq := range g.pendingIDs() {
+		p := g.pending[seq]
+		idle := int(time.Since(p.delivered) / time.Millisecond)
+		res = append(res, []interface{}{formatID(seq), p.consumer, idle, p.count})
+	}
+	return res, nil
+}
+
+// XCLAIM stream group consumer min-idle id... [JUSTID]
+func (s *streamServer) xclaim(args []string) (interface{}, error) {
+	st, g, err := s.group(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	consumer := args[2]
+	minIdle, _ := strconv.Atoi(args[3])
+	ids := args[4:]
+	justID := strings.ToUpper(ids[len(ids)-1]) == "JUSTID"
+	if justID {
+		ids = ids[:len(ids)-1]
+	}
+
+	res := []interface{}{}
+	for _, id := range ids {
+		p := g.pending[parseID(id)]
+		if p == nil || time.Since(p.delivered) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+
+		p.consumer = consumer
+		p.delivered = time.Now()
+		if justID {
+			res = append(res, id)
+			continue
+		}
+
+		p.count++
+		if e := st.entry(parseID(id)); e != nil {
+			res = append(res, e.reply())
+		}
+	}
+	return res, nil
+}
+
+// pending returns the consumers of the pending entries of a group, by ID.
+func (s *streamServer) pending(stream string, group string) map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := make(map[string]string)
+	if _, g, err := s.group(stream, group); err == nil {
+		for seq, p := range g.pending {
+			res[formatID(seq)] = p.consumer
+		}
+	}
+	return res
+}
+
+// length returns the number of entries of a stream.
+func (s *streamServer) length(stream string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if st := s.streams[stream]; st != nil {
+		return len(st.entries)
+	}
+	return 0
+}
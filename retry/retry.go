@@ -0,0 +1,194 @@
+// Package retry decides whether, and after how long, failed tests are
+// retried.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The supported backoff strategies
+const (
+	// BackoffFixed waits the same delay before every retry
+	BackoffFixed = "fixed"
+
+	// BackoffLinear waits delay*n before the n-th retry
+	BackoffLinear = "linear"
+
+	// BackoffExponential waits delay*2^(n-1) before the n-th retry
+	BackoffExponential = "exponential"
+)
+
+// The error classes failures are sorted into
+const (
+	// ClassAll matches any error
+	ClassAll = "all"
+
+	// ClassTimeout is any timeout, including DNS ones
+	ClassTimeout = "timeout"
+
+	// ClassConnectionRefused is a refused connection
+	ClassConnectionRefused = "connection-refused"
+
+	// ClassConnectionReset is a connection closed by the remote end
+	ClassConnectionReset = "connection-reset"
+
+	// ClassDNS is a failure to resolve a name, other than a timeout
+	ClassDNS = "dns"
+
+	// ClassOther is any other error, e.g. an unexpected status code
+	ClassOther = "other"
+)
+
+// Classes contains all the error classes
+var Classes = []string{ClassAll, ClassTimeout, ClassConnectionRefused, ClassConnectionReset, ClassDNS, ClassOther}
+
+// Policy describes how failed tests are retried.
+type Policy struct {
+	// The delay before the first retry
+	Delay time.Duration
+
+	// How the delay grows with the retries: fixed, linear or exponential
+	Backoff string
+
+	// The max delay before any retry, if > 0
+	MaxDelay time.Duration
+
+	// The max random amount added to each delay, as a percentage of it
+	Jitter float32
+
+	// The error classes which are retried, all if empty
+	On []string
+}
+
+// ValidateBackoff returns an error if the given backoff strategy is
+// unknown.
+func ValidateBackoff(backoff string) error {
+	switch backoff {
+	case BackoffFixed, BackoffLinear, BackoffExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown retry backoff '%s', expected fixed, linear or exponential", backoff)
+}
+
+// ParseClasses parses a comma-separated list of error classes.
+func ParseClasses(value string) ([]string, error) {
+	var classes []string
+
+	for _, class := range strings.Split(value, ",") {
+		class = strings.TrimSpace(class)
+		if class == "" {
+			continue
+		}
+
+		known := false
+		for _, c := range Classes {
+			if c == class {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown error class '%s', expected one of %s", class, strings.Join(Classes, ", "))
+		}
+
+		classes = append(classes, class)
+	}
+
+	return classes, nil
+}
+
+// Classify returns the class of the given error.
+//
+// Protocol tests often report errors as plain strings, so when the error
+// type is not conclusive its message is inspected too.
+func Classify(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ClassTimeout
+		}
+		return ClassDNS
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return ClassTimeout
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ClassConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return ClassConnectionReset
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "timeout") || strings.Contains(msg, "timed out") || strings.Contains(msg, "deadline exceeded"):
+		return ClassTimeout
+	case strings.Contains(msg, "connection refused"):
+		return ClassConnectionRefused
+	case strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe"):
+		return ClassConnectionReset
+	case strings.Contains(msg, "no such host") || strings.Contains(msg, "failed to resolve"):
+		return ClassDNS
+	}
+
+	return ClassOther
+}
+
+// ShouldRetry returns true if the given error is worth retrying.
+func (p *Policy) ShouldRetry(err error) bool {
+	if err == nil {
+		return false
+	}
+	if len(p.On) == 0 {
+		return true
+	}
+
+	class := Classify(err)
+	for _, c := range p.On {
+		if c == class || c == ClassAll {
+			return true
+		}
+	}
+	return false
+}
+
+// DelayBefore returns how long to wait before the given retry, starting
+// from 1.
+func (p *Policy) DelayBefore(retry uint) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+
+	delay := p.Delay
+	switch p.Backoff {
+	case BackoffLinear:
+		delay = p.Delay * time.Duration(retry)
+	case BackoffExponential:
+		// Stop doubling once we're past any sensible delay
+		for i := uint(1); i < retry && delay < 24*time.Hour; i++ {
+			delay *= 2
+		}
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(float64(delay)*float64(p.Jitter)) + 1))
+	}
+
+	return delay
+}
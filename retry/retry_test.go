@@ -0,0 +1,109 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{context.DeadlineExceeded, ClassTimeout},
+		{fmt.Errorf("test timed out after 10s"), ClassTimeout},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ClassConnectionRefused},
+		{fmt.Errorf("dial tcp 127.0.0.1:1: connect: connection refused"), ClassConnectionRefused},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, ClassConnectionReset},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, ClassDNS},
+		{&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, ClassTimeout},
+		{fmt.Errorf("status code was 500 not 200"), ClassOther},
+		{errors.New("content 'moi' not found"), ClassOther},
+	}
+
+	for _, tst := range tests {
+		if class := Classify(tst.err); class != tst.class {
+			t.Errorf("Expected class %s for '%v', got %s", tst.class, tst.err, class)
+		}
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	all := &Policy{}
+	if !all.ShouldRetry(errors.New("status code was 500 not 200")) {
+		t.Errorf("Without classes every error should be retried")
+	}
+	if all.ShouldRetry(nil) {
+		t.Errorf("Successes should never be retried")
+	}
+
+	network := &Policy{On: []string{ClassTimeout, ClassConnectionRefused}}
+	if !network.ShouldRetry(errors.New("connect: connection refused")) {
+		t.Errorf("Refused connections should be retried")
+	}
+	if network.ShouldRetry(errors.New("status code was 500 not 200")) {
+		t.Errorf("Status code mismatches should not be retried")
+	}
+
+	explicit := &Policy{On: []string{ClassAll}}
+	if !explicit.ShouldRetry(errors.New("status code was 500 not 200")) {
+		t.Errorf("Every error should be retried")
+	}
+}
+
+func TestParseClasses(t *testing.T) {
+	classes, err := ParseClasses("timeout, connection-refused")
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if len(classes) != 2 || classes[0] != ClassTimeout || classes[1] != ClassConnectionRefused {
+		t.Fatalf("Unexpected classes %v", classes)
+	}
+
+	if _, err = ParseClasses("timeout,sometimes"); err == nil {
+		t.Fatalf("Expected an error for an unknown class")
+	}
+}
+
+func TestDelayBefore(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		delays []time.Duration
+	}{
+		{Policy{Delay: time.Second, Backoff: BackoffFixed}, []time.Duration{time.Second, time.Second, time.Second}},
+		{Policy{Delay: time.Second, Backoff: BackoffLinear}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+		{Policy{Delay: time.Second, Backoff: BackoffExponential}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}},
+		{Policy{Delay: time.Second, Backoff: BackoffExponential, MaxDelay: 3 * time.Second}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}},
+	}
+
+	for _, tst := range tests {
+		for i, expected := range tst.delays {
+			if delay := tst.policy.DelayBefore(uint(i + 1)); delay != expected {
+				t.Errorf("Expected delay %s before retry %d with %+v, got %s", expected, i+1, tst.policy, delay)
+			}
+		}
+	}
+
+	// Exponential delays must not overflow
+	p := Policy{Delay: time.Second, Backoff: BackoffExponential}
+	if delay := p.DelayBefore(100); delay <= 0 {
+		t.Errorf("Unexpected delay %s", delay)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	p := Policy{Delay: time.Second, Backoff: BackoffFixed, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		delay := p.DelayBefore(1)
+		if delay < time.Second || delay > 1500*time.Millisecond {
+			t.Fatalf("Delay %s out of the jitter range", delay)
+		}
+	}
+}
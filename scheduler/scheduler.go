@@ -0,0 +1,198 @@
+// Package scheduler keeps track of when each parsed test should be
+// enqueued next.
+//
+// Every test runs on its own schedule, defined via the `every` option, or
+// on a default one.  To avoid all the tests hitting the queue at the same
+// instant a random jitter, proportional to the interval of each test, is
+// added to every run.
+//
+// The scheduler doesn't enqueue anything by itself: the caller asks for
+// the tests which are due, and sleeps until the next one.
+package scheduler
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/cmaster11/overseer/utils"
+	"github.com/robfig/cron"
+)
+
+// entry is a single scheduled test.
+type entry struct {
+	test     test.Test
+	spec     string
+	schedule cron.Schedule
+
+	// The nominal time of the next run, and the one including jitter
+	next  time.Time
+	runAt time.Time
+}
+
+// Scheduler holds the scheduling state of a set of tests.
+type Scheduler struct {
+	// The schedule used by tests without an `every` option
+	defaultSpec string
+
+	// The max jitter, as a fraction [0-1] of the interval of a test
+	jitter float32
+
+	rand    *rand.Rand
+	entries map[string]*entry
+}
+
+// New creates a new scheduler.
+//
+// defaultSpec is used for tests which do not define their own schedule,
+// and jitter is the max random delay added to each run, as a fraction of
+// the interval of the test.
+func New(defaultSpec string, jitter float32) (*Scheduler, error) {
+	if _, err := utils.ParseSchedule(defaultSpec); err != nil {
+		return nil, err
+	}
+
+	if jitter < 0 || jitter > 1 {
+		return nil, fmt.Errorf("jitter must be between 0 and 1")
+	}
+
+	return &Scheduler{
+		defaultSpec: defaultSpec,
+		jitter:      jitter,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		entries:     make(map[string]*entry),
+	}, nil
+}
+
+// Len returns the number of scheduled tests.
+func (s *Scheduler) Len() int {
+	return len(s.entries)
+}
+
+// Update replaces the scheduled tests with the given ones, e.g. after the
+// configuration has been reloaded.
+//
+// Tests which were already scheduled, with the same schedule, keep their
+// next run time, so that reloading does not alter their cadence.
+func (s *Scheduler) Update(tests []test.Test, now time.Time) error {
+	entries := make(map[string]*entry)
+
+	for _, tst := range tests {
+
+		spec := tst.Every
+		if spec == "" {
+			spec = s.defaultSpec
+		}
+
+		//
+		// The same line could be defined more than once, so make
+		// every copy unique.
+		//
+		key := tst.Input
+		for idx := 1; entries[key] != nil; idx++ {
+			key = fmt.Sprintf("%s#%d", tst.Input, idx)
+		}
+
+		if existing := s.entries[key]; existing != nil && existing.spec == spec {
+			existing.test = tst
+			entries[key] = existing
+			continue
+		}
+
+		schedule, err := utils.ParseSchedule(spec)
+		if err != nil {
+			return fmt.Errorf("invalid schedule for input '%s': %s", tst.Input, err.Error())
+		}
+
+		e := &entry{
+			test:     tst,
+			spec:     spec,
+			schedule: schedule,
+		}
+
+		//
+		// Interval-based tests are run straight away, like a plain
+		// `overseer enqueue` would do, while cron-based ones wait
+		// for their first activation.
+		//
+		if _, ok := schedule.(cron.ConstantDelaySchedule); ok {
+			e.next = now
+		} else {
+			e.next = schedule.Next(now)
+		}
+		s.plan(e)
+
+		entries[key] = e
+	}
+
+	s.entries = entries
+	return nil
+}
+
+// plan calculates the actual run time of an entry, adding some jitter to
+// its nominal one.
+func (s *Scheduler) plan(e *entry) {
+	e.runAt = e.next
+
+	if s.jitter == 0 {
+		return
+	}
+
+	interval := e.schedule.Next(e.next).Sub(e.next)
+	maxJitter := int64(float64(interval) * float64(s.jitter))
+	if maxJitter > 0 {
+		e.runAt = e.runAt.Add(time.Duration(s.rand.Int63n(maxJitter)))
+	}
+}
+
+// Due returns the tests which have to be enqueued at the given time, and
+// schedules their next run.
+func (s *Scheduler) Due(now time.Time) []test.Test {
+	var due []*entry
+
+	for _, e := range s.entries {
+		if !e.runAt.After(now) {
+			due = append(due, e)
+		}
+	}
+
+	// Keep the order stable, which makes the enqueued jobs predictable
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].runAt.Before(due[j].runAt)
+	})
+
+	tests := make([]test.Test, 0, len(due))
+	for _, e := range due {
+		tests = append(tests, e.test)
+
+		//
+		// If we fell behind (e.g. the host was suspended), skip the
+		// missed runs instead of enqueuing all of them at once.
+		//
+		e.next = e.schedule.Next(e.next)
+		if !e.next.After(now) {
+			e.next = e.schedule.Next(now)
+		}
+		s.plan(e)
+	}
+
+	return tests
+}
+
+// Next returns the time of the next run of any test, and false if there
+// are no scheduled tests.
+func (s *Scheduler) Next() (time.Time, bool) {
+	var next time.Time
+	found := false
+
+	for _, e := range s.entries {
+		if !found || e.runAt.Before(next) {
+			next = e.runAt
+			found = true
+		}
+	}
+
+	return next, found
+}
@@ -0,0 +1,162 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+var start = time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+
+func inputs(tests []test.Test) []string {
+	var res []string
+	for _, tst := range tests {
+		res = append(res, tst.Input)
+	}
+	return res
+}
+
+// Test that interval-based tests run straight away, and then on their own cadence
+func TestEvery(t *testing.T) {
+	s, err := New("1m", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	err = s.Update([]test.Test{
+		{Input: "fast", Every: "10s"},
+		{Input: "default"},
+	}, start)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if due := s.Due(start); len(due) != 2 {
+		t.Fatalf("Expected 2 tests to be due at start, got %v", inputs(due))
+	}
+
+	next, ok := s.Next()
+	if !ok || !next.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("Unexpected next run %s", next)
+	}
+
+	count := map[string]int{}
+	for now := start.Add(time.Second); !now.After(start.Add(time.Minute)); now = now.Add(time.Second) {
+		for _, tst := range s.Due(now) {
+			count[tst.Input]++
+		}
+	}
+
+	if count["fast"] != 6 {
+		t.Errorf("Expected 6 fast runs, got %d", count["fast"])
+	}
+	if count["default"] != 1 {
+		t.Errorf("Expected 1 default run, got %d", count["default"])
+	}
+}
+
+// Test cron-based tests wait for their first activation
+func TestCron(t *testing.T) {
+	s, _ := New("1m", 0)
+
+	err := s.Update([]test.Test{{Input: "cron", Every: "*/5 * * * *"}}, start.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if due := s.Due(start.Add(time.Minute)); len(due) != 0 {
+		t.Fatalf("Expected no tests to be due, got %v", inputs(due))
+	}
+
+	next, _ := s.Next()
+	if !next.Equal(start.Add(5 * time.Minute)) {
+		t.Fatalf("Unexpected next run %s", next)
+	}
+}
+
+// Test the jitter never exceeds the configured fraction of the interval
+func TestJitter(t *testing.T) {
+	s, _ := New("1m", 0.5)
+
+	var tests []test.Test
+	for i := 0; i < 100; i++ {
+		tests = append(tests, test.Test{Input: "test"})
+	}
+	s.Update(tests, start)
+
+	if s.Len() != 100 {
+		t.Fatalf("Expected duplicated lines to be scheduled separately, got %d", s.Len())
+	}
+
+	spread := map[time.Time]bool{}
+	for _, e := range s.entries {
+		if e.runAt.Before(start) || !e.runAt.Before(start.Add(30*time.Second)) {
+			t.Errorf("Run time %s out of the jitter range", e.runAt)
+		}
+		spread[e.runAt] = true
+	}
+
+	if len(spread) < 2 {
+		t.Errorf("Expected runs to be spread by jitter")
+	}
+}
+
+// Test reloading keeps the schedule of unchanged tests
+func TestUpdate(t *testing.T) {
+	s, _ := New("1m", 0)
+
+	s.Update([]test.Test{{Input: "a"}, {Input: "b"}}, start)
+	s.Due(start)
+
+	now := start.Add(20 * time.Second)
+	err := s.Update([]test.Test{{Input: "a"}, {Input: "b", Every: "30s"}, {Input: "c"}}, now)
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	if s.entries["a"].next != start.Add(time.Minute) {
+		t.Errorf("Unchanged test got rescheduled at %s", s.entries["a"].next)
+	}
+
+	due := s.Due(now)
+	if len(due) != 2 || due[0].Input == "a" || due[1].Input == "a" {
+		t.Errorf("Expected changed and new tests to be due, got %v", inputs(due))
+	}
+
+	s.Update([]test.Test{{Input: "a"}}, now)
+	if s.Len() != 1 {
+		t.Errorf("Expected removed tests to be unscheduled")
+	}
+}
+
+// Test we don't enqueue all missed runs at once
+func TestFallBehind(t *testing.T) {
+	s, _ := New("1m", 0)
+
+	s.Update([]test.Test{{Input: "a"}}, start)
+	s.Due(start)
+
+	later := start.Add(time.Hour)
+	if due := s.Due(later); len(due) != 1 {
+		t.Errorf("Expected a single run, got %d", len(due))
+	}
+	if due := s.Due(later); len(due) != 0 {
+		t.Errorf("Expected no more runs, got %d", len(due))
+	}
+}
+
+// Test invalid settings
+func TestInvalid(t *testing.T) {
+	if _, err := New("sometimes", 0); err == nil {
+		t.Errorf("Expected an error for an invalid default schedule")
+	}
+	if _, err := New("1m", 2); err == nil {
+		t.Errorf("Expected an error for an invalid jitter")
+	}
+
+	s, _ := New("1m", 0)
+	if err := s.Update([]test.Test{{Input: "a", Every: "never"}}, start); err == nil {
+		t.Errorf("Expected an error for an invalid test schedule")
+	}
+}
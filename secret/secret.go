@@ -0,0 +1,165 @@
+// Package secret resolves the references to secrets, e.g. passwords, which
+// tests can use instead of their values:
+//
+//   db.example.com must run mysql with username overseer with password env:DB_PASS
+//
+// Only the references are parsed, enqueued, and stored with the results,
+// while the secrets are read by the workers, right before running the
+// tests.
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Resolver returns the secret a reference points to, given the reference
+// without its scheme, e.g. "DB_PASS" for "env:DB_PASS".
+type Resolver func(path string) (string, error)
+
+// The resolvers of the references, by scheme
+var resolvers = map[string]Resolver{
+	// The value of an environment variable
+	"env": fromEnv,
+
+	// The contents of a file, e.g. a Docker or Kubernetes secret
+	"file": fromFile,
+
+	// A file rendered by the Vault agent, or one of its keys
+	"vault-file": fromVaultFile,
+}
+
+// Schemes returns the schemes of the supported references, sorted.
+func Schemes() []string {
+	var schemes []string
+	for scheme := range resolvers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// split returns the scheme and path of a reference, or false if the value
+// is not a reference.
+func split(value string) (string, string, bool) {
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return "", "", false
+	}
+
+	scheme := value[:i]
+	if _, ok := resolvers[scheme]; !ok {
+		return "", "", false
+	}
+	return scheme, value[i+1:], true
+}
+
+// IsReference returns whether the given value is a reference to a secret,
+// rather than the secret itself.
+func IsReference(value string) bool {
+	_, _, ok := split(value)
+	return ok
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate returns an error if the given value is a reference to a secret,
+// which cannot be resolved whatever the environment.
+func Validate(value string) error {
+	scheme, path, ok := split(value)
+	if !ok {
+		return nil
+	}
+
+	if path == "" {
+		return fmt.Errorf("empty %s reference", scheme)
+	}
+	if scheme == "env" && !envName.MatchString(path) {
+		return fmt.Errorf("invalid environment variable name '%s'", path)
+	}
+	return nil
+}
+
+// Resolve returns the secret the given value refers to, or the value
+// itself, if it is not a reference.
+func Resolve(value string) (string, error) {
+	scheme, path, ok := split(value)
+	if !ok {
+		return value, nil
+	}
+
+	if err := Validate(value); err != nil {
+		return "", err
+	}
+
+	secret, err := resolvers[scheme](path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %s", value, err.Error())
+	}
+	return secret, nil
+}
+
+func fromEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable not set")
+	}
+	return value, nil
+}
+
+func fromFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Files usually end with a newline, which is not part of the secret
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// fromVaultFile reads a file rendered by the Vault agent, e.g.
+// "/vault/secrets/db", or one of its keys, e.g. "/vault/secrets/db#password"
+// when the file is JSON: the keys of the data of a secret, as returned by
+// the key/value secrets engines, are found too.
+func fromVaultFile(reference string) (string, error) {
+	path := reference
+	key := ""
+	if i := strings.LastIndex(reference, "#"); i >= 0 {
+		path = reference[:i]
+		key = reference[i+1:]
+	}
+
+	contents, err := fromFile(path)
+	if err != nil || key == "" {
+		return contents, err
+	}
+
+	var data map[string]interface{}
+	if err = json.Unmarshal([]byte(contents), &data); err != nil {
+		// The errors of the decoder quote the contents of the file
+		return "", fmt.Errorf("invalid JSON in %s", path)
+	}
+
+	// Version 2 of the key/value engine nests the data twice
+	for i := 0; i < 3; i++ {
+		if value, ok := data[key]; ok {
+			if s, isString := value.(string); isString {
+				return s, nil
+			}
+			return "", fmt.Errorf("key '%s' of %s is not a string", key, path)
+		}
+
+		nested, ok := data["data"].(map[string]interface{})
+		if !ok {
+			break
+		}
+		data = nested
+	}
+
+	return "", fmt.Errorf("key '%s' not found in %s", key, path)
+}
@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "secret")
+	if err != nil {
+		t.Fatalf("Error creating temporary-directory %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"plain": "s3cret\n",
+		"json":  `{"password": "from-json", "port": 5432}`,
+		"kv2":   `{"data": {"data": {"password": "from-kv2"}, "metadata": {}}}`,
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing %s", err.Error())
+		}
+	}
+
+	os.Setenv("OVERSEER_TEST_SECRET", "from-env")
+	defer os.Unsetenv("OVERSEER_TEST_SECRET")
+	os.Unsetenv("OVERSEER_TEST_UNSET")
+
+	tests := []struct {
+		value    string
+		expected string
+		error    string
+	}{
+		// Values which are not references are left alone
+		{"plaintext", "plaintext", ""},
+		{"unknown:value", "unknown:value", ""},
+
+		{"env:OVERSEER_TEST_SECRET", "from-env", ""},
+		{"env:OVERSEER_TEST_UNSET", "", "environment variable not set"},
+		{"env:NOT-VALID", "", "invalid environment variable name"},
+		{"env:", "", "empty env reference"},
+
+		{"file:" + filepath.Join(dir, "plain"), "s3cret", ""},
+		{"file:" + filepath.Join(dir, "missing"), "", "no such file"},
+
+		{"vault-file:" + filepath.Join(dir, "plain"), "s3cret", ""},
+		{"vault-file:" + filepath.Join(dir, "json") + "#password", "from-json", ""},
+		{"vault-file:" + filepath.Join(dir, "kv2") + "#password", "from-kv2", ""},
+		{"vault-file:" + filepath.Join(dir, "json") + "#port", "", "is not a string"},
+		{"vault-file:" + filepath.Join(dir, "json") + "#user", "", "key 'user' not found"},
+		{"vault-file:" + filepath.Join(dir, "plain") + "#password", "", "invalid JSON"},
+	}
+
+	for _, tst := range tests {
+		value, err := Resolve(tst.value)
+		if tst.error != "" {
+			if err == nil || !strings.Contains(err.Error(), tst.error) {
+				t.Errorf("Expected error '%s' resolving %s, got %v", tst.error, tst.value, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %s", tst.value, err.Error())
+		} else if value != tst.expected {
+			t.Errorf("Expected '%s' resolving %s, got '%s'", tst.expected, tst.value, value)
+		}
+	}
+}
+
+func TestErrorsHideSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "secret")
+	if err != nil {
+		t.Fatalf("Error creating temporary-directory %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "invalid")
+	ioutil.WriteFile(path, []byte(`{"password": s3cret}`), 0600)
+
+	reference := "vault-file:" + path + "#password"
+	_, err = Resolve(reference)
+	if err == nil || err.Error() != "failed to resolve secret "+reference+": invalid JSON in "+path {
+		t.Errorf("Expected an error without the secret, got %v", err)
+	}
+}
+
+func TestSchemes(t *testing.T) {
+	if strings.Join(Schemes(), ",") != "env,file,vault-file" {
+		t.Errorf("Unexpected schemes %v", Schemes())
+	}
+	if !IsReference("file:/run/secrets/db") || IsReference("secret") {
+		t.Errorf("Unexpected references")
+	}
+}
@@ -0,0 +1,137 @@
+// Package silence mutes the notifications of test results, e.g. during
+// planned maintenance.
+//
+// A silence matches results via a filter query, the same used to route
+// results to different queues, and is active either between its start and
+// its end, or during recurring windows, starting every time a cron
+// expression fires.
+package silence
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/filter"
+	"github.com/cmaster11/overseer/test"
+	"github.com/robfig/cron"
+)
+
+// The keys which can be used to match results
+var matchKeys = []string{"type", "tag", "target", "testLabel", "input"}
+
+// Silence mutes the notifications of the matching results.
+type Silence struct {
+	ID string `json:"id"`
+
+	// The filter query matching the results, e.g. target=db1,type=mysql
+	Matchers string `json:"matchers"`
+
+	// When the silence starts, and ends, if it does
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitempty"`
+
+	// If set, the silence is only active for Duration every time this cron
+	// expression fires, e.g. every Sunday at 2am
+	Cron     string        `json:"cron,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Why the results are silenced, and by whom
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	filter   *filter.Filter
+	schedule cron.Schedule
+}
+
+// NewID returns a random silence ID.
+func NewID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Validate makes sure the silence is valid, and prepares it for matching.
+func (s *Silence) Validate() error {
+	if strings.TrimSpace(s.Matchers) == "" {
+		return fmt.Errorf("a silence needs at least a matcher")
+	}
+
+	// Escaped commas are part of the values
+	for _, query := range strings.Split(strings.ReplaceAll(s.Matchers, "\\,", ""), ",") {
+		known := false
+		for _, key := range matchKeys {
+			if strings.HasPrefix(strings.TrimSpace(query), key+"=") {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid matcher '%s', expected one of %s", query, strings.Join(matchKeys, ", "))
+		}
+	}
+
+	f, err := filter.NewFromQuery(s.Matchers)
+	if err != nil {
+		return err
+	}
+	s.filter = f
+
+	if !s.End.IsZero() && !s.End.After(s.Start) {
+		return fmt.Errorf("the end of a silence must be after its start")
+	}
+
+	if s.Cron != "" {
+		schedule, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid cron expression: %s", err.Error())
+		}
+		if s.Duration <= 0 {
+			return fmt.Errorf("a recurring silence needs a duration")
+		}
+		s.schedule = schedule
+	} else if s.End.IsZero() {
+		return fmt.Errorf("a silence needs either an end, or a cron expression")
+	}
+
+	return nil
+}
+
+// Expired returns true if the silence has ended.
+func (s *Silence) Expired(now time.Time) bool {
+	return !s.End.IsZero() && !now.Before(s.End)
+}
+
+// Active returns true if the silence mutes the results at the given time.
+func (s *Silence) Active(now time.Time) bool {
+	if now.Before(s.Start) || s.Expired(now) {
+		return false
+	}
+	if s.schedule == nil {
+		return true
+	}
+
+	// Is there a window which started in the last Duration?
+	next := s.schedule.Next(now.Add(-s.Duration))
+	return !next.After(now)
+}
+
+// Matches returns true if the silence is active, and matches the given
+// result.
+func (s *Silence) Matches(result *test.Result, now time.Time) bool {
+	return s.filter != nil && s.Active(now) && s.filter.Matches(result)
+}
+
+// Store keeps the silences.
+type Store interface {
+	// Add stores a new silence.
+	Add(s *Silence) error
+
+	// List returns all the silences, including the expired ones.
+	List() ([]*Silence, error)
+
+	// Expire ends the silence with the given ID at the given time.
+	Expire(id string, now time.Time) error
+}
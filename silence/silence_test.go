@@ -0,0 +1,121 @@
+package silence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	valid := []Silence{
+		{Matchers: "target=db1", Start: start, End: start.Add(time.Hour)},
+		{Matchers: "type=mysql,tag=!prod", Start: start, Cron: "0 2 * * SUN", Duration: time.Hour},
+		{Matchers: "input=a\\,b", Start: start, End: start.Add(time.Hour)},
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Unexpected error validating %+v: %s", s, err)
+		}
+	}
+
+	invalid := []Silence{
+		{Matchers: "", Start: start, End: start.Add(time.Hour)},
+		{Matchers: "error=.*", Start: start, End: start.Add(time.Hour)},
+		{Matchers: "target=db1", Start: start, End: start},
+		{Matchers: "target=db1", Start: start},
+		{Matchers: "target=db1", Start: start, Cron: "0 2 * * SUN"},
+		{Matchers: "target=db1", Start: start, Cron: "whenever", Duration: time.Hour},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected an error validating %+v", s)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &Silence{Matchers: "target=db1,type=mysql", Start: start, End: start.Add(time.Hour)}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	result := &test.Result{Target: "db1", Type: "mysql"}
+	if !s.Matches(result, start.Add(time.Minute)) {
+		t.Errorf("Expected the result to match")
+	}
+	if s.Matches(result, start.Add(-time.Minute)) || s.Matches(result, start.Add(time.Hour)) {
+		t.Errorf("Expected the silence to be active only between its start and end")
+	}
+	if s.Matches(&test.Result{Target: "db2", Type: "mysql"}, start.Add(time.Minute)) {
+		t.Errorf("Expected a different target not to match")
+	}
+}
+
+// Test recurring silences are only active during their windows
+func TestCronWindow(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+
+	// Every day at 2am, for an hour
+	s := &Silence{Matchers: "target=db1", Start: start, Cron: "0 2 * * *", Duration: time.Hour}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+
+	day := start.AddDate(0, 0, 3)
+	for _, c := range []struct {
+		at     time.Duration
+		active bool
+	}{
+		{time.Hour, false},
+		{2 * time.Hour, true},
+		{2*time.Hour + 59*time.Minute, true},
+		{3 * time.Hour, false},
+		{12 * time.Hour, false},
+	} {
+		if active := s.Active(day.Add(c.at)); active != c.active {
+			t.Errorf("At %s: expected active=%v", day.Add(c.at), c.active)
+		}
+	}
+
+	if s.Active(start.AddDate(0, 0, -1).Add(2*time.Hour + time.Minute)) {
+		t.Errorf("Expected the silence not to be active before its start")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+
+	s := &Silence{ID: NewID(), Matchers: "target=db1", Start: now.Add(-time.Minute), End: now.Add(time.Hour)}
+	if err := store.Add(s); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := store.Add(&Silence{ID: NewID(), Matchers: "target=db1", Start: now}); err == nil {
+		t.Errorf("Expected invalid silences to be refused")
+	}
+
+	cache := NewCache(store, 0)
+	result := &test.Result{Target: "db1"}
+	if matched := cache.Match(result, now); matched == nil || matched.ID != s.ID {
+		t.Fatalf("Expected the result to be silenced, got %+v", matched)
+	}
+
+	if err := store.Expire(s.ID, now); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if err := store.Expire("missing", now); err == nil {
+		t.Errorf("Expected an error expiring a missing silence")
+	}
+
+	silences, _ := store.List()
+	if len(silences) != 1 || !silences[0].Expired(now) {
+		t.Fatalf("Expected the silence to be expired, got %+v", silences)
+	}
+	if matched := cache.Match(result, now); matched != nil {
+		t.Errorf("Expected the result not to be silenced anymore, got %+v", matched)
+	}
+}
@@ -0,0 +1,215 @@
+package silence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// The hash containing all the silences, by ID
+const redisKey = "overseer.silences"
+
+// How long expired silences are kept, so that they can still be listed
+const expiredRetention = 7 * 24 * time.Hour
+
+// prepare sorts silences by start time, and prepares them for
+// matching, skipping the invalid ones.
+func prepare(silences []*Silence) []*Silence {
+	var valid []*Silence
+	for _, s := range silences {
+		if err := s.Validate(); err != nil {
+			fmt.Printf("Ignoring invalid silence %s: %s\n", s.ID, err.Error())
+			continue
+		}
+		valid = append(valid, s)
+	}
+
+	sort.Slice(valid, func(i, j int) bool { return valid[i].Start.Before(valid[j].Start) })
+	return valid
+}
+
+// RedisStore keeps the silences in redis, so that they are shared by all
+// the workers.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store using the given client.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client: client,
+	}
+}
+
+func (r *RedisStore) Add(s *Silence) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(redisKey, s.ID, data).Err()
+}
+
+// List returns all the silences, deleting those which expired long ago.
+func (r *RedisStore) List() ([]*Silence, error) {
+	values, err := r.client.HGetAll(redisKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var silences []*Silence
+	for id, value := range values {
+		s := &Silence{}
+		if err = json.Unmarshal([]byte(value), s); err != nil {
+			fmt.Printf("Ignoring invalid silence %s: %s\n", id, err.Error())
+			continue
+		}
+
+		if s.Expired(time.Now().Add(-expiredRetention)) {
+			r.client.HDel(redisKey, id)
+			continue
+		}
+
+		silences = append(silences, s)
+	}
+
+	return prepare(silences), nil
+}
+
+func (r *RedisStore) Expire(id string, now time.Time) error {
+	value, err := r.client.HGet(redisKey, id).Result()
+	if err == redis.Nil {
+		return fmt.Errorf("no silence with id %s", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	s := &Silence{}
+	if err = json.Unmarshal([]byte(value), s); err != nil {
+		return err
+	}
+	if s.Expired(now) {
+		return nil
+	}
+
+	s.End = now
+	if s.End.Before(s.Start) {
+		s.End = s.Start
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(redisKey, id, data).Err()
+}
+
+// MemoryStore keeps the silences within the current process.
+type MemoryStore struct {
+	mutex    sync.Mutex
+	silences map[string]*Silence
+}
+
+// NewMemoryStore creates a new, empty, in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		silences: make(map[string]*Silence),
+	}
+}
+
+func (m *MemoryStore) Add(s *Silence) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	copied := *s
+	m.silences[s.ID] = &copied
+	return nil
+}
+
+func (m *MemoryStore) List() ([]*Silence, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var silences []*Silence
+	for _, s := range m.silences {
+		copied := *s
+		silences = append(silences, &copied)
+	}
+	return prepare(silences), nil
+}
+
+func (m *MemoryStore) Expire(id string, now time.Time) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := m.silences[id]
+	if s == nil {
+		return fmt.Errorf("no silence with id %s", id)
+	}
+	if !s.Expired(now) {
+		s.End = now
+		if s.End.Before(s.Start) {
+			s.End = s.Start
+		}
+	}
+	return nil
+}
+
+// Cache keeps a copy of the silences of a store, refreshed periodically,
+// so that matching results does not hit the store every time.
+type Cache struct {
+	store   Store
+	refresh time.Duration
+
+	mutex    sync.Mutex
+	silences []*Silence
+	loaded   time.Time
+}
+
+// NewCache creates a cache of the given store, reloading the silences at
+// most every refresh interval.
+func NewCache(store Store, refresh time.Duration) *Cache {
+	return &Cache{
+		store:   store,
+		refresh: refresh,
+	}
+}
+
+// Match returns the first active silence matching the given result, if
+// any.
+//
+// If the silences can't be reloaded, the last known ones are used.
+func (c *Cache) Match(result *test.Result, now time.Time) *Silence {
+	c.mutex.Lock()
+	if time.Since(c.loaded) >= c.refresh {
+		silences, err := c.store.List()
+		if err != nil {
+			fmt.Printf("Failed to load the silences: %s\n", err.Error())
+		} else {
+			c.silences = silences
+		}
+		c.loaded = time.Now()
+	}
+	silences := c.silences
+	c.mutex.Unlock()
+
+	for _, s := range silences {
+		if s.Matches(result, now) {
+			return s
+		}
+	}
+	return nil
+}
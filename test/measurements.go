@@ -0,0 +1,44 @@
+package test
+
+// Names of the measurements which protocol-tests can report.
+const (
+	// MeasurementLatency is the time taken by the test, in milliseconds.
+	MeasurementLatency = "latencyMs"
+
+	// MeasurementHTTPStatus is the status-code of a HTTP response.
+	MeasurementHTTPStatus = "httpStatus"
+
+	// MeasurementCertificateDaysLeft is the number of days before the
+	// first certificate of a TLS chain expires.
+	MeasurementCertificateDaysLeft = "certificateDaysLeft"
+
+	// MeasurementRecords contains the values returned by a lookup, e.g.
+	// the records of a DNS query.
+	MeasurementRecords = "records"
+
+	// MeasurementBanner is the greeting sent by a remote server.
+	MeasurementBanner = "banner"
+)
+
+// Measurements contains the values a protocol-test observed while running,
+// keyed by one of the Measurement* names.
+//
+// Values are either numbers (float64), strings or lists of strings.
+type Measurements map[string]interface{}
+
+// Numbers returns only the numeric measurements, which is what metrics
+// systems are interested in.
+func (m Measurements) Numbers() map[string]float64 {
+	result := make(map[string]float64)
+	for key, value := range m {
+		switch v := value.(type) {
+		case float64:
+			result[key] = v
+		case int:
+			result[key] = float64(v)
+		case int64:
+			result[key] = float64(v)
+		}
+	}
+	return result
+}
@@ -31,20 +31,50 @@ type Result struct {
 	// If true, this alert has recovered from a previous error
 	Recovered bool `json:"recovered"`
 
+	// If true, the result matches an active silence, and should not be notified
+	Silenced bool `json:"silenced"`
+
+	// If not empty, the label of the failing test this failure depends on, in which case it should not be notified
+	SuppressedBy string `json:"suppressedBy,omitempty"`
+
+	// If not empty, the test has just started, or stopped, flapping: "started" or "stopped"
+	Flapping string `json:"flapping"`
+
 	// It not nil, will be used as hash for this test
 	UniqueHash *string `json:"uniqueHash"`
 
 	// If not nil, describes result with a custom label
 	TestLabel *string `json:"testLabel"`
+
+	// If not empty, the location the test has run from, for tests which must run from specific locations
+	Location string `json:"location,omitempty"`
+
+	// For tests with a quorum, the locations the test failed, and passed, from
+	FailedLocations []string `json:"failedLocations,omitempty"`
+	PassedLocations []string `json:"passedLocations,omitempty"`
+
+	// What the test observed while running, if it reported anything
+	Measurements Measurements `json:"measurements,omitempty"`
 }
 
 // Hash generates a unique identifier for the original test (e.g. to deduplicate same results)
+//
+// The results of a test run from multiple locations have different hashes, as each location has its own state.
 func (result *Result) Hash() string {
 	if result.UniqueHash != nil {
-		return utils.GetMD5Hash(*result.UniqueHash)
+		return utils.GetMD5Hash(*result.UniqueHash + result.locationSuffix())
 	}
 
-	return utils.GetMD5Hash(result.Input + result.Target + result.Type + result.Tag)
+	return utils.GetMD5Hash(result.Input + result.Target + result.Type + result.Tag + result.locationSuffix())
+}
+
+// locationSuffix returns what identifies the location of the result in its hash, empty if none, so that the
+// hashes of the results without a location do not change
+func (result *Result) locationSuffix() string {
+	if result.Location == "" {
+		return ""
+	}
+	return "@" + result.Location
 }
 
 // ResultFromJSON creates a result struct from a JSON payload
@@ -19,6 +19,7 @@ package test
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
 	"time"
 )
@@ -30,6 +31,10 @@ type Test struct {
 	// In the example above this would be `1.2.3.4`.
 	Target string
 
+	// If not empty, the hostname Target is one of the addresses of, for tests run against each address their
+	// hostname resolves to
+	ResolvedFrom string
+
 	// Type contains the type of the test.
 	//
 	// In the example above this would be `ftp`.
@@ -43,6 +48,21 @@ type Test struct {
 	// MaxRetries overrides the global overseer setting for max test retries
 	MaxRetries *uint
 
+	// If not nil, overrides the global delay before the first retry
+	RetryDelay *time.Duration
+
+	// If not empty, overrides how the retry delay grows: fixed, linear or exponential
+	RetryBackoff string
+
+	// If not nil, overrides the global max delay between retries
+	RetryMaxDelay *time.Duration
+
+	// If not nil, overrides the global max random amount added to retry delays, as a percentage
+	RetryJitter *float32
+
+	// If not nil, overrides the global error classes which are retried (e.g. timeout, connection-refused)
+	RetryOn []string
+
 	// If not nil, triggers an error for the test only if it fails repeatedly at least for the amount of time defined by this minimum duration
 	MinDuration *time.Duration
 
@@ -52,9 +72,29 @@ type Test struct {
 	// If not nil, avoid re-triggering the same notification on failure for the defined amount of time, or until test succeeds again
 	DedupDuration *time.Duration
 
+	// If not nil, how many results are used to detect whether the test is flapping, 0 to disable flap detection
+	FlapWindow *uint
+
+	// If not nil, the rate of state changes [0-1] above which the test starts flapping
+	FlapHighThreshold *float32
+
+	// If not nil, the rate of state changes [0-1] below which the test stops flapping
+	FlapLowThreshold *float32
+
 	// Total-test timeout
 	Timeout *time.Duration
 
+	// The priority of the test in the job queues: high, normal or low.  Empty means normal
+	Priority string
+
+	// If not empty, the locations the test must run from, "all" meaning every known location.  Otherwise the
+	// test runs from any worker
+	RunFrom []string
+
+	// If not empty, how many of the locations the test runs from must agree that it failed before the failure
+	// is notified, e.g. 2/3
+	Quorum string
+
 	// Arguments contains a map of any optional arguments supplied to
 	// test test.
 	//
@@ -78,6 +118,14 @@ type Test struct {
 
 	// It not nil, describes the test with a custom tag/label
 	TestLabel *string
+
+	// If not empty, the label of the test this one depends on: while that test is failing, the failures of this
+	// one are not notified
+	DependsOn string
+
+	// If not empty, defines how often `overseer schedule` enqueues this test: either a duration (e.g. 30s) or
+	// a cron expression (e.g. '*/5 * * * *')
+	Every string
 }
 
 // Sanitize returns a copy of the input string, but with any password
@@ -99,8 +147,8 @@ func (obj *Test) Sanitize() string {
 		tmp := ""
 
 		// Censor passwords
-		if k == "password" {
-			tmp = " with password 'CENSORED'"
+		if SecretArguments[k] {
+			tmp = fmt.Sprintf(" with %s 'CENSORED'", k)
 		} else {
 
 			// Otherwise leave alone.
@@ -112,6 +160,30 @@ func (obj *Test) Sanitize() string {
 	return res
 }
 
+// SecretArguments are the arguments whose values are censored, and which
+// can refer to secrets, resolved by the worker running the test.
+//
+// The password is the only credential the probes take: ftp, http, imap,
+// imaps, mysql, pop3, pop3s, psql, redis and smtp.  A probe taking other
+// credentials, e.g. a token, must list them here.
+var SecretArguments = map[string]bool{
+	"password": true,
+}
+
+// Redacted returns the input of the test, but with the values of any
+// password censored, unlike Sanitize keeping all of its options.
+func (obj *Test) Redacted() string {
+	return redactArgument.ReplaceAllStringFunc(obj.Input, func(option string) string {
+		match := redactArgument.FindStringSubmatch(option)
+		if !SecretArguments[match[2]] {
+			return option
+		}
+		return match[1] + "'CENSORED'"
+	})
+}
+
+var redactArgument = regexp.MustCompile(`(\swith\s+(\S+)\s+)('[^']*'|"[^"]*"|\S+)`)
+
 // Options are options which are passed to every test-handler.
 //
 // The options might change the way the test operates.
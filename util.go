@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"os/signal"
 	"strings"
@@ -48,3 +49,18 @@ func indent(text, indent string) string {
 	}
 	return result[:len(result)-1]
 }
+
+// copyFlags registers in dst the flags of src, except those whose name
+// starts with any of the given prefixes.
+//
+// This lets a sub-command expose the relevant flags of another one.
+func copyFlags(dst *flag.FlagSet, src *flag.FlagSet, skipPrefixes ...string) {
+	src.VisitAll(func(fl *flag.Flag) {
+		for _, prefix := range skipPrefixes {
+			if strings.HasPrefix(fl.Name, prefix) {
+				return
+			}
+		}
+		dst.Var(fl.Value, fl.Name, fl.Usage)
+	})
+}
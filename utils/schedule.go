@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// ParseSchedule parses the cadence of a scheduled test, which can either
+// be a plain duration (e.g. 30s), or a standard 5-fields cron expression
+// (e.g. */5 * * * *).
+func ParseSchedule(value string) (cron.Schedule, error) {
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		if duration < time.Second {
+			return nil, fmt.Errorf("schedule duration must be >= 1s")
+		}
+		return cron.Every(duration), nil
+	}
+
+	schedule, err := cron.ParseStandard(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule, must be a duration or a cron expression: %s", err.Error())
+	}
+
+	return schedule, nil
+}
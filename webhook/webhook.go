@@ -0,0 +1,62 @@
+// Package webhook posts test results to a webhook, for the webhook bridge
+// and the standalone sub-command.
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// Poster posts the test results worth notifying to a url.
+type Poster struct {
+	// The url results are posted to
+	URL string
+
+	// Should successful results be posted too?
+	SendTestSuccess bool
+
+	// Should the results of tests recovering from failure be posted too?
+	SendTestRecovered bool
+}
+
+// ShouldPost returns true if the given result is worth posting.
+func (p *Poster) ShouldPost(result *test.Result) bool {
+	// Silenced results are muted on purpose, and the failures depending on
+	// a failing test are already notified by that test
+	if result.Silenced || result.SuppressedBy != "" {
+		return false
+	}
+
+	if result.Error != nil {
+		return true
+	}
+
+	// The start, and end, of flapping are always worth knowing
+	return p.SendTestSuccess || (p.SendTestRecovered && result.Recovered) || result.Flapping != ""
+}
+
+// Post posts the given JSON-encoded result.
+//
+// Responses whose status code is not successful are reported as errors,
+// together with their body.
+func (p *Poster) Post(msg []byte) error {
+	res, err := http.Post(p.URL, "application/json", bytes.NewBuffer(msg))
+	if err != nil {
+		return fmt.Errorf("failed to execute webhook request: %s", err.Error())
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response to post: %s", err.Error())
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 400 {
+		return fmt.Errorf("status code was not successful: %d, response: %s", res.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestShouldPost(t *testing.T) {
+	failure := "failed"
+
+	tests := []struct {
+		result   test.Result
+		poster   Poster
+		expected bool
+	}{
+		{test.Result{Error: &failure}, Poster{}, true},
+		{test.Result{}, Poster{}, false},
+		{test.Result{}, Poster{SendTestSuccess: true}, true},
+
+		{test.Result{Recovered: true}, Poster{}, false},
+		{test.Result{Recovered: true}, Poster{SendTestRecovered: true}, true},
+
+		// The start, and end, of flapping are always posted
+		{test.Result{Flapping: "stopped"}, Poster{}, true},
+
+		// Silenced and suppressed failures never are
+		{test.Result{Error: &failure, Silenced: true}, Poster{}, false},
+		{test.Result{Error: &failure, SuppressedBy: "db"}, Poster{SendTestSuccess: true}, false},
+	}
+
+	for _, tst := range tests {
+		if actual := tst.poster.ShouldPost(&tst.result); actual != tst.expected {
+			t.Errorf("Expected %v posting %+v with %+v, got %v", tst.expected, tst.result, tst.poster, actual)
+		}
+	}
+}
+
+func TestPost(t *testing.T) {
+	var received string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(status)
+		w.Write([]byte("nope"))
+	}))
+	defer server.Close()
+
+	p := Poster{URL: server.URL}
+	if err := p.Post([]byte(`{"input": "x"}`)); err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	if received != `{"input": "x"}` {
+		t.Errorf("Expected the result to be posted, got %s", received)
+	}
+
+	status = http.StatusInternalServerError
+	err := p.Post([]byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Expected the status and the response in the error, got %v", err)
+	}
+}